@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	unknownActionLabel    = "unknown"
+	ethTransferLabel      = "ETH transfer"
+	contractCreationLabel = "contract creation"
+)
+
+var defaultActionSelectors = map[string]string{
+	"0xa9059cbb": "ERC-20 transfer",
+	"0x23b872dd": "ERC-20 transferFrom",
+	"0x095ea7b3": "ERC-20 approve",
+	"0x42842e0e": "ERC-721 safeTransferFrom",
+	"0xa22cb465": "NFT setApprovalForAll",
+	"0xd0e30db0": "WETH deposit",
+	"0x2e1a7d4d": "WETH withdraw",
+	"0x7ff36ab5": "Uniswap V2 swap",
+	"0x38ed1739": "Uniswap V2 swap",
+	"0x18cbafe5": "Uniswap V2 swap",
+	"0xfb3bdb41": "Uniswap V2 swap",
+	"0x8803dbee": "Uniswap V2 swap",
+	"0x414bf389": "Uniswap V3 swap",
+	"0xc04b8d59": "Uniswap V3 swap",
+	"0x3593564c": "Uniswap Universal Router execute",
+	"0xac9650d8": "multicall",
+}
+
+// actionRegistry maps 4-byte selectors to human-readable labels, optionally
+// overridden per contract address.
+type actionRegistry struct {
+	Selectors map[string]string            `json:"selectors"`
+	Contracts map[string]map[string]string `json:"contracts"`
+}
+
+var actions = newActionRegistry()
+
+func newActionRegistry() *actionRegistry {
+	r := &actionRegistry{
+		Selectors: make(map[string]string, len(defaultActionSelectors)),
+		Contracts: make(map[string]map[string]string),
+	}
+	for selector, label := range defaultActionSelectors {
+		r.Selectors[selector] = label
+	}
+	return r
+}
+
+// loadActionRegistry extends the built-in labels with a JSON file of the form
+// {"selectors": {"0x...": "label"}, "contracts": {"0xaddr": {"0x...": "label"}}}.
+func loadActionRegistry(path string) (*actionRegistry, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra actionRegistry
+	if err := json.Unmarshal(contents, &extra); err != nil {
+		return nil, fmt.Errorf("failed to decode action registry %s: %v", path, err)
+	}
+
+	r := newActionRegistry()
+	for selector, label := range extra.Selectors {
+		r.Selectors[strings.ToLower(selector)] = label
+	}
+	for contract, selectors := range extra.Contracts {
+		contract = strings.ToLower(contract)
+		if r.Contracts[contract] == nil {
+			r.Contracts[contract] = make(map[string]string)
+		}
+		for selector, label := range selectors {
+			r.Contracts[contract][strings.ToLower(selector)] = label
+		}
+	}
+	return r, nil
+}
+
+func (r *actionRegistry) label(tx Transaction) string {
+	if tx.To == "" {
+		return contractCreationLabel
+	}
+
+	selector := strings.ToLower(transactionSelector(tx))
+	if selector == "" {
+		return ethTransferLabel
+	}
+
+	if label, ok := r.Contracts[strings.ToLower(tx.To)][selector]; ok {
+		return label
+	}
+	if label, ok := r.Selectors[selector]; ok {
+		return label
+	}
+	return unknownActionLabel
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestActionRegistryLabel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actions.json")
+	registry := `{"selectors": {"0x12345678": "custom"}, "contracts": {"0xDEAD": {"0xA9059CBB": "USDT transfer"}}}`
+	if err := os.WriteFile(path, []byte(registry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadActionRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		to, input string
+		want      string
+	}{
+		{to: "", input: "0x6080", want: contractCreationLabel},
+		{to: other, input: "0x", want: ethTransferLabel},
+		{to: other, input: "0xa9059cbb0000", want: "ERC-20 transfer"},
+		{to: "0xdead", input: "0xa9059cbb0000", want: "USDT transfer"},
+		{to: other, input: "0x12345678", want: "custom"},
+		{to: other, input: "0xffffffff", want: unknownActionLabel},
+	}
+	for _, tt := range tests {
+		if got := r.label(Transaction{To: tt.to, Input: tt.input}); got != tt.want {
+			t.Errorf("label(to=%s, input=%s) = %q, want %q", tt.to, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLoadActionRegistryRejectsBadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actions.json")
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := loadActionRegistry(path); err == nil {
+		t.Error("no error for malformed registry")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const activityRangeNote = "Approximate: found by binary search over the address's nonce and balance, so activity that changes neither (calls without value, token transfers) is invisible, and a balance that returns to an earlier value can hide the changes in between."
+
+type activityRange struct {
+	Address    string `json:"address"`
+	StartBlock int64  `json:"startBlock"`
+	EndBlock   int64  `json:"endBlock"`
+
+	// FirstActiveBlock is the first block after which the address has a
+	// nonce or balance; ActiveBeforeStart is set when it already had one
+	// at StartBlock.
+	FirstActiveBlock  *int64 `json:"firstActiveBlock"`
+	ActiveBeforeStart bool   `json:"activeBeforeStart,omitempty"`
+
+	// LastActiveBlock is the block from which the nonce and balance stay
+	// as they are at EndBlock.
+	LastActiveBlock *int64 `json:"lastActiveBlock"`
+
+	Probes int    `json:"probes"`
+	Note   string `json:"note"`
+}
+
+type accountState struct {
+	nonce   *big.Int
+	balance *big.Int
+}
+
+func (a accountState) empty() bool {
+	return a.nonce.Sign() == 0 && a.balance.Sign() == 0
+}
+
+func (a accountState) equal(other accountState) bool {
+	return a.nonce.Cmp(other.nonce) == 0 && a.balance.Cmp(other.balance) == 0
+}
+
+// accountProber reads an address's nonce and balance at past blocks, one
+// batch per block, counting the probes and remembering their results.
+type accountProber struct {
+	address string
+	probed  map[int64]accountState
+}
+
+func (p *accountProber) stateAt(ctx context.Context, block int64) (accountState, error) {
+	if state, ok := p.probed[block]; ok {
+		return state, nil
+	}
+
+	tag := fmt.Sprintf("0x%x", block)
+	results, err := sendRPCBatch(ctx, []rpcCall{
+		{Method: "eth_getTransactionCount", Params: []interface{}{p.address, tag}},
+		{Method: "eth_getBalance", Params: []interface{}{p.address, tag}},
+	})
+	if err != nil {
+		return accountState{}, err
+	}
+
+	var quantities [2]*big.Int
+	for i, result := range results {
+		if result.Err != nil {
+			return accountState{}, result.Err
+		}
+		hex, _ := result.Response["result"].(string)
+		if quantities[i], err = parseQuantity(hex); err != nil {
+			return accountState{}, err
+		}
+	}
+	state := accountState{nonce: quantities[0], balance: quantities[1]}
+	p.probed[block] = state
+	return state, nil
+}
+
+// firstBlock returns the lowest block in [lo, hi] for which found holds,
+// assuming it holds for every block after that one too.
+func (p *accountProber) firstBlock(ctx context.Context, lo, hi int64, found func(accountState) bool) (int64, error) {
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		state, err := p.stateAt(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if found(state) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+func findActivityRange(ctx context.Context, address string, startBlock, endBlock int64) (result activityRange, err error) {
+	result = activityRange{Address: address, StartBlock: startBlock, EndBlock: endBlock, Note: activityRangeNote}
+	p := &accountProber{address: address, probed: make(map[int64]accountState)}
+	defer func() { result.Probes = len(p.probed) }()
+
+	final, err := p.stateAt(ctx, endBlock)
+	if err != nil {
+		return result, err
+	}
+	if final.empty() {
+		return result, nil
+	}
+	initial, err := p.stateAt(ctx, startBlock)
+	if err != nil {
+		return result, err
+	}
+
+	first := startBlock
+	if initial.empty() {
+		first, err = p.firstBlock(ctx, startBlock, endBlock, func(s accountState) bool { return !s.empty() })
+		if err != nil {
+			return result, err
+		}
+	} else {
+		result.ActiveBeforeStart = true
+	}
+	result.FirstActiveBlock = &first
+
+	last, err := p.firstBlock(ctx, first, endBlock, func(s accountState) bool { return s.equal(final) })
+	if err != nil {
+		return result, err
+	}
+	result.LastActiveBlock = &last
+	return result, nil
+}
+
+func activityRangeHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("address")))
+	if address == "" {
+		http.Error(w, "Please provide an address parameter", http.StatusBadRequest)
+		return
+	}
+
+	var startBlock int64
+	if param := r.URL.Query().Get("startBlock"); param != "" {
+		var err error
+		startBlock, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || startBlock < 0 {
+			http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	var endBlock int64
+	if param := r.URL.Query().Get("endBlock"); param != "" {
+		var err error
+		endBlock, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || endBlock < startBlock {
+			http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
+			return
+		}
+	} else {
+		latest, err := getLatestBlockNumber()
+		if err != nil {
+			http.Error(w, "Error fetching latest block: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if latest < startBlock {
+			http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+			return
+		}
+		endBlock = latest
+	}
+
+	result, err := findActivityRange(r.Context(), address, startBlock, endBlock)
+	if isMissingState(err) {
+		http.Error(w, "The endpoint has no state for these blocks; /activity-range needs an archive node: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error probing account state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// serveAccountHistory answers eth_getTransactionCount and eth_getBalance
+// from functions of the block number.
+func serveAccountHistory(node *fakeNode, nonce, balance func(block int64) int64) {
+	at := func(params []interface{}) int64 {
+		block, _ := strconv.ParseInt(params[1].(string)[2:], 16, 64)
+		return block
+	}
+	node.handle("eth_getTransactionCount", func(params []interface{}) (interface{}, error) {
+		return fmt.Sprintf("0x%x", nonce(at(params))), nil
+	})
+	node.handle("eth_getBalance", func(params []interface{}) (interface{}, error) {
+		return fmt.Sprintf("0x%x", balance(at(params))), nil
+	})
+}
+
+func TestActivityRangeFindsFirstAndLastChange(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_blockNumber", "0x3e8")
+	serveAccountHistory(node,
+		func(block int64) int64 {
+			if block >= 250 {
+				return 1
+			}
+			return 0
+		},
+		func(block int64) int64 {
+			switch {
+			case block >= 600:
+				return 3
+			case block >= 100:
+				return 5
+			}
+			return 0
+		},
+	)
+
+	result, rec := getJSON[activityRange](t, activityRangeHandler, "/activity-range?address="+watched)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if result.EndBlock != 1000 || result.FirstActiveBlock == nil || *result.FirstActiveBlock != 100 || result.LastActiveBlock == nil || *result.LastActiveBlock != 600 {
+		t.Errorf("result = %+v, want activity from 100 to 600", result)
+	}
+	if result.ActiveBeforeStart || result.Note == "" {
+		t.Errorf("result = %+v", result)
+	}
+	if result.Probes > 25 {
+		t.Errorf("%d probes, want a binary search", result.Probes)
+	}
+}
+
+func TestActivityRangeEdges(t *testing.T) {
+	node := newFakeNode(t)
+	serveAccountHistory(node,
+		func(int64) int64 { return 0 },
+		func(block int64) int64 {
+			if block >= 10 {
+				return 1
+			}
+			return 0
+		},
+	)
+
+	result, rec := getJSON[activityRange](t, activityRangeHandler, "/activity-range?address="+watched+"&startBlock=20&endBlock=40")
+	if rec.Code != http.StatusOK || !result.ActiveBeforeStart || *result.FirstActiveBlock != 20 || *result.LastActiveBlock != 20 {
+		t.Errorf("already active: %d %+v", rec.Code, result)
+	}
+
+	result, rec = getJSON[activityRange](t, activityRangeHandler, "/activity-range?address="+watched+"&startBlock=0&endBlock=5")
+	if rec.Code != http.StatusOK || result.FirstActiveBlock != nil || result.LastActiveBlock != nil || result.Probes != 1 {
+		t.Errorf("never active: %d %+v", rec.Code, result)
+	}
+}
+
+func TestActivityRangeErrors(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_blockNumber", "0x10")
+	node.handle("eth_getTransactionCount", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32000, Message: "missing trie node 0xabc (path )"}
+	})
+	node.result("eth_getBalance", "0x0")
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{query: "", code: http.StatusBadRequest},
+		{query: "address=" + watched + "&startBlock=-1", code: http.StatusBadRequest},
+		{query: "address=" + watched + "&startBlock=5&endBlock=4", code: http.StatusBadRequest},
+		{query: "address=" + watched + "&startBlock=17", code: http.StatusBadRequest},
+		{query: "address=" + watched, code: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if _, rec := getJSON[activityRange](t, activityRangeHandler, "/activity-range?"+tt.query); rec.Code != tt.code {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.code)
+		}
+	}
+}
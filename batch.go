@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type rpcCall struct {
+	Method string
+	Params []interface{}
+}
+
+// rpcCallResult is one call's share of a batch response: the decoded response
+// object, or the error for that call alone.
+type rpcCallResult struct {
+	Response map[string]interface{}
+	Err      error
+}
+
+// batchUnsupported is set once the endpoint answers a batch with a single
+// error object saying it doesn't take batches, instead of an array. Calls are then sent one by one until the credentials are
+// reloaded.
+var batchUnsupported atomic.Bool
+
+// sendRPCBatch sends calls of any mix of methods as one JSON-RPC batch and
+// routes each response back to its call by id, since nodes may answer a batch
+// in any order. A call missing from the response gets its own error.
+func sendRPCBatch(ctx context.Context, calls []rpcCall) ([]rpcCallResult, error) {
+	if batchUnsupported.Load() {
+		return sendRPCCalls(ctx, calls), nil
+	}
+
+	payloads := make([]RequestPayload, len(calls))
+	callIndex := make(map[int64]int, len(calls))
+	for i, call := range calls {
+		payloads[i] = newRPCPayload(call.Method, call.Params)
+		callIndex[payloads[i].ID] = i
+	}
+
+	req, err := newRPCPayloadRequest(ctx, payloads)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRPCRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON batch response: %v", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		var responsePayload map[string]interface{}
+		if err := json.Unmarshal(body, &responsePayload); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON batch response: %v", err)
+		}
+		err := rpcErrorFromPayload(responsePayload)
+		if err == nil {
+			return nil, fmt.Errorf("batch response is a single object, not an array")
+		}
+		if !rejectsBatches(err) {
+			return nil, err
+		}
+		if !batchUnsupported.Swap(true) {
+			log.Printf("Endpoint rejected a JSON-RPC batch, sending calls one by one: %v", err)
+		}
+		return sendRPCCalls(ctx, calls), nil
+	}
+
+	var responsePayloads []map[string]interface{}
+	if err := json.Unmarshal(body, &responsePayloads); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON batch response: %v", err)
+	}
+
+	results := make([]rpcCallResult, len(calls))
+	answered := make([]bool, len(calls))
+	for _, responsePayload := range responsePayloads {
+		id, _ := responsePayload["id"].(float64)
+		i, ok := callIndex[int64(id)]
+		if !ok || answered[i] {
+			continue
+		}
+		answered[i] = true
+
+		if err := validateRPCResponse(responsePayload, payloads[i].ID); err != nil {
+			results[i].Err = err
+		} else if err := rpcErrorFromPayload(responsePayload); err != nil {
+			results[i].Err = err
+		} else {
+			results[i].Response = responsePayload
+		}
+	}
+	for i := range results {
+		if !answered[i] {
+			results[i].Err = fmt.Errorf("batch response has no result for %s (id %d)", calls[i].Method, payloads[i].ID)
+		}
+	}
+	return results, nil
+}
+
+// rejectsBatches reports whether a single error reply to a batch says the
+// endpoint doesn't take batches, as opposed to a transient failure such as
+// a rate limit that a later batch could get past.
+func rejectsBatches(err error) bool {
+	rpcErr, ok := err.(*rpcError)
+	return ok && (rpcErr.Code == -32600 || strings.Contains(strings.ToLower(rpcErr.Message), "batch"))
+}
+
+// sendRPCCalls makes each call on its own, for endpoints that don't accept
+// batches.
+func sendRPCCalls(ctx context.Context, calls []rpcCall) []rpcCallResult {
+	results := make([]rpcCallResult, len(calls))
+	for i, call := range calls {
+		results[i].Response, results[i].Err = sendRPCRequestContext(ctx, call.Method, call.Params)
+	}
+	return results
+}
+
+func decodeResult(response map[string]interface{}, into interface{}) error {
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resultBytes, into)
+}
+
+// fetchBlockWithReceipts gets a block and its receipts in one round trip by
+// batching eth_getBlockByNumber with eth_getBlockReceipts. Endpoints without
+// eth_getBlockReceipts get a second batch of eth_getTransactionReceipt calls
+// for the matching transactions only, or just the sampled ones when receipts
+// are only wanted for events.
+func (s *scanner) fetchBlockWithReceipts(ctx context.Context, blockNumber string) (*BlockWithTransactions, map[string]*TransactionReceipt, error) {
+	calls := []rpcCall{{Method: "eth_getBlockByNumber", Params: []interface{}{blockNumber, true}}}
+	tryBlockReceipts := !s.blockReceiptsUnsupported.Load()
+	if tryBlockReceipts {
+		calls = append(calls, rpcCall{Method: "eth_getBlockReceipts", Params: []interface{}{blockNumber}})
+	}
+
+	results, err := sendRPCBatch(ctx, calls)
+	if err != nil {
+		return nil, nil, err
+	}
+	if results[0].Err != nil {
+		return nil, nil, results[0].Err
+	}
+	var block *BlockWithTransactions
+	if err := decodeResult(results[0].Response, &block); err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("block %s not found", blockNumber)
+	}
+
+	receipts := make(map[string]*TransactionReceipt)
+	if tryBlockReceipts {
+		switch err := results[1].Err; {
+		case err == nil:
+			var list []*TransactionReceipt
+			if err := decodeResult(results[1].Response, &list); err != nil {
+				return nil, nil, err
+			}
+			for _, receipt := range list {
+				if receipt != nil {
+					receipts[receipt.TransactionHash] = receipt
+				}
+			}
+			return block, receipts, nil
+		case isMethodUnsupported(err):
+			if !s.blockReceiptsUnsupported.Swap(true) {
+				log.Printf("Endpoint does not support eth_getBlockReceipts, fetching receipts per transaction: %v", err)
+			}
+		default:
+			return nil, nil, err
+		}
+	}
+
+	var hashes []string
+	calls = nil
+	for _, tx := range block.Transactions {
+		if s.matches(tx) && (s.opts.Receipts || s.opts.eventSampled(tx.Hash)) {
+			hashes = append(hashes, tx.Hash)
+			calls = append(calls, rpcCall{Method: "eth_getTransactionReceipt", Params: []interface{}{tx.Hash}})
+		}
+	}
+	if len(calls) == 0 {
+		return block, receipts, nil
+	}
+
+	results, err = sendRPCBatch(ctx, calls)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			return nil, nil, result.Err
+		}
+		var receipt *TransactionReceipt
+		if err := decodeResult(result.Response, &receipt); err != nil {
+			return nil, nil, err
+		}
+		if receipt != nil {
+			receipts[hashes[i]] = receipt
+		}
+	}
+	return block, receipts, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSendRPCBatchRoutesResponsesByID(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_chainId", "0x1")
+	node.result("eth_blockNumber", "0x10")
+	node.rawBatch = func(w http.ResponseWriter, calls []RequestPayload) bool {
+		// Reversed, and without an answer for the first call.
+		responses := []map[string]interface{}{}
+		for i := len(calls) - 1; i > 0; i-- {
+			responses = append(responses, node.answer(calls[i]))
+		}
+		writeJSON(w, responses)
+		return true
+	}
+
+	results, err := sendRPCBatch(context.Background(), []rpcCall{
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_chainId", Params: []interface{}{}},
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_getBalance", Params: []interface{}{watched, "latest"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "no result for eth_blockNumber") {
+		t.Errorf("unanswered call: err = %v", results[0].Err)
+	}
+	if results[1].Err != nil || results[1].Response["result"] != "0x1" {
+		t.Errorf("eth_chainId = %+v", results[1])
+	}
+	if results[2].Err != nil || results[2].Response["result"] != "0x10" {
+		t.Errorf("eth_blockNumber = %+v", results[2])
+	}
+	if !isMethodUnsupported(results[3].Err) {
+		t.Errorf("eth_getBalance: err = %v, want the call's own error", results[3].Err)
+	}
+}
+
+func TestSendRPCBatchFallsBackToSingleCalls(t *testing.T) {
+	t.Cleanup(func() { batchUnsupported.Store(false) })
+	node := newFakeNode(t)
+	node.result("eth_chainId", "0x1")
+	node.result("eth_blockNumber", "0x10")
+	node.rawBatch = func(w http.ResponseWriter, calls []RequestPayload) bool {
+		writeJSON(w, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      nil,
+			"error":   rpcError{Code: -32600, Message: "batch requests are not supported"},
+		})
+		return true
+	}
+	calls := []rpcCall{
+		{Method: "eth_chainId", Params: []interface{}{}},
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		results, err := sendRPCBatch(context.Background(), calls)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+		if results[0].Err != nil || results[0].Response["result"] != "0x1" || results[1].Err != nil || results[1].Response["result"] != "0x10" {
+			t.Errorf("attempt %d: results = %+v", attempt, results)
+		}
+	}
+	if node.batches != 1 {
+		t.Errorf("sent %d batches, want the fallback remembered after the first", node.batches)
+	}
+	if calls := node.callCount("eth_chainId"); calls != 2 {
+		t.Errorf("eth_chainId called %d times, want once per attempt", calls)
+	}
+}
+
+func TestSendRPCBatchKeepsBatchingAfterTransientErrors(t *testing.T) {
+	t.Cleanup(func() { batchUnsupported.Store(false) })
+	node := newFakeNode(t)
+	node.rawBatch = func(w http.ResponseWriter, calls []RequestPayload) bool {
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": rpcError{Code: -32005, Message: "rate limit exceeded"}})
+		return true
+	}
+
+	_, err := sendRPCBatch(context.Background(), []rpcCall{{Method: "eth_chainId"}})
+	if rpcErr, ok := err.(*rpcError); !ok || rpcErr.Code != -32005 {
+		t.Errorf("error = %v, want the rate limit error", err)
+	}
+	if batchUnsupported.Load() {
+		t.Error("batches disabled after a rate limit reply")
+	}
+	if calls := node.callCount("eth_chainId"); calls != 0 {
+		t.Errorf("eth_chainId sent alone %d times", calls)
+	}
+}
+
+func TestSendRPCBatchRejectsSingleResult(t *testing.T) {
+	t.Cleanup(func() { batchUnsupported.Store(false) })
+	node := newFakeNode(t)
+	node.rawBatch = func(w http.ResponseWriter, calls []RequestPayload) bool {
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": calls[0].ID, "result": "0x1"})
+		return true
+	}
+
+	if _, err := sendRPCBatch(context.Background(), []rpcCall{{Method: "eth_chainId"}}); err == nil {
+		t.Error("a single result object was accepted as a batch response")
+	}
+	if batchUnsupported.Load() {
+		t.Error("batches disabled without an error reply")
+	}
+}
+
+func TestScanReceiptsWithoutBatchSupport(t *testing.T) {
+	t.Cleanup(func() { batchUnsupported.Store(false) })
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}),
+		testBlock(2, Transaction{Hash: "0x02", To: watched}),
+	)
+	node.handle("eth_getBlockReceipts", func(params []interface{}) (interface{}, error) {
+		hash := "0x01"
+		if params[0] == "0x2" {
+			hash = "0x02"
+		}
+		return []TransactionReceipt{{TransactionHash: hash, Status: "0x1", GasUsed: "0x5208"}}, nil
+	})
+	node.rawBatch = func(w http.ResponseWriter, calls []RequestPayload) bool {
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": rpcError{Code: -32600, Message: "invalid request"}})
+		return true
+	}
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{Receipts: true}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.FailedBlocks) != 0 || len(out.matches) != 2 {
+		t.Fatalf("summary = %+v, matches = %v", summary, out.hashes())
+	}
+	for _, m := range out.matches {
+		if m.Receipt == nil || m.Receipt.Status != "0x1" {
+			t.Errorf("%s: receipt = %+v", m.Tx.Hash, m.Receipt)
+		}
+	}
+	if node.batches != 1 {
+		t.Errorf("sent %d batches, want 1", node.batches)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+type bigQueryField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+}
+
+// bigQuerySchema describes bigQueryRow for `bq load`. Wei amounts overflow
+// INT64, so they are decimal strings.
+var bigQuerySchema = []bigQueryField{
+	{Name: "chain_id", Type: "INTEGER", Mode: "NULLABLE"},
+	{Name: "block_number", Type: "INTEGER", Mode: "REQUIRED"},
+	{Name: "block_timestamp", Type: "TIMESTAMP", Mode: "NULLABLE"},
+	{Name: "transaction_hash", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "transaction_type", Type: "INTEGER", Mode: "NULLABLE"},
+	{Name: "from_address", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "to_address", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "value", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "value_ether", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "gas_price", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "base_fee_per_gas", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "effective_gas_price", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "selector", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "matched_address", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "action", Type: "STRING", Mode: "REQUIRED"},
+}
+
+// bigQueryRow must stay in step with bigQuerySchema.
+type bigQueryRow struct {
+	ChainID           *int64  `json:"chain_id"`
+	BlockNumber       int64   `json:"block_number"`
+	BlockTimestamp    *string `json:"block_timestamp"`
+	TransactionHash   string  `json:"transaction_hash"`
+	TransactionType   *int64  `json:"transaction_type"`
+	FromAddress       string  `json:"from_address"`
+	ToAddress         *string `json:"to_address"`
+	Value             string  `json:"value"`
+	ValueEther        string  `json:"value_ether"`
+	GasPrice          *string `json:"gas_price"`
+	BaseFeePerGas     *string `json:"base_fee_per_gas"`
+	EffectiveGasPrice *string `json:"effective_gas_price"`
+	Selector          *string `json:"selector"`
+	MatchedAddress    string  `json:"matched_address"`
+	Action            string  `json:"action"`
+}
+
+// decimalQuantity converts a hex quantity to a decimal string, or nil when
+// it is absent or malformed.
+func decimalQuantity(value string) *string {
+	n, err := parseQuantity(value)
+	if value == "" || err != nil {
+		return nil
+	}
+	decimal := n.String()
+	return &decimal
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func newBigQueryRow(m match) bigQueryRow {
+	row := bigQueryRow{
+		TransactionHash:   m.Tx.Hash,
+		FromAddress:       m.Tx.From,
+		ToAddress:         optionalString(m.Tx.To),
+		Value:             "0",
+		ValueEther:        convertWeiToEther(m.Tx.Value),
+		GasPrice:          decimalQuantity(m.Tx.GasPrice),
+		BaseFeePerGas:     decimalQuantity(m.Block.BaseFeePerGas),
+		EffectiveGasPrice: decimalQuantity(effectiveGasPriceHex(m)),
+		Selector:          optionalString(transactionSelector(m.Tx)),
+		MatchedAddress:    m.Address,
+		Action:            actions.label(m.Tx),
+	}
+	if m.ChainID != 0 {
+		chainID := m.ChainID
+		row.ChainID = &chainID
+	}
+	if number, err := parseQuantity(m.Block.Number); err == nil {
+		row.BlockNumber = number.Int64()
+	}
+	if value := decimalQuantity(m.Tx.Value); value != nil {
+		row.Value = *value
+	}
+	if timestamp, err := parseQuantity(m.Block.Timestamp); m.Block.Timestamp != "" && err == nil {
+		formatted := time.Unix(timestamp.Int64(), 0).UTC().Format(time.RFC3339)
+		row.BlockTimestamp = &formatted
+	}
+	if txType, err := parseQuantity(m.Tx.Type); m.Tx.Type != "" && err == nil {
+		typ := txType.Int64()
+		row.TransactionType = &typ
+	}
+	return row
+}
+
+// bigQueryMatchWriter writes one flat row per match, loadable with
+// `bq load --source_format=NEWLINE_DELIMITED_JSON`. Unlike the ndjson format
+// there are no summary or error events, which would break the load.
+type bigQueryMatchWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+func newBigQueryMatchWriter(w io.Writer) *bigQueryMatchWriter {
+	b := &bigQueryMatchWriter{enc: json.NewEncoder(w)}
+	b.flusher, _ = w.(http.Flusher)
+	return b
+}
+
+func (b *bigQueryMatchWriter) WriteMatch(m match) error {
+	return b.enc.Encode(newBigQueryRow(m))
+}
+
+func (b *bigQueryMatchWriter) Flush() error {
+	if b.flusher != nil {
+		b.flusher.Flush()
+	}
+	return nil
+}
+
+func bigQuerySchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bigQuerySchema)
+}
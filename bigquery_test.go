@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBigQuerySchemaMatchesRow(t *testing.T) {
+	rowType := reflect.TypeOf(bigQueryRow{})
+	if rowType.NumField() != len(bigQuerySchema) {
+		t.Fatalf("row has %d fields, schema has %d", rowType.NumField(), len(bigQuerySchema))
+	}
+	for i, field := range bigQuerySchema {
+		structField := rowType.Field(i)
+		if tag := structField.Tag.Get("json"); tag != field.Name {
+			t.Errorf("field %d: row tag %q, schema name %q", i, tag, field.Name)
+		}
+		if nullable := structField.Type.Kind() == reflect.Ptr; nullable != (field.Mode == "NULLABLE") {
+			t.Errorf("%s: pointer = %v, mode = %s", field.Name, nullable, field.Mode)
+		}
+	}
+}
+
+func TestNewBigQueryRow(t *testing.T) {
+	block := testBlock(16, Transaction{Hash: "0x01", From: watched, To: other, Value: "0xde0b6b3a7640000", GasPrice: "0x3b9aca00", Type: "0x2", Input: "0xa9059cbb"})
+	block.BaseFeePerGas = "0x64"
+	row := newBigQueryRow(match{Address: watched, Block: block, Tx: block.Transactions[0], ChainID: 1})
+
+	if row.BlockNumber != 16 || row.Value != "1000000000000000000" || row.ValueEther != "1.000000" {
+		t.Errorf("row = %+v", row)
+	}
+	if row.ChainID == nil || *row.ChainID != 1 || row.TransactionType == nil || *row.TransactionType != 2 {
+		t.Errorf("chain id / type = %v / %v", row.ChainID, row.TransactionType)
+	}
+	if row.GasPrice == nil || *row.GasPrice != "1000000000" || row.BaseFeePerGas == nil || *row.BaseFeePerGas != "100" {
+		t.Errorf("gas price / base fee = %v / %v", row.GasPrice, row.BaseFeePerGas)
+	}
+	if row.BlockTimestamp == nil || *row.BlockTimestamp != "2023-11-14T22:16:32Z" {
+		t.Errorf("timestamp = %v", row.BlockTimestamp)
+	}
+
+	creation := newBigQueryRow(match{Address: watched, Block: &BlockWithTransactions{Number: "0x1"}, Tx: Transaction{Hash: "0x02", From: watched}})
+	if creation.ToAddress != nil || creation.ChainID != nil || creation.BlockTimestamp != nil || creation.Value != "0" {
+		t.Errorf("sparse row = %+v", creation)
+	}
+}
+
+func TestBigQueryFormatWritesOnlyRows(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x1"}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: watched, Value: "0x2"}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&format=bigquery")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per match: %s", len(lines), rec.Body)
+	}
+	for i, line := range lines {
+		if len(line) != len(bigQuerySchema) || line["matched_address"] != watched {
+			t.Errorf("line %d = %v", i, line)
+		}
+	}
+}
+
+func TestBigQuerySchemaHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bigQuerySchemaHandler(rec, httptest.NewRequest(http.MethodGet, "/bigquery-schema", nil))
+	var fields []bigQueryField
+	if err := json.NewDecoder(rec.Body).Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fields, bigQuerySchema) {
+		t.Errorf("schema = %+v", fields)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func isFinalized(ctx context.Context, blockNumber string) bool {
+	number, err := parseQuantity(blockNumber)
+	if err != nil {
+		return false
+	}
+
+	finalized, err := getBlockHeader(ctx, "finalized")
+	if err != nil {
+		return false
+	}
+	finalizedNumber, err := parseQuantity(finalized.Number)
+	if err != nil {
+		return false
+	}
+
+	return number.Cmp(finalizedNumber) <= 0
+}
+
+// writeCacheHeaders marks finalized, immutable responses as cacheable under
+// the given ETag. It reports true when the client's If-None-Match already
+// matches, in which case a 304 has been written.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, etag string, finalized bool) bool {
+	if !finalized {
+		w.Header().Set("Cache-Control", "no-cache")
+		return false
+	}
+
+	etag = strconv.Quote(etag)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func blockHandler(w http.ResponseWriter, r *http.Request) {
+	numberParam := r.URL.Query().Get("number")
+	if numberParam == "" {
+		http.Error(w, "Please provide a number parameter", http.StatusBadRequest)
+		return
+	}
+
+	number, err := strconv.ParseInt(numberParam, 10, 64)
+	if err != nil || number < 0 {
+		http.Error(w, "Invalid number parameter", http.StatusBadRequest)
+		return
+	}
+
+	blockNumberHex := fmt.Sprintf("0x%x", number)
+	block, err := getBlockByNumber(r.Context(), blockNumberHex)
+	if err != nil {
+		http.Error(w, "Error fetching block: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if block.Hash == "" {
+		http.Error(w, "Block not found", http.StatusNotFound)
+		return
+	}
+
+	if writeCacheHeaders(w, r, block.Hash, isFinalized(r.Context(), blockNumberHex)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(block)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getBlock(t *testing.T, query string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/block?"+query, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	blockHandler(rec, req)
+	return rec
+}
+
+func TestBlockHandlerCachesFinalizedBlocks(t *testing.T) {
+	node := newFakeNode(t)
+	var finalizedFull []bool
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01"}), testBlock(2), testBlock(3))
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if params[0] == "finalized" {
+			finalizedFull = append(finalizedFull, params[1].(bool))
+			return serve([]interface{}{"0x2", params[1]})
+		}
+		return serve(params)
+	})
+
+	rec := getBlock(t, "number=1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("finalized block headers: ETag %q, Cache-Control %q", etag, rec.Header().Get("Cache-Control"))
+	}
+	var block BlockWithTransactions
+	if err := json.NewDecoder(rec.Body).Decode(&block); err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 1 {
+		t.Errorf("block transactions = %+v", block.Transactions)
+	}
+
+	rec = getBlock(t, "number=1", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	rec = getBlock(t, "number=3", nil)
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" || rec.Header().Get("ETag") != "" {
+		t.Errorf("unfinalized block: Cache-Control %q, ETag %q", got, rec.Header().Get("ETag"))
+	}
+
+	for _, full := range finalizedFull {
+		if full {
+			t.Error("finalized block fetched with full transactions")
+		}
+	}
+	if len(finalizedFull) == 0 {
+		t.Error("finalized block was never looked up")
+	}
+}
+
+func TestBlockHandlerErrors(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+
+	for query, want := range map[string]int{
+		"":           http.StatusBadRequest,
+		"number=abc": http.StatusBadRequest,
+		"number=-1":  http.StatusBadRequest,
+		"number=99":  http.StatusNotFound,
+	} {
+		if rec := getBlock(t, query, nil); rec.Code != want {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// blockscoutTransaction is one entry of Blockscout's Etherscan-compatible
+// `module=account&action=txlist` response, with numbers as decimal strings.
+//
+// confirmations counts from the head the scan started at, and is empty for
+// matches without one. gasUsed, cumulativeGasUsed, isError,
+// txreceipt_status and contractAddress need receipts and stay empty unless
+// the scan ran with receipts=true.
+type blockscoutTransaction struct {
+	BlockHash         string `json:"blockHash"`
+	BlockNumber       string `json:"blockNumber"`
+	Confirmations     string `json:"confirmations"`
+	ContractAddress   string `json:"contractAddress"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	From              string `json:"from"`
+	Gas               string `json:"gas"`
+	GasPrice          string `json:"gasPrice"`
+	GasUsed           string `json:"gasUsed"`
+	Hash              string `json:"hash"`
+	Input             string `json:"input"`
+	IsError           string `json:"isError"`
+	Nonce             string `json:"nonce"`
+	TimeStamp         string `json:"timeStamp"`
+	To                string `json:"to"`
+	TransactionIndex  string `json:"transactionIndex"`
+	TxReceiptStatus   string `json:"txreceipt_status"`
+	Value             string `json:"value"`
+}
+
+type blockscoutResponse struct {
+	Message string                  `json:"message"`
+	Result  []blockscoutTransaction `json:"result"`
+	Status  string                  `json:"status"`
+}
+
+func decimalOrEmpty(value string) string {
+	if decimal := decimalQuantity(value); decimal != nil {
+		return *decimal
+	}
+	return ""
+}
+
+func newBlockscoutTransaction(m match) blockscoutTransaction {
+	tx := blockscoutTransaction{
+		BlockHash:        m.Block.Hash,
+		BlockNumber:      decimalOrEmpty(m.Block.Number),
+		From:             m.Tx.From,
+		Gas:              decimalOrEmpty(m.Tx.Gas),
+		GasPrice:         decimalOrEmpty(m.Tx.GasPrice),
+		Hash:             m.Tx.Hash,
+		Input:            m.Tx.Input,
+		Nonce:            decimalOrEmpty(m.Tx.Nonce),
+		TimeStamp:        decimalOrEmpty(m.Block.Timestamp),
+		To:               m.Tx.To,
+		TransactionIndex: decimalOrEmpty(m.Tx.TransactionIndex),
+		Value:            decimalOrEmpty(m.Tx.Value),
+	}
+	if m.Confirmations != nil {
+		tx.Confirmations = strconv.FormatInt(*m.Confirmations, 10)
+	}
+	if m.Receipt != nil {
+		tx.ContractAddress = m.Receipt.ContractAddress
+		tx.GasUsed = decimalOrEmpty(m.Receipt.GasUsed)
+		tx.CumulativeGasUsed = decimalOrEmpty(m.Receipt.CumulativeGasUsed)
+		tx.TxReceiptStatus = decimalOrEmpty(m.Receipt.Status)
+		tx.IsError = "0"
+		if tx.TxReceiptStatus == "0" {
+			tx.IsError = "1"
+		}
+	}
+	return tx
+}
+
+// writeBlockscoutJSON answers the way Blockscout does, including its
+// "No transactions found" status for an empty list.
+func writeBlockscoutJSON(w io.Writer, matches []match) error {
+	response := blockscoutResponse{Message: "OK", Status: "1", Result: []blockscoutTransaction{}}
+	for _, m := range matches {
+		response.Result = append(response.Result, newBlockscoutTransaction(m))
+	}
+	if len(response.Result) == 0 {
+		response.Message, response.Status = "No transactions found", "0"
+	}
+	return json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNewBlockscoutTransaction(t *testing.T) {
+	block := testBlock(16, Transaction{Hash: "0x01", From: watched, To: other, Value: "0xde0b6b3a7640000", GasPrice: "0x3b9aca00", Gas: "0x5208", Nonce: "0x7", Input: "0x"})
+	confirmations := int64(12)
+	m := match{Address: watched, Block: block, Tx: block.Transactions[0], Confirmations: &confirmations}
+
+	tx := newBlockscoutTransaction(m)
+	want := blockscoutTransaction{
+		BlockHash:        block.Hash,
+		BlockNumber:      "16",
+		Confirmations:    "12",
+		From:             watched,
+		Gas:              "21000",
+		GasPrice:         "1000000000",
+		Hash:             "0x01",
+		Input:            "0x",
+		Nonce:            "7",
+		TimeStamp:        "1700000192",
+		To:               other,
+		TransactionIndex: "0",
+		Value:            "1000000000000000000",
+	}
+	if tx != want {
+		t.Errorf("transaction = %+v, want %+v", tx, want)
+	}
+	m.Confirmations = nil
+	if tx := newBlockscoutTransaction(m); tx.Confirmations != "" {
+		t.Errorf("confirmations = %q without a head", tx.Confirmations)
+	}
+
+	tests := []struct {
+		status  string
+		isError string
+	}{
+		{status: "0x1", isError: "0"},
+		{status: "0x0", isError: "1"},
+	}
+	for _, tt := range tests {
+		m.Receipt = &TransactionReceipt{Status: tt.status, GasUsed: "0x5208", CumulativeGasUsed: "0xa410", ContractAddress: ""}
+		tx := newBlockscoutTransaction(m)
+		if tx.IsError != tt.isError || tx.GasUsed != "21000" || tx.CumulativeGasUsed != "42000" || tx.TxReceiptStatus != tt.status[2:] {
+			t.Errorf("status %s: %+v", tt.status, tx)
+		}
+	}
+}
+
+func TestWriteBlockscoutJSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeBlockscoutJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"message":"No transactions found","result":[],"status":"0"}` + "\n"; buf.String() != want {
+		t.Errorf("body = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestBlockscoutFormat(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x1"}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: watched, Value: "0x2"}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&format=blockscout")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response blockscoutResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "1" || response.Message != "OK" || len(response.Result) != 2 || response.Result[1].Value != "2" || response.Result[0].Confirmations != "2" || response.Result[1].Confirmations != "1" {
+		t.Errorf("response = %+v", response)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+const (
+	bloomInitialCapacity = 1024
+	bloomBitsPerItem     = 10 // about 1% false positives with bloomHashes
+	bloomHashes          = 7
+)
+
+// addressBloom answers "might this address be stored?" without taking the
+// store lock. Bits are set atomically so lookups can run alongside inserts.
+// It has no false negatives, and the store rebuilds it at twice the size
+// once it holds more than capacity addresses.
+type addressBloom struct {
+	bits     []atomic.Uint64
+	capacity int
+	count    int
+}
+
+func newAddressBloom(capacity int) *addressBloom {
+	words := (capacity*bloomBitsPerItem + 63) / 64
+	return &addressBloom{bits: make([]atomic.Uint64, words), capacity: capacity}
+}
+
+// positions derives the bit positions by double hashing one 64-bit FNV hash.
+func (b *addressBloom) positions(address string) [bloomHashes]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(address))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	var positions [bloomHashes]uint64
+	size := uint64(len(b.bits) * 64)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+	return positions
+}
+
+// add must be called with the store's write lock held.
+func (b *addressBloom) add(address string) {
+	for _, pos := range b.positions(address) {
+		word := &b.bits[pos/64]
+		mask := uint64(1) << (pos % 64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+	b.count++
+}
+
+func (b *addressBloom) mayContain(address string) bool {
+	for _, pos := range b.positions(address) {
+		if b.bits[pos/64].Load()&(uint64(1)<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// callFrame is a frame as returned by geth's callTracer.
+type callFrame struct {
+	Type    string      `json:"type"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Value   string      `json:"value"`
+	Gas     string      `json:"gas"`
+	GasUsed string      `json:"gasUsed"`
+	Input   string      `json:"input"`
+	Error   string      `json:"error"`
+	Calls   []callFrame `json:"calls"`
+}
+
+// flameNode is the {name, value, children} shape flamegraph renderers expect.
+// Value is the gas used by the frame including its children; SelfGas is the
+// part spent in the frame itself.
+type flameNode struct {
+	Name     string       `json:"name"`
+	Value    int64        `json:"value"`
+	SelfGas  int64        `json:"selfGas"`
+	Type     string       `json:"type"`
+	From     string       `json:"from"`
+	To       string       `json:"to,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Children []*flameNode `json:"children"`
+}
+
+func traceTransactionCalls(ctx context.Context, hash string) (*callFrame, error) {
+	response, err := sendRPCRequestContext(ctx, "debug_traceTransaction", []interface{}{hash, map[string]string{"tracer": "callTracer"}})
+	if err != nil {
+		return nil, err
+	}
+
+	if response["result"] == nil {
+		return nil, nil
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var frame callFrame
+	if err := json.Unmarshal(resultBytes, &frame); err != nil {
+		return nil, err
+	}
+
+	return &frame, nil
+}
+
+func newFlameNode(frame callFrame) *flameNode {
+	node := &flameNode{
+		Name:     frameName(frame),
+		Type:     frame.Type,
+		From:     frame.From,
+		To:       frame.To,
+		Error:    frame.Error,
+		Children: []*flameNode{},
+	}
+	if gasUsed, err := parseQuantity(frame.GasUsed); err == nil {
+		node.Value = gasUsed.Int64()
+	}
+
+	node.SelfGas = node.Value
+	for _, call := range frame.Calls {
+		child := newFlameNode(call)
+		node.SelfGas -= child.Value
+		node.Children = append(node.Children, child)
+	}
+	if node.SelfGas < 0 {
+		node.SelfGas = 0
+	}
+	return node
+}
+
+func frameName(frame callFrame) string {
+	name := frame.Type + " " + frame.To
+	if frame.To == "" {
+		name = frame.Type
+	}
+	if selector := transactionSelector(Transaction{Input: frame.Input}); selector != "" {
+		name += " " + selector
+	}
+	return name
+}
+
+// isTracerUnsupported covers nodes that have debug_traceTransaction but not
+// the callTracer, which they report with a plain error message.
+func isTracerUnsupported(err error) bool {
+	if isMethodUnsupported(err) {
+		return true
+	}
+	var rpcErr *rpcError
+	return errors.As(err, &rpcErr) && strings.Contains(strings.ToLower(rpcErr.Message), "tracer")
+}
+
+func traceHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "Please provide a hash parameter", http.StatusBadRequest)
+		return
+	}
+
+	frame, err := traceTransactionCalls(r.Context(), hash)
+	if isTracerUnsupported(err) {
+		http.Error(w, "The RPC endpoint does not support debug_traceTransaction with callTracer", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error tracing transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if frame == nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFlameNode(*frame))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getTrace(hash string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	traceHandler(rec, httptest.NewRequest(http.MethodGet, "/trace?hash="+hash, nil))
+	return rec
+}
+
+func TestTraceHandlerBuildsFlameTree(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("debug_traceTransaction", callFrame{
+		Type: "CALL", From: watched, To: other, GasUsed: "0x2710", Input: "0xa9059cbb00",
+		Calls: []callFrame{
+			{Type: "STATICCALL", From: other, To: "0xcc", GasUsed: "0x3e8", Input: "0x70a08231"},
+			{Type: "CREATE", From: other, GasUsed: "0x7d0", Error: "out of gas"},
+		},
+	})
+
+	rec := getTrace("0x01")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var root flameNode
+	if err := json.NewDecoder(rec.Body).Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	if root.Name != "CALL "+other+" 0xa9059cbb" || root.Value != 10000 || root.SelfGas != 7000 {
+		t.Errorf("root = %+v", root)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("root has %d children, want 2", len(root.Children))
+	}
+	if child := root.Children[0]; child.Name != "STATICCALL 0xcc 0x70a08231" || child.Value != 1000 || child.SelfGas != 1000 {
+		t.Errorf("first child = %+v", child)
+	}
+	if child := root.Children[1]; child.Name != "CREATE" || child.Error != "out of gas" || child.Children == nil {
+		t.Errorf("second child = %+v", child)
+	}
+}
+
+func TestTraceHandlerErrors(t *testing.T) {
+	node := newFakeNode(t)
+	if rec := getTrace("0x01"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("no debug namespace: status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+
+	node.handle("debug_traceTransaction", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32000, Message: "tracer not found"}
+	})
+	if rec := getTrace("0x01"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("no callTracer: status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+
+	node.result("debug_traceTransaction", nil)
+	if rec := getTrace("0x01"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown transaction: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := getTrace(""); rec.Code != http.StatusBadRequest {
+		t.Errorf("no hash: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// chainIDCache remembers the endpoint's chain ID after the first lookup. A
+// configured ID, from -chain-id, is used without asking the endpoint.
+type chainIDCache struct {
+	mu         sync.Mutex
+	id         int64
+	configured bool
+}
+
+var chainIDs chainIDCache
+
+func (c *chainIDCache) configure(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+	c.configured = true
+}
+
+// reset forgets a detected chain ID, for when the endpoint changes.
+func (c *chainIDCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.configured {
+		c.id = 0
+	}
+}
+
+func (c *chainIDCache) get(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id != 0 {
+		return c.id, nil
+	}
+
+	response, err := sendRPCRequestContext(ctx, "eth_chainId", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	result, ok := response["result"].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid response format for chain ID")
+	}
+	id, err := parseQuantity(result)
+	if err != nil {
+		return 0, err
+	}
+
+	c.id = id.Int64()
+	return c.id, nil
+}
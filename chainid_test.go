@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestChainIDCacheFetchesOnce(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_chainId", "0x89")
+
+	var cache chainIDCache
+	for i := 0; i < 3; i++ {
+		id, err := cache.get(context.Background())
+		if err != nil || id != 137 {
+			t.Fatalf("get = %d, %v, want 137", id, err)
+		}
+	}
+	if calls := node.callCount("eth_chainId"); calls != 1 {
+		t.Errorf("eth_chainId called %d times, want 1", calls)
+	}
+
+	cache.reset()
+	node.result("eth_chainId", "0x1")
+	if id, _ := cache.get(context.Background()); id != 1 {
+		t.Errorf("after reset: id = %d, want the new endpoint's 1", id)
+	}
+}
+
+func TestChainIDCacheConfigured(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_chainId", "0x1")
+
+	var cache chainIDCache
+	cache.configure(10)
+	cache.reset()
+	if id, err := cache.get(context.Background()); err != nil || id != 10 {
+		t.Errorf("get = %d, %v, want the configured 10", id, err)
+	}
+	if calls := node.callCount("eth_chainId"); calls != 0 {
+		t.Errorf("eth_chainId called %d times for a configured ID", calls)
+	}
+}
+
+func TestScanLabelsChainID(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_chainId", "0xa")
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}))
+	chainIDs.reset()
+	t.Cleanup(chainIDs.reset)
+
+	lines := ndjsonLines(t, getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&chainId=true").Body.String())
+	if len(lines) == 0 || lines[0]["chainId"] != float64(10) {
+		t.Errorf("lines = %v, want chainId 10", lines)
+	}
+
+	lines = ndjsonLines(t, getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson").Body.String())
+	if _, ok := lines[0]["chainId"]; ok {
+		t.Errorf("unlabelled scan has chainId: %v", lines[0])
+	}
+}
+
+func TestScanFailsWithoutChainID(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+	chainIDs.reset()
+	t.Cleanup(chainIDs.reset)
+
+	if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=blockscout&chainId=true"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+)
+
+var rpcClient = http.DefaultClient
+
+// newHTTP2Client returns a client that speaks HTTP/2 to the endpoint. Over
+// TLS it is negotiated via ALPN, falling back to HTTP/1.1 when the server
+// doesn't offer it. Plain http:// endpoints have nothing to negotiate with,
+// so they stay on HTTP/1.1 unless h2c asks for HTTP/2 with prior knowledge.
+func newHTTP2Client(h2c bool) *http.Client {
+	tls := http.DefaultTransport.(*http.Transport).Clone()
+	tls.Protocols = new(http.Protocols)
+	tls.Protocols.SetHTTP1(true)
+	tls.Protocols.SetHTTP2(true)
+
+	cleartext := http.DefaultTransport.(*http.Transport).Clone()
+	cleartext.Protocols = new(http.Protocols)
+	if h2c {
+		cleartext.Protocols.SetUnencryptedHTTP2(true)
+	} else {
+		cleartext.Protocols.SetHTTP1(true)
+	}
+
+	return &http.Client{Transport: &protocolLoggingTransport{next: &http2Transport{tls: tls, cleartext: cleartext}}}
+}
+
+type http2Transport struct {
+	tls       *http.Transport
+	cleartext *http.Transport
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.cleartext.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
+
+type protocolLoggingTransport struct {
+	next http.RoundTripper
+	once sync.Once
+}
+
+func (t *protocolLoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.once.Do(func() {
+			if resp.ProtoMajor == 2 {
+				log.Printf("RPC endpoint negotiated %s", resp.Proto)
+			} else {
+				log.Printf("RPC endpoint does not support HTTP/2, using %s", resp.Proto)
+			}
+		})
+	}
+	return resp, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTP2ClientNegotiatesHTTP2(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(handler)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		client := newHTTP2Client(false)
+		transport := client.Transport.(*protocolLoggingTransport).next.(*http2Transport)
+		transport.tls.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+		assertProto(t, client, server.URL, "HTTP/2.0")
+	})
+
+	t.Run("h2c", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(handler)
+		server.Config.Protocols = new(http.Protocols)
+		server.Config.Protocols.SetHTTP1(true)
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+		server.Start()
+		defer server.Close()
+
+		assertProto(t, newHTTP2Client(true), server.URL, "HTTP/2.0")
+	})
+
+	t.Run("plain http/1.1", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		assertProto(t, newHTTP2Client(false), server.URL, "HTTP/1.1")
+	})
+
+	t.Run("tls without http2", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+
+		client := newHTTP2Client(false)
+		transport := client.Transport.(*protocolLoggingTransport).next.(*http2Transport)
+		transport.tls.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+		assertProto(t, client, server.URL, "HTTP/1.1")
+	})
+}
+
+func assertProto(t *testing.T, client *http.Client, url, want string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Proto != want {
+		t.Errorf("resp.Proto = %q, want %q", resp.Proto, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// blockFlights is nil unless -coalesce-blocks is set.
+var blockFlights *blockFlightGroup
+
+// blockFlightGroup lets concurrent fetches of the same block, from scans
+// running side by side, share one eth_getBlockByNumber call and its decoded
+// block. Nothing is kept once the call returns; a later fetch asks again.
+// Callers share the block, so they must not modify it.
+type blockFlightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*blockFlight
+}
+
+type blockFlight struct {
+	done  chan struct{}
+	block *BlockWithTransactions
+	err   error
+}
+
+func newBlockFlightGroup() *blockFlightGroup {
+	return &blockFlightGroup{flights: make(map[string]*blockFlight)}
+}
+
+// do runs fetch unless a fetch for the same block is already in flight, in
+// which case it waits for that one. The first caller's context governs the
+// call, so a waiter whose leader was cancelled tries again on its own.
+func (g *blockFlightGroup) do(ctx context.Context, blockNumber string, full bool, fetch func() (*BlockWithTransactions, error)) (*BlockWithTransactions, error) {
+	key := fmt.Sprintf("%s/%t", blockNumber, full)
+	for {
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		if !ok {
+			f = &blockFlight{done: make(chan struct{})}
+			g.flights[key] = f
+			g.mu.Unlock()
+
+			f.block, f.err = fetch()
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+			return f.block, f.err
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil && (errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded)) {
+			continue
+		}
+		return f.block, f.err
+	}
+}
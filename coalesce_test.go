@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// joinFlight starts n callers of g.do for block 0x1 while the first fetch
+// is held open, then lets it finish and returns what every caller got.
+func joinFlight(t *testing.T, g *blockFlightGroup, n int, fetch func() (*BlockWithTransactions, error)) ([]*BlockWithTransactions, []error) {
+	t.Helper()
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	held := func() (*BlockWithTransactions, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return fetch()
+	}
+
+	blocks, errs := make([]*BlockWithTransactions, n), make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = g.do(context.Background(), "0x1", true, held)
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	// Give the other callers time to find the flight before it lands.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return blocks, errs
+}
+
+func TestBlockFlightGroupSharesOneFetch(t *testing.T) {
+	g := newBlockFlightGroup()
+	var fetches atomic.Int64
+	block := testBlock(1)
+	blocks, errs := joinFlight(t, g, 5, func() (*BlockWithTransactions, error) {
+		fetches.Add(1)
+		return block, nil
+	})
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want one shared fetch", n)
+	}
+	for i := range blocks {
+		if blocks[i] != block || errs[i] != nil {
+			t.Errorf("caller %d got %v, %v", i, blocks[i], errs[i])
+		}
+	}
+	if len(g.flights) != 0 {
+		t.Errorf("%d flights left behind", len(g.flights))
+	}
+
+	g.do(context.Background(), "0x1", true, func() (*BlockWithTransactions, error) {
+		fetches.Add(1)
+		return block, nil
+	})
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times, want a later call to fetch again", n)
+	}
+}
+
+func TestBlockFlightGroupSharesErrors(t *testing.T) {
+	g := newBlockFlightGroup()
+	var fetches atomic.Int64
+	_, errs := joinFlight(t, g, 3, func() (*BlockWithTransactions, error) {
+		fetches.Add(1)
+		return nil, fmt.Errorf("header not found")
+	})
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want the error shared", n)
+	}
+	for i, err := range errs {
+		if err == nil || err.Error() != "header not found" {
+			t.Errorf("caller %d: error = %v", i, err)
+		}
+	}
+}
+
+func TestBlockFlightGroupRetriesAfterCancelledLeader(t *testing.T) {
+	g := newBlockFlightGroup()
+	var fetches atomic.Int64
+	block := testBlock(1)
+	blocks, errs := joinFlight(t, g, 3, func() (*BlockWithTransactions, error) {
+		if fetches.Add(1) == 1 {
+			return nil, context.Canceled
+		}
+		return block, nil
+	})
+
+	if errs[0] != context.Canceled {
+		t.Errorf("leader error = %v, want context.Canceled", errs[0])
+	}
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i] != block || errs[i] != nil {
+			t.Errorf("waiter %d got %v, %v, want it to fetch again", i, blocks[i], errs[i])
+		}
+	}
+	if n := fetches.Load(); n > 3 {
+		t.Errorf("fetched %d times", n)
+	}
+}
+
+func TestBlockFlightGroupWaiterCancels(t *testing.T) {
+	g := newBlockFlightGroup()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go g.do(context.Background(), "0x1", true, func() (*BlockWithTransactions, error) {
+		close(started)
+		<-release
+		return testBlock(1), nil
+	})
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.do(ctx, "0x1", true, nil); err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want the waiter's own deadline", err)
+	}
+	if block, err := g.do(context.Background(), "0x1", false, func() (*BlockWithTransactions, error) { return testBlock(2), nil }); err != nil || block.Number != "0x2" {
+		t.Errorf("header fetch = %v, %v, want it kept apart from the full block", block, err)
+	}
+}
+
+func TestConcurrentScansShareBlockFetches(t *testing.T) {
+	previous := blockFlights
+	blockFlights = newBlockFlightGroup()
+	t.Cleanup(func() { blockFlights = previous })
+
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}))
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		time.Sleep(30 * time.Millisecond)
+		return serve(params)
+	})
+
+	var wg sync.WaitGroup
+	outs := []*recordingWriter{{}, {}}
+	for _, out := range outs {
+		wg.Add(1)
+		go func(out *recordingWriter) {
+			defer wg.Done()
+			if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 1, scanOptions{}, out); err != nil {
+				t.Error(err)
+			}
+		}(out)
+	}
+	wg.Wait()
+
+	if calls := node.callCount("eth_getBlockByNumber"); calls != 1 {
+		t.Errorf("eth_getBlockByNumber called %d times, want one for both scans", calls)
+	}
+	for i, out := range outs {
+		if fmt.Sprint(out.hashes()) != "[0x01]" {
+			t.Errorf("scan %d matches = %v", i, out.hashes())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// codeSizeCache remembers the bytecode size of every address a scan has
+// looked up, so each recipient costs a single eth_getCode per scan.
+type codeSizeCache struct {
+	mu    sync.Mutex
+	sizes map[string]int
+}
+
+func newCodeSizeCache() *codeSizeCache {
+	return &codeSizeCache{sizes: make(map[string]int)}
+}
+
+// sizeOf returns the code size of address in bytes, 0 for an EOA. It
+// reports false when the cache is nil, there is no address (a contract
+// creation) or the lookup failed.
+func (c *codeSizeCache) sizeOf(ctx context.Context, address string) (int, bool) {
+	if c == nil || address == "" {
+		return 0, false
+	}
+
+	c.mu.Lock()
+	size, ok := c.sizes[address]
+	c.mu.Unlock()
+	if ok {
+		return size, true
+	}
+
+	code, err := getCode(ctx, address)
+	if err != nil {
+		log.Printf("Error fetching code of %s: %v", address, err)
+		return 0, false
+	}
+	size = (len(code) - 2) / 2
+
+	c.mu.Lock()
+	c.sizes[address] = size
+	c.mu.Unlock()
+	return size, true
+}
+
+func getCode(ctx context.Context, address string) (string, error) {
+	return getCodeAt(ctx, address, "latest")
+}
+
+func getCodeAt(ctx context.Context, address, block string) (string, error) {
+	response, err := sendRPCRequestContext(ctx, "eth_getCode", []interface{}{address, block})
+	if err != nil {
+		return "", err
+	}
+	code, ok := response["result"].(string)
+	if !ok || len(code) < 2 || len(code)%2 != 0 {
+		return "", fmt.Errorf("unexpected eth_getCode result: %v", response["result"])
+	}
+	return code, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCodeSizeCache(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_getCode", func(params []interface{}) (interface{}, error) {
+		switch params[0] {
+		case other:
+			return "0x6080604052", nil
+		case "0xbad":
+			return "0x608", nil
+		case "0xdown":
+			return nil, fmt.Errorf("timeout")
+		}
+		return "0x", nil
+	})
+
+	cache := newCodeSizeCache()
+	tests := []struct {
+		address string
+		size    int
+		ok      bool
+	}{
+		{address: other, size: 5, ok: true},
+		{address: other, size: 5, ok: true},
+		{address: watched, size: 0, ok: true},
+		{address: "", ok: false},
+		{address: "0xbad", ok: false},
+		{address: "0xdown", ok: false},
+	}
+	for _, tt := range tests {
+		size, ok := cache.sizeOf(context.Background(), tt.address)
+		if size != tt.size || ok != tt.ok {
+			t.Errorf("sizeOf(%q) = %d, %v, want %d, %v", tt.address, size, ok, tt.size, tt.ok)
+		}
+	}
+	if calls := node.callCount("eth_getCode"); calls != 4 {
+		t.Errorf("eth_getCode called %d times, want each address looked up once", calls)
+	}
+
+	var none *codeSizeCache
+	if _, ok := none.sizeOf(context.Background(), other); ok {
+		t.Error("a nil cache looked up a size")
+	}
+}
+
+func TestScanAddsCodeSizes(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1,
+		Transaction{Hash: "0x01", From: watched, To: other},
+		Transaction{Hash: "0x02", From: watched, To: other},
+		Transaction{Hash: "0x03", From: watched},
+	))
+	node.result("eth_getCode", "0x60806040")
+
+	lines := ndjsonLines(t, getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&codeSize=true").Body.String())
+	if len(lines) < 3 || lines[0]["codeSize"] != float64(4) || lines[1]["codeSize"] != float64(4) {
+		t.Fatalf("lines = %v", lines)
+	}
+	if _, ok := lines[2]["codeSize"]; ok {
+		t.Errorf("contract creation has a codeSize: %v", lines[2])
+	}
+	if calls := node.callCount("eth_getCode"); calls != 1 {
+		t.Errorf("eth_getCode called %d times, want 1", calls)
+	}
+
+	getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson")
+	if calls := node.callCount("eth_getCode"); calls != 1 {
+		t.Errorf("eth_getCode called without codeSize=true")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// confirmationBuffer holds a watcher's matches until their block is depth
+// blocks below the head. Before a match is written its block is checked
+// against the canonical chain; matches from blocks that were reorged out
+// are dropped instead.
+type confirmationBuffer struct {
+	depth   int64
+	pending []match
+	queued  map[string]bool
+}
+
+func newConfirmationBuffer() *confirmationBuffer {
+	return &confirmationBuffer{queued: make(map[string]bool)}
+}
+
+// WriteMatch queues m. A match already queued for the same block, as after
+// a scan repeated by a reload, is queued once.
+func (b *confirmationBuffer) WriteMatch(m match) error {
+	key := m.Address + "/" + m.Tx.Hash + "/" + m.Block.Hash
+	if b.queued[key] {
+		return nil
+	}
+	b.queued[key] = true
+	b.pending = append(b.pending, m)
+	return nil
+}
+
+func (b *confirmationBuffer) Flush() error {
+	return nil
+}
+
+// release writes the queued matches with at least depth confirmations at
+// latest whose block is still canonical, in the order they were queued. It
+// returns the heights whose block was replaced, for the caller to rescan.
+// Matches whose block couldn't be checked stay queued for the next call.
+func (b *confirmationBuffer) release(ctx context.Context, latest int64, out matchWriter) ([]int64, error) {
+	canonical := make(map[int64]string)
+	var reorged []int64
+	var kept []match
+	for i, m := range b.pending {
+		number, err := parseQuantity(m.Block.Number)
+		if err != nil {
+			b.forget(m)
+			continue
+		}
+		block := number.Int64()
+		if latest-block < b.depth {
+			kept = append(kept, m)
+			continue
+		}
+
+		hash, ok := canonical[block]
+		if !ok {
+			header, err := getBlockHeader(ctx, fmt.Sprintf("0x%x", block))
+			if err != nil {
+				b.pending = append(kept, b.pending[i:]...)
+				return reorged, err
+			}
+			hash = header.Hash
+			canonical[block] = hash
+			if hash != m.Block.Hash {
+				reorged = append(reorged, block)
+			}
+		}
+
+		b.forget(m)
+		if hash != m.Block.Hash {
+			log.Printf("Dropping transaction %s: block %d was reorged out before %d confirmations", m.Tx.Hash, block, b.depth)
+			continue
+		}
+		confirmations := confirmationsAt(m.Block.Number, latest)
+		m.Confirmations = &confirmations
+		if err := out.WriteMatch(m); err != nil {
+			b.pending = append(kept, b.pending[i+1:]...)
+			return reorged, err
+		}
+	}
+	b.pending = kept
+	return reorged, out.Flush()
+}
+
+// confirmationsAt counts the block itself, so a transaction in the head
+// block has one confirmation. A pending transaction, with no block number,
+// has none.
+func confirmationsAt(blockNumber string, head int64) int64 {
+	number, err := parseQuantity(blockNumber)
+	if blockNumber == "" || err != nil {
+		return 0
+	}
+	return max(head-number.Int64()+1, 0)
+}
+
+func (b *confirmationBuffer) forget(m match) {
+	delete(b.queued, m.Address+"/"+m.Tx.Hash+"/"+m.Block.Hash)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConfirmationBufferHoldsMatchesUntilDeep(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3), testBlock(4))
+
+	b := newConfirmationBuffer()
+	b.depth = 2
+	first := match{Address: watched, Block: testBlock(1), Tx: Transaction{Hash: "0x01"}}
+	second := match{Address: watched, Block: testBlock(2), Tx: Transaction{Hash: "0x02"}}
+	b.WriteMatch(first)
+	b.WriteMatch(second)
+	b.WriteMatch(first)
+
+	out := &recordingWriter{}
+	if _, err := b.release(context.Background(), 2, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.matches) != 0 {
+		t.Errorf("released %d matches at depth 1", len(out.matches))
+	}
+	if _, err := b.release(context.Background(), 3, out); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(out.hashes()) != "[0x01]" || len(b.pending) != 1 {
+		t.Errorf("released %v with %d pending, want block 1's match once", out.hashes(), len(b.pending))
+	}
+	if _, err := b.release(context.Background(), 4, out); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(out.hashes()) != "[0x01 0x02]" || len(b.pending) != 0 || len(b.queued) != 0 {
+		t.Errorf("released %v, %d still pending", out.hashes(), len(b.pending))
+	}
+}
+
+func TestConfirmationBufferDropsReorgedMatches(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3))
+
+	stale := testBlock(2)
+	stale.Hash = "0xstale"
+	b := newConfirmationBuffer()
+	b.depth = 1
+	b.WriteMatch(match{Address: watched, Block: stale, Tx: Transaction{Hash: "0x02"}})
+	b.WriteMatch(match{Address: other, Block: stale, Tx: Transaction{Hash: "0x02"}})
+	b.WriteMatch(match{Address: watched, Block: testBlock(1), Tx: Transaction{Hash: "0x01"}})
+
+	out := &recordingWriter{}
+	reorged, err := b.release(context.Background(), 3, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(reorged) != "[2]" {
+		t.Errorf("reorged = %v, want block 2 reported once", reorged)
+	}
+	if fmt.Sprint(out.hashes()) != "[0x01]" || len(b.pending) != 0 {
+		t.Errorf("released %v with %d pending, want the reorged matches dropped", out.hashes(), len(b.pending))
+	}
+	if calls := node.callCount("eth_getBlockByNumber"); calls != 2 {
+		t.Errorf("eth_getBlockByNumber called %d times, want each height checked once", calls)
+	}
+}
+
+func TestConfirmationBufferKeepsMatchesItCannotCheck(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_getBlockByNumber", func([]interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("header not found")
+	})
+
+	b := newConfirmationBuffer()
+	b.depth = 1
+	b.WriteMatch(match{Address: watched, Block: testBlock(1), Tx: Transaction{Hash: "0x01"}})
+	b.WriteMatch(match{Address: watched, Block: testBlock(2), Tx: Transaction{Hash: "0x02"}})
+
+	out := &recordingWriter{}
+	if _, err := b.release(context.Background(), 5, out); err == nil {
+		t.Fatal("release succeeded without the canonical headers")
+	}
+	if len(out.matches) != 0 || len(b.pending) != 2 {
+		t.Errorf("released %d matches, %d pending, want both kept for the next try", len(out.matches), len(b.pending))
+	}
+}
+
+func TestWatcherRescansReorgedBlocksBeforeConfirming(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}))
+
+	out := make(channelWriter, 10)
+	startWatcher(t, out, &watchConfig{Addresses: []string{watched}, Mode: watchModePoll, pollInterval: 5 * time.Millisecond, Confirmations: 2})
+	waitForCalls(t, node, "eth_blockNumber", 2)
+
+	replaced := testBlock(2, Transaction{Hash: "0x22", From: watched, To: other})
+	replaced.Hash = "0xreplaced"
+	node.serveBlocks(testBlock(1), replaced, testBlock(3), testBlock(4))
+	waitForCalls(t, node, "eth_blockNumber", node.callCount("eth_blockNumber")+2)
+	select {
+	case m := <-out:
+		t.Fatalf("match %s written before its replacement block was confirmed", m.Tx.Hash)
+	default:
+	}
+
+	node.serveBlocks(testBlock(1), replaced, testBlock(3), testBlock(4), testBlock(5))
+	if m := out.next(t); m.Tx.Hash != "0x22" || m.Block.Hash != "0xreplaced" {
+		t.Errorf("confirmed match = %s in %s, want 0x22 from the replacement block", m.Tx.Hash, m.Block.Hash)
+	}
+	select {
+	case m := <-out:
+		t.Errorf("unexpected match %s", m.Tx.Hash)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestConfirmationsAt(t *testing.T) {
+	tests := []struct {
+		block string
+		head  int64
+		want  int64
+	}{
+		{block: "0x10", head: 16, want: 1},
+		{block: "0x10", head: 20, want: 5},
+		{block: "0x10", head: 10, want: 0},
+		{block: "", head: 20, want: 0},
+		{block: "pending", head: 20, want: 0},
+	}
+	for _, tt := range tests {
+		if got := confirmationsAt(tt.block, tt.head); got != tt.want {
+			t.Errorf("confirmationsAt(%q, %d) = %d, want %d", tt.block, tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestScanCountsConfirmationsFromTheHead(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}),
+	)
+
+	out := &recordingWriter{}
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{Head: 10}, out); err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, m := range out.matches {
+		got = append(got, *m.Confirmations)
+	}
+	if fmt.Sprint(got) != "[10 9]" {
+		t.Errorf("confirmations = %v, want [10 9]", got)
+	}
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&format=ndjson")
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) < 2 || lines[0]["confirmations"] != 2.0 || lines[1]["confirmations"] != 1.0 {
+		t.Errorf("lines = %v, want confirmations counted from block 2", lines)
+	}
+}
+
+func TestConfirmationBufferCountsConfirmationsAtRelease(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3), testBlock(4))
+
+	b := newConfirmationBuffer()
+	b.depth = 2
+	queued := int64(1)
+	b.WriteMatch(match{Address: watched, Block: testBlock(2), Tx: Transaction{Hash: "0x02"}, Confirmations: &queued})
+
+	out := &recordingWriter{}
+	if _, err := b.release(context.Background(), 4, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.matches) != 1 || *out.matches[0].Confirmations != 3 {
+		t.Errorf("released %+v, want 3 confirmations at release", out.matches)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// contractLogBlocks is how many blocks each eth_getLogs call covers while
+// collecting a contract's events, since providers refuse wide ranges.
+const contractLogBlocks = 10000
+
+// contractMaxBlocks, set with -contract-max-blocks, is the longest range
+// from creation block to endBlock /contract-activity will collect.
+var contractMaxBlocks int64 = 1000000
+
+// contractInlineBlocks is the longest range collected while the request
+// waits; longer ones run as a job.
+var contractInlineBlocks int64 = 10000
+
+var errNotContract = errors.New("address has no code")
+
+const (
+	contractCreation    = "creation"
+	contractTransaction = "transaction"
+	contractEvent       = "event"
+)
+
+// contractActivity is a contract's timeline from the block it was created
+// in up to LatestBlock, the chain head or the endBlock asked for.
+type contractActivity struct {
+	Address       string `json:"address"`
+	CreationBlock int64  `json:"creationBlock"`
+	Creator       string `json:"creator,omitempty"`
+	LatestBlock   int64  `json:"latestBlock"`
+
+	Timeline     []contractEntry `json:"timeline"`
+	FailedBlocks []int64         `json:"failedBlocks"`
+}
+
+// contractEntry is one transaction in the timeline: the creation, a
+// transaction sent to the contract, or, as an event, a transaction that
+// only reached it through another contract and is seen by its logs.
+type contractEntry struct {
+	Kind             string       `json:"kind"`
+	BlockNumber      int64        `json:"blockNumber"`
+	TransactionHash  string       `json:"transactionHash,omitempty"`
+	TransactionIndex string       `json:"transactionIndex,omitempty"`
+	Transaction      *Transaction `json:"transaction,omitempty"`
+	Logs             []Log        `json:"logs,omitempty"`
+}
+
+func hasCodeAt(ctx context.Context, address string, block int64) (bool, error) {
+	code, err := getCodeAt(ctx, address, fmt.Sprintf("0x%x", block))
+	return len(code) > 2, err
+}
+
+// findCreationBlock returns the first block at which address has code. A
+// hint is checked with two lookups and the search runs only when it is
+// wrong. The search assumes the code, once deployed, stays; a contract
+// that self-destructed and was deployed again is found at its last
+// deployment or not at all.
+func findCreationBlock(ctx context.Context, address string, hint, latest int64) (int64, error) {
+	if hint > 0 && hint <= latest {
+		deployed, err := hasCodeAt(ctx, address, hint)
+		if err != nil {
+			return 0, err
+		}
+		before, err := hasCodeAt(ctx, address, hint-1)
+		if err != nil {
+			return 0, err
+		}
+		if deployed && !before {
+			return hint, nil
+		}
+		log.Printf("Block %d is not where %s was created, searching instead", hint, address)
+	}
+
+	lo, hi := int64(0), latest
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		deployed, err := hasCodeAt(ctx, address, mid)
+		if err != nil {
+			return 0, err
+		}
+		if deployed {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// creationEntry finds the transaction that deployed address in block. A
+// contract deployed by another contract has no such transaction; its entry
+// then holds only the block.
+func creationEntry(ctx context.Context, address string, block int64) (contractEntry, error) {
+	entry := contractEntry{Kind: contractCreation, BlockNumber: block}
+	receipts, err := rangeReceipts(ctx, block, block)
+	if err != nil {
+		return entry, err
+	}
+	for _, receipt := range receipts {
+		if !strings.EqualFold(receipt.ContractAddress, address) {
+			continue
+		}
+		entry.TransactionHash = receipt.TransactionHash
+		entry.TransactionIndex = receipt.TransactionIndex
+		entry.Logs = receipt.Logs
+		tx, err := getTransactionByHash(ctx, receipt.TransactionHash)
+		if err != nil {
+			return entry, err
+		}
+		entry.Transaction = tx
+		break
+	}
+	return entry, nil
+}
+
+func contractLogs(ctx context.Context, address string, from, to int64) ([]Log, error) {
+	var logs []Log
+	for start := from; start <= to; start += contractLogBlocks {
+		filter := logFilter{Addresses: []string{address}, FromBlock: start, ToBlock: min(start+contractLogBlocks-1, to)}
+		chunk, err := getLogsWithFallback(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, chunk...)
+	}
+	return logs, nil
+}
+
+// locateContract starts the activity of address up to endBlock, or the
+// latest block when endBlock is zero: it checks address has code there and
+// finds the block it was created in. The timeline is left for collect.
+func locateContract(ctx context.Context, address string, hint, endBlock int64) (contractActivity, error) {
+	latest, err := getLatestBlockNumber()
+	if err != nil {
+		return contractActivity{}, err
+	}
+	if endBlock > 0 {
+		latest = min(endBlock, latest)
+	}
+	activity := contractActivity{Address: address, LatestBlock: latest, Timeline: []contractEntry{}, FailedBlocks: []int64{}}
+
+	deployed, err := hasCodeAt(ctx, address, latest)
+	if err != nil {
+		return activity, err
+	}
+	if !deployed {
+		return activity, errNotContract
+	}
+	activity.CreationBlock, err = findCreationBlock(ctx, address, hint, latest)
+	return activity, err
+}
+
+// blocks is how many blocks collect covers.
+func (a *contractActivity) blocks() int64 {
+	return a.LatestBlock - a.CreationBlock + 1
+}
+
+// collect fills in the timeline from the creation block to LatestBlock.
+func (a *contractActivity) collect(ctx context.Context, opts scanOptions) (scanSummary, error) {
+	creation, err := creationEntry(ctx, a.Address, a.CreationBlock)
+	if err != nil {
+		return scanSummary{FailedBlocks: []int64{}}, err
+	}
+	if creation.Transaction != nil {
+		a.Creator = creation.Transaction.From
+	}
+	entries := map[string]*contractEntry{}
+	if creation.TransactionHash != "" {
+		entries[creation.TransactionHash] = &creation
+	} else {
+		a.Timeline = append(a.Timeline, creation)
+	}
+
+	opts.Head = a.LatestBlock
+	calls, summary, err := contractCalls(ctx, a.Address, a.CreationBlock, a.LatestBlock, opts)
+	if err != nil {
+		return summary, err
+	}
+	a.FailedBlocks = summary.FailedBlocks
+	for _, tx := range calls {
+		if _, ok := entries[tx.Hash]; ok {
+			continue
+		}
+		block, err := parseQuantity(tx.BlockNumber)
+		if err != nil {
+			continue
+		}
+		entries[tx.Hash] = &contractEntry{Kind: contractTransaction, BlockNumber: block.Int64(), TransactionHash: tx.Hash, TransactionIndex: tx.TransactionIndex, Transaction: &tx}
+	}
+
+	logs, err := contractLogs(ctx, a.Address, a.CreationBlock, a.LatestBlock)
+	if err != nil {
+		return summary, err
+	}
+	for _, l := range logs {
+		entry, ok := entries[l.TransactionHash]
+		if !ok {
+			block, err := parseQuantity(l.BlockNumber)
+			if err != nil {
+				continue
+			}
+			entry = &contractEntry{Kind: contractEvent, BlockNumber: block.Int64(), TransactionHash: l.TransactionHash, TransactionIndex: l.TransactionIndex}
+			entries[l.TransactionHash] = entry
+		}
+		if entry.Kind != contractCreation {
+			entry.Logs = append(entry.Logs, l)
+		}
+	}
+
+	for _, entry := range entries {
+		a.Timeline = append(a.Timeline, *entry)
+	}
+	sort.SliceStable(a.Timeline, func(i, j int) bool {
+		x, y := a.Timeline[i], a.Timeline[j]
+		if x.BlockNumber != y.BlockNumber {
+			return x.BlockNumber < y.BlockNumber
+		}
+		return transactionPosition(x.TransactionIndex).Cmp(transactionPosition(y.TransactionIndex)) < 0
+	})
+	return summary, nil
+}
+
+// contractCalls returns the transactions sent straight to address from
+// block from to block to. trace_filter finds them without fetching every
+// block; an endpoint without it gets the block scan instead.
+func contractCalls(ctx context.Context, address string, from, to int64, opts scanOptions) ([]Transaction, scanSummary, error) {
+	calls, err := contractCallsByTraceFilter(ctx, address, from, to, opts)
+	if err == nil {
+		return calls, scanSummary{BlocksScanned: to - from + 1, FailedBlocks: []int64{}}, nil
+	}
+	if !isMethodUnsupported(err) {
+		return nil, scanSummary{FailedBlocks: []int64{}}, err
+	}
+	log.Printf("Endpoint does not support trace_filter, scanning blocks for calls to %s: %v", address, err)
+
+	opts.Filter = func(tx Transaction) bool { return strings.EqualFold(tx.To, address) }
+	collector := &matchCollector{}
+	summary, err := fetchTransactions(ctx, []string{address}, from, to, opts, collector)
+	for _, m := range collector.matches {
+		calls = append(calls, m.Tx)
+	}
+	return calls, summary, err
+}
+
+// contractCallsByTraceFilter keeps the top-level calls among the traces
+// sent to address. The transactions carry only what a trace has: no gas,
+// nonce or block hash.
+func contractCallsByTraceFilter(ctx context.Context, address string, from, to int64, opts scanOptions) ([]Transaction, error) {
+	var calls []Transaction
+	for start := from; start <= to; start += traceFilterChunk {
+		end := min(start+traceFilterChunk-1, to)
+		traces, err := traceFilter(ctx, start, end, "toAddress", []string{address})
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range traces {
+			if trace.Type != "call" || len(trace.TraceAddress) != 0 || !strings.EqualFold(trace.Action.To, address) {
+				continue
+			}
+			calls = append(calls, Transaction{
+				Hash:        trace.TransactionHash,
+				From:        trace.Action.From,
+				To:          trace.Action.To,
+				Value:       trace.Action.Value,
+				Input:       trace.Action.Input,
+				BlockNumber: fmt.Sprintf("0x%x", trace.BlockNumber),
+
+				TransactionIndex: fmt.Sprintf("0x%x", trace.TransactionPosition),
+			})
+		}
+		if opts.Stats != nil {
+			opts.Stats.Blocks.Add(end - start + 1)
+		}
+	}
+	return calls, nil
+}
+
+// transactionPosition sorts an entry without a transaction, a creation by
+// another contract, first in its block.
+func transactionPosition(index string) *big.Int {
+	position, err := parseQuantity(index)
+	if index == "" || err != nil {
+		return big.NewInt(-1)
+	}
+	return position
+}
+
+func contractActivityHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("address")))
+	if address == "" {
+		http.Error(w, "Please provide an address parameter", http.StatusBadRequest)
+		return
+	}
+
+	var hint int64
+	if param := r.URL.Query().Get("creationBlock"); param != "" {
+		var err error
+		hint, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || hint < 1 {
+			http.Error(w, "Invalid creationBlock parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	var endBlock int64
+	if param := r.URL.Query().Get("endBlock"); param != "" {
+		var err error
+		endBlock, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || endBlock < 1 || endBlock < hint {
+			http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	maxBlocks := contractMaxBlocks
+	if param := r.URL.Query().Get("maxBlocks"); param != "" {
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid maxBlocks parameter", http.StatusBadRequest)
+			return
+		}
+		maxBlocks = min(limit, maxBlocks)
+	}
+	opts := scanOptions{Retries: defaultBlockRetries}
+	if param := r.URL.Query().Get("concurrency"); param != "" {
+		var err error
+		opts.Concurrency, err = strconv.Atoi(param)
+		if err != nil || opts.Concurrency < 1 {
+			http.Error(w, "Invalid concurrency parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if !allowScan(w, r) {
+		return
+	}
+
+	activity, err := locateContract(r.Context(), address, hint, endBlock)
+	switch {
+	case err == errNotContract:
+		http.Error(w, fmt.Sprintf("%s has no code at block %d", address, activity.LatestBlock), http.StatusNotFound)
+		return
+	case isMissingState(err):
+		http.Error(w, "The endpoint has no state for these blocks; finding the creation block needs an archive node: "+err.Error(), http.StatusBadGateway)
+		return
+	case err != nil:
+		http.Error(w, "Error collecting contract activity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if activity.blocks() > maxBlocks {
+		http.Error(w, fmt.Sprintf("Range too large, %d blocks from creation block %d; at most %d, pass an earlier endBlock", activity.blocks(), activity.CreationBlock, maxBlocks), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if activity.blocks() > contractInlineBlocks {
+		j := jobs.start(scanRequest{Addresses: []string{address}, StartBlock: activity.CreationBlock, EndBlock: activity.LatestBlock})
+		opts.Stats = &j.stats
+		go func() {
+			summary, err := activity.collect(context.Background(), opts)
+			if err != nil {
+				log.Printf("Error collecting contract activity for %s: %v", address, err)
+			}
+			j.finishWith(activity, summary, err)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j.status())
+		return
+	}
+
+	if _, err := activity.collect(r.Context(), opts); err != nil {
+		http.Error(w, "Error collecting contract activity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(activity)
+}
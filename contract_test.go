@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const contract = "0x00000000000000000000000000000000000000cc"
+
+// serveContractChain serves a chain where contract is deployed by 0x03 in
+// block 3, called directly by 0x51 and 0x52 in block 5 and reached through
+// a router by 0x06 in block 6.
+func serveContractChain(node *fakeNode) {
+	deploy := Transaction{Hash: "0x03", From: watched, Input: "0x6080"}
+	node.serveBlocks(
+		testBlock(1), testBlock(2),
+		testBlock(3, deploy),
+		testBlock(4, Transaction{Hash: "0x04", From: other, To: watched}),
+		testBlock(5, Transaction{Hash: "0x51", From: other, To: contract}, Transaction{Hash: "0x52", From: watched, To: contract}),
+		testBlock(6, Transaction{Hash: "0x06", From: other, To: "0xdd"}),
+		testBlock(7), testBlock(8),
+	)
+	node.handle("eth_getCode", func(params []interface{}) (interface{}, error) {
+		block, _ := strconv.ParseInt(params[1].(string)[2:], 16, 64)
+		if params[0] == contract && block >= 3 {
+			return "0x6080", nil
+		}
+		return "0x", nil
+	})
+
+	creationLog := Log{Address: contract, BlockNumber: "0x3", TransactionHash: "0x03", TransactionIndex: "0x0", Topics: []string{fmt.Sprintf("0x%064x", 1)}}
+	node.handle("eth_getBlockReceipts", func(params []interface{}) (interface{}, error) {
+		if params[0] == "0x3" {
+			return []*TransactionReceipt{{TransactionHash: "0x03", TransactionIndex: "0x0", ContractAddress: contract, Logs: []Log{creationLog}}}, nil
+		}
+		return []*TransactionReceipt{}, nil
+	})
+	deploy.BlockNumber = "0x3"
+	node.result("eth_getTransactionByHash", deploy)
+	logs := []Log{
+		creationLog,
+		{Address: contract, BlockNumber: "0x5", TransactionHash: "0x52", TransactionIndex: "0x1", LogIndex: "0x0"},
+		{Address: contract, BlockNumber: "0x6", TransactionHash: "0x06", TransactionIndex: "0x0", LogIndex: "0x3"},
+	}
+	node.handle("eth_getLogs", func(params []interface{}) (interface{}, error) {
+		filter := params[0].(map[string]interface{})
+		from, _ := parseQuantity(filter["fromBlock"].(string))
+		to, _ := parseQuantity(filter["toBlock"].(string))
+		found := []Log{}
+		for _, l := range logs {
+			if block, _ := parseQuantity(l.BlockNumber); block.Cmp(from) >= 0 && block.Cmp(to) <= 0 {
+				found = append(found, l)
+			}
+		}
+		return found, nil
+	})
+}
+
+// contractTimeline is the timeline as kind@block:hash/logs entries.
+func contractTimeline(activity contractActivity) string {
+	var got []string
+	for _, entry := range activity.Timeline {
+		got = append(got, fmt.Sprintf("%s@%d:%s/%d", entry.Kind, entry.BlockNumber, entry.TransactionHash, len(entry.Logs)))
+	}
+	return fmt.Sprint(got)
+}
+
+func TestContractActivityTimeline(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+
+	activity, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if activity.CreationBlock != 3 || activity.Creator != watched || activity.LatestBlock != 8 || len(activity.FailedBlocks) != 0 {
+		t.Errorf("activity = %+v", activity)
+	}
+
+	want := "[creation@3:0x03/1 transaction@5:0x51/0 transaction@5:0x52/1 event@6:0x06/1]"
+	if got := contractTimeline(activity); got != want {
+		t.Errorf("timeline = %v, want %s", got, want)
+	}
+	if creation := activity.Timeline[0]; creation.Transaction == nil || creation.Transaction.Hash != "0x03" {
+		t.Errorf("creation entry = %+v, want the deploying transaction", creation)
+	}
+	if event := activity.Timeline[3]; event.Transaction != nil {
+		t.Errorf("event entry carries transaction %+v", event.Transaction)
+	}
+}
+
+func TestFindCreationBlockUsesHint(t *testing.T) {
+	tests := []struct {
+		name  string
+		hint  string
+		calls int
+	}{
+		// One lookup at the latest block, then two for the hint.
+		{name: "right hint", hint: "&creationBlock=3", calls: 3},
+		{name: "wrong hint", hint: "&creationBlock=5", calls: 6},
+		{name: "no hint", calls: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(t)
+			serveContractChain(node)
+
+			activity, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract+tt.hint)
+			if rec.Code != http.StatusOK || activity.CreationBlock != 3 {
+				t.Fatalf("status = %d, creation block %d, want 3", rec.Code, activity.CreationBlock)
+			}
+			if calls := node.callCount("eth_getCode"); calls != tt.calls {
+				t.Errorf("eth_getCode called %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestContractActivityErrors(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{query: "", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&creationBlock=0", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&concurrency=0", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&endBlock=0", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&creationBlock=5&endBlock=4", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&maxBlocks=0", code: http.StatusBadRequest},
+		{query: "address=" + contract + "&endBlock=2", code: http.StatusNotFound},
+		{query: "address=" + watched, code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if _, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?"+tt.query); rec.Code != tt.code {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.code)
+		}
+	}
+
+	node.handle("eth_getCode", func(params []interface{}) (interface{}, error) {
+		if params[1] == "0x8" {
+			return "0x6080", nil
+		}
+		return nil, &rpcError{Code: -32000, Message: "missing trie node abc"}
+	})
+	if _, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract); rec.Code != http.StatusBadGateway {
+		t.Errorf("pruned node: status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestContractActivityEndBlock(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+
+	activity, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract+"&endBlock=5")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	want := "[creation@3:0x03/1 transaction@5:0x51/0 transaction@5:0x52/1]"
+	if got := contractTimeline(activity); activity.LatestBlock != 5 || got != want {
+		t.Errorf("latest block %d, timeline = %v, want 5 and %s", activity.LatestBlock, got, want)
+	}
+}
+
+func TestContractActivityRejectsLongRanges(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+
+	// Blocks 3 to 8 are six blocks.
+	if _, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract+"&maxBlocks=5"); rec.Code != http.StatusBadRequest {
+		t.Errorf("maxBlocks=5: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if calls := node.callCount("eth_getBlockByNumber"); calls != 0 {
+		t.Errorf("eth_getBlockByNumber called %d times for a refused range", calls)
+	}
+	if _, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract+"&maxBlocks=5&endBlock=7"); rec.Code != http.StatusOK {
+		t.Errorf("maxBlocks=5&endBlock=7: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	previous := contractMaxBlocks
+	contractMaxBlocks = 5
+	t.Cleanup(func() { contractMaxBlocks = previous })
+	if _, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract+"&maxBlocks=100"); rec.Code != http.StatusBadRequest {
+		t.Errorf("maxBlocks above -contract-max-blocks: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestContractActivityPrefersTraceFilter(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+	serveTraceFilter(node, []blockTrace{
+		transferTrace(5, 0, "0x51", other, contract, "0x0"),
+		transferTrace(5, 1, "0x52", watched, contract, "0x1"),
+		// Reached through a router: an event, not a transaction.
+		transferTrace(6, 0, "0x06", "0xdd", contract, "0x0", 0),
+	})
+
+	activity, rec := getJSON[contractActivity](t, contractActivityHandler, "/contract-activity?address="+contract)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	want := "[creation@3:0x03/1 transaction@5:0x51/0 transaction@5:0x52/1 event@6:0x06/1]"
+	if got := contractTimeline(activity); got != want {
+		t.Errorf("timeline = %v, want %s", got, want)
+	}
+	if tx := activity.Timeline[2].Transaction; tx == nil || tx.From != watched || tx.Value != "0x1" || tx.TransactionIndex != "0x1" {
+		t.Errorf("transaction from trace = %+v", tx)
+	}
+	if calls := node.callCount("eth_getBlockByNumber"); calls != 0 {
+		t.Errorf("eth_getBlockByNumber called %d times, want none with trace_filter", calls)
+	}
+}
+
+func TestContractActivityRunsLongRangesAsJobs(t *testing.T) {
+	node := newFakeNode(t)
+	serveContractChain(node)
+	previous := contractInlineBlocks
+	contractInlineBlocks = 3
+	t.Cleanup(func() { contractInlineBlocks = previous })
+
+	rec := httptest.NewRecorder()
+	contractActivityHandler(rec, httptest.NewRequest(http.MethodGet, "/contract-activity?address="+contract, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	var status jobStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.StartBlock != 3 || status.EndBlock != 8 {
+		t.Errorf("job covers %d-%d, want 3-8", status.StartBlock, status.EndBlock)
+	}
+
+	j, ok := jobs.get(status.ID)
+	if !ok {
+		t.Fatalf("job %s not registered", status.ID)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for status = j.status(); status.State == jobRunning && time.Now().Before(deadline); status = j.status() {
+		time.Sleep(time.Millisecond)
+	}
+	if status.State != jobCompleted {
+		t.Fatalf("job state = %s: %s", status.State, status.Error)
+	}
+	activity, _ := status.Result.(contractActivity)
+	want := "[creation@3:0x03/1 transaction@5:0x51/0 transaction@5:0x52/1 event@6:0x06/1]"
+	if got := contractTimeline(activity); got != want {
+		t.Errorf("job result timeline = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import "sort"
+
+type counterpartyCount struct {
+	Address      string `json:"address"`
+	Transactions int    `json:"transactions"`
+}
+
+func counterpartyOf(m match) string {
+	if m.Tx.From == m.Address {
+		return m.Tx.To
+	}
+	return m.Tx.From
+}
+
+// matchesByCounterparty groups each watched address's matches by the address
+// on the other side, keeping scan order.
+func matchesByCounterparty(addresses []string, matches []match) map[string]map[string][]match {
+	grouped := make(map[string]map[string][]match, len(addresses))
+	for _, address := range addresses {
+		grouped[address] = make(map[string][]match)
+	}
+	for _, m := range matches {
+		if other := counterpartyOf(m); other != "" {
+			grouped[m.Address][other] = append(grouped[m.Address][other], m)
+		}
+	}
+	return grouped
+}
+
+// uniqueCounterparties returns, per watched address, the distinct addresses on
+// the other side of its matched transactions, busiest first. Contract
+// creations have no counterparty and are skipped.
+func uniqueCounterparties(addresses []string, matches []match) map[string][]counterpartyCount {
+	grouped := matchesByCounterparty(addresses, matches)
+
+	result := make(map[string][]counterpartyCount, len(grouped))
+	for address, byCounterparty := range grouped {
+		list := make([]counterpartyCount, 0, len(byCounterparty))
+		for other, ms := range byCounterparty {
+			list = append(list, counterpartyCount{Address: other, Transactions: len(ms)})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Transactions != list[j].Transactions {
+				return list[i].Transactions > list[j].Transactions
+			}
+			return list[i].Address < list[j].Address
+		})
+		result[address] = list
+	}
+	return result
+}
+
+const (
+	defaultWashWindow        = 10
+	defaultWashMinRoundTrips = 3
+)
+
+type backAndForthPair struct {
+	Address      string `json:"address"`
+	Counterparty string `json:"counterparty"`
+	RoundTrips   int    `json:"roundTrips"`
+	Transfers    int    `json:"transfers"`
+	FirstBlock   int64  `json:"firstBlock"`
+	LastBlock    int64  `json:"lastBlock"`
+}
+
+// backAndForthPairs flags watched addresses and counterparties that keep
+// sending value to each other, a wash-trading heuristic. A round trip is a
+// transfer answered by one in the opposite direction at most window blocks
+// later; pairs with at least minRoundTrips are reported, most active first.
+// Calls carrying no value are ignored.
+func backAndForthPairs(addresses []string, matches []match, window int64, minRoundTrips int) []backAndForthPair {
+	pairs := []backAndForthPair{}
+	for address, byCounterparty := range matchesByCounterparty(addresses, matches) {
+		for other, ms := range byCounterparty {
+			pair := backAndForthPair{Address: address, Counterparty: other}
+			var pending *match
+			var pendingBlock int64
+			for i := range ms {
+				m := &ms[i]
+				value, err := parseQuantity(m.Tx.Value)
+				block, blockErr := parseQuantity(m.Block.Number)
+				if err != nil || blockErr != nil || value.Sign() == 0 {
+					continue
+				}
+
+				if pair.Transfers == 0 {
+					pair.FirstBlock = block.Int64()
+				}
+				pair.Transfers++
+				pair.LastBlock = block.Int64()
+
+				if pending != nil && pending.Tx.From != m.Tx.From && block.Int64()-pendingBlock <= window {
+					pair.RoundTrips++
+					pending = nil
+					continue
+				}
+				pending, pendingBlock = m, block.Int64()
+			}
+			if pair.RoundTrips >= minRoundTrips {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].RoundTrips != pairs[j].RoundTrips {
+			return pairs[i].RoundTrips > pairs[j].RoundTrips
+		}
+		if pairs[i].Address != pairs[j].Address {
+			return pairs[i].Address < pairs[j].Address
+		}
+		return pairs[i].Counterparty < pairs[j].Counterparty
+	})
+	return pairs
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func counterpartyMatch(address, from, to string) match {
+	return match{Address: address, Block: testBlock(1), Tx: Transaction{From: from, To: to}}
+}
+
+func TestUniqueCounterparties(t *testing.T) {
+	matches := []match{
+		counterpartyMatch(watched, watched, "0xc2"),
+		counterpartyMatch(watched, "0xc1", watched),
+		counterpartyMatch(watched, watched, "0xc1"),
+		counterpartyMatch(watched, watched, ""),
+		counterpartyMatch(watched, watched, "0xc3"),
+	}
+
+	got := uniqueCounterparties([]string{watched, other}, matches)
+	want := map[string][]counterpartyCount{
+		watched: {
+			{Address: "0xc1", Transactions: 2},
+			{Address: "0xc2", Transactions: 1},
+			{Address: "0xc3", Transactions: 1},
+		},
+		other: {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueCounterparties = %+v, want %+v", got, want)
+	}
+}
+
+func TestUniqueCounterpartiesHandler(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1,
+		Transaction{Hash: "0x01", From: watched, To: "0xc1"},
+		Transaction{Hash: "0x02", From: "0xc1", To: watched},
+	))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&uniqueCounterparties=true")
+	want := `{"` + watched + `":[{"address":"0xc1","transactions":2}]}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("body = %s, want %s", rec.Body, want)
+	}
+}
+
+func transferMatch(block int64, from, to, value string) match {
+	return match{Address: watched, Block: testBlock(block), Tx: Transaction{From: from, To: to, Value: value}}
+}
+
+func TestBackAndForthPairs(t *testing.T) {
+	matches := []match{
+		// Three round trips with 0xc1, each answered within the window.
+		transferMatch(1, watched, "0xc1", "0x1"),
+		transferMatch(3, "0xc1", watched, "0x1"),
+		transferMatch(4, "0xc1", watched, "0x1"),
+		transferMatch(9, watched, "0xc1", "0x1"),
+		transferMatch(10, watched, "0xc1", "0x1"),
+		transferMatch(12, "0xc1", watched, "0x1"),
+		// A zero-value call doesn't count or answer.
+		transferMatch(13, "0xc1", watched, "0x0"),
+		// 0xc2 answers too late every time.
+		transferMatch(1, watched, "0xc2", "0x1"),
+		transferMatch(20, "0xc2", watched, "0x1"),
+		transferMatch(40, watched, "0xc2", "0x1"),
+		transferMatch(60, "0xc2", watched, "0x1"),
+	}
+
+	got := backAndForthPairs([]string{watched}, matches, 5, 1)
+	want := []backAndForthPair{{Address: watched, Counterparty: "0xc1", RoundTrips: 3, Transfers: 6, FirstBlock: 1, LastBlock: 12}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("window 5 = %+v, want %+v", got, want)
+	}
+
+	got = backAndForthPairs([]string{watched}, matches, 20, 2)
+	if len(got) != 2 || got[0].Counterparty != "0xc1" || got[1].Counterparty != "0xc2" || got[1].RoundTrips != 2 {
+		t.Errorf("window 20 = %+v", got)
+	}
+
+	if got := backAndForthPairs([]string{watched}, matches, 5, 4); len(got) != 0 {
+		t.Errorf("minRoundTrips 4 = %+v, want none", got)
+	}
+}
+
+func TestBackAndForthHandler(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: "0xc1", Value: "0x5"}),
+		testBlock(2, Transaction{Hash: "0x02", From: "0xc1", To: watched, Value: "0x5"}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&backAndForth=true&washMinRoundTrips=1")
+	want := `[{"address":"` + watched + `","counterparty":"0xc1","roundTrips":1,"transfers":2,"firstBlock":1,"lastBlock":2}]` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("body = %s, want %s", rec.Body, want)
+	}
+
+	for _, query := range []string{"washWindow=0", "washWindow=x", "washMinRoundTrips=0"} {
+		if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&backAndForth=true&"+query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
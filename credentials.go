@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+type rpcCredentials struct {
+	Endpoint string
+	Token    string
+}
+
+var currentCredentials atomic.Pointer[rpcCredentials]
+
+func init() {
+	currentCredentials.Store(&rpcCredentials{Endpoint: ethEndpoint})
+}
+
+func rpcEndpointCredentials() *rpcCredentials {
+	return currentCredentials.Load()
+}
+
+// loadCredentials reads the endpoint URL and auth token from mounted secret
+// files. An empty path keeps the built-in endpoint or sends no token.
+func loadCredentials(endpointFile, tokenFile string) (*rpcCredentials, error) {
+	creds := &rpcCredentials{Endpoint: ethEndpoint}
+
+	if endpointFile != "" {
+		endpoint, err := readSecretFile(endpointFile)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint == "" {
+			return nil, fmt.Errorf("endpoint file %s is empty", endpointFile)
+		}
+		creds.Endpoint = endpoint
+	}
+
+	if tokenFile != "" {
+		token, err := readSecretFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		creds.Token = token
+	}
+
+	return creds, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// reloadCredentialsOnSignal re-reads the secret files on every SIGHUP. A failed
+// reload is logged and the previous credentials stay in use.
+func reloadCredentialsOnSignal(endpointFile, tokenFile string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		creds, err := loadCredentials(endpointFile, tokenFile)
+		if err != nil {
+			log.Printf("Error reloading RPC credentials: %v", err)
+			continue
+		}
+		currentCredentials.Store(creds)
+		chainIDs.reset()
+		batchUnsupported.Store(false)
+		log.Printf("Reloaded RPC credentials")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSecret(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCredentials(t *testing.T) {
+	endpointFile := writeSecret(t, "endpoint", "https://node.example/rpc\n")
+	tokenFile := writeSecret(t, "token", "  s3cret\n")
+
+	creds, err := loadCredentials(endpointFile, tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Endpoint != "https://node.example/rpc" || creds.Token != "s3cret" {
+		t.Errorf("creds = %+v", creds)
+	}
+
+	creds, err = loadCredentials("", "")
+	if err != nil || creds.Endpoint != ethEndpoint || creds.Token != "" {
+		t.Errorf("defaults: creds = %+v, err = %v", creds, err)
+	}
+
+	if _, err := loadCredentials(writeSecret(t, "empty", "\n"), ""); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("empty endpoint file: error = %v", err)
+	}
+	if _, err := loadCredentials("", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing token file: no error")
+	}
+}
+
+func TestRequestsCarryBearerToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		http.Error(w, "stop", http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	previous := currentCredentials.Load()
+	defer currentCredentials.Store(previous)
+
+	currentCredentials.Store(&rpcCredentials{Endpoint: server.URL, Token: "s3cret"})
+	sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{})
+	if authorization != "Bearer s3cret" {
+		t.Errorf("Authorization = %q, want Bearer s3cret", authorization)
+	}
+
+	currentCredentials.Store(&rpcCredentials{Endpoint: server.URL})
+	sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{})
+	if authorization != "" {
+		t.Errorf("Authorization = %q without a token", authorization)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cursorSecret signs pagination cursors. It is random per process unless
+// -cursor-secret is given, so cursors survive restarts and work across
+// instances that share the secret.
+var cursorSecret = randomCursorSecret()
+
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// storePosition orders stored records by where they sit in the chain. Hash
+// breaks ties between records at the same position, such as trace matches
+// without a transaction index, so a page boundary never falls between them.
+type storePosition struct {
+	Block int64
+	Index int64
+	Hash  string
+}
+
+func (p storePosition) after(other storePosition) bool {
+	if p.Block != other.Block {
+		return p.Block > other.Block
+	}
+	if p.Index != other.Index {
+		return p.Index > other.Index
+	}
+	return p.Hash > other.Hash
+}
+
+func recordPosition(record matchRecord) storePosition {
+	p := storePosition{Hash: strings.ToLower(record.Hash)}
+	if block, err := parseQuantity(record.BlockNumber); err == nil {
+		p.Block = block.Int64()
+	}
+	if index, err := parseQuantity(record.TransactionIndex); err == nil {
+		p.Index = index.Int64()
+	}
+	return p
+}
+
+func cursorMAC(address, payload string) []byte {
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write([]byte(strings.ToLower(address) + "\n" + payload))
+	return mac.Sum(nil)[:16]
+}
+
+// encodeCursor returns an opaque token for the position of the last record
+// on a page. It is bound to the queried address, so it can't be reused for
+// another one.
+func encodeCursor(address string, p storePosition) string {
+	payload := fmt.Sprintf("%d.%d.%s", p.Block, p.Index, p.Hash)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(cursorMAC(address, payload))
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func decodeCursor(address, cursor string) (storePosition, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return storePosition{}, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return storePosition{}, errInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, cursorMAC(address, string(payload))) {
+		return storePosition{}, errInvalidCursor
+	}
+
+	var p storePosition
+	block, rest, _ := strings.Cut(string(payload), ".")
+	index, hash, ok := strings.Cut(rest, ".")
+	if !ok {
+		return storePosition{}, errInvalidCursor
+	}
+	if p.Block, err = strconv.ParseInt(block, 10, 64); err != nil {
+		return storePosition{}, errInvalidCursor
+	}
+	if p.Index, err = strconv.ParseInt(index, 10, 64); err != nil {
+		return storePosition{}, errInvalidCursor
+	}
+	p.Hash = hash
+	return p, nil
+}
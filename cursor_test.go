@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	position := storePosition{Block: 19000000, Index: 42, Hash: "0xabc"}
+	cursor := encodeCursor(watched, position)
+
+	got, err := decodeCursor(strings.ToUpper(watched[:2])+watched[2:], cursor)
+	if err != nil || got != position {
+		t.Errorf("decodeCursor = %+v, %v, want %+v", got, err, position)
+	}
+
+	payload, mac, _ := strings.Cut(cursor, ".")
+	otherPayload, _, _ := strings.Cut(encodeCursor(watched, storePosition{Block: 1}), ".")
+	tests := []struct {
+		name    string
+		address string
+		cursor  string
+	}{
+		{name: "other address", address: other, cursor: cursor},
+		{name: "no separator", address: watched, cursor: payload},
+		{name: "swapped payload", address: watched, cursor: otherPayload + "." + mac},
+		{name: "bad base64", address: watched, cursor: "!!!." + mac},
+	}
+	for _, tt := range tests {
+		if _, err := decodeCursor(tt.address, tt.cursor); err != errInvalidCursor {
+			t.Errorf("%s: err = %v, want errInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+// pageThrough follows nextCursor from the first page to the last.
+func pageThrough(t *testing.T, address string, limit int) ([]string, []int) {
+	t.Helper()
+	var hashes []string
+	var totals []int
+	query := fmt.Sprintf("/transactions?address=%s&limit=%d", address, limit)
+	for page := 0; page < 20; page++ {
+		rec := httptest.NewRecorder()
+		transactionsHandler(rec, httptest.NewRequest(http.MethodGet, query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var response searchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, recordHashes(response.Results)...)
+		totals = append(totals, response.Total)
+		if response.NextCursor == "" {
+			return hashes, totals
+		}
+		query = fmt.Sprintf("/transactions?address=%s&limit=%d&cursor=%s", address, limit, response.NextCursor)
+	}
+	t.Fatal("cursor never ran out")
+	return nil, nil
+}
+
+func TestTransactionsCursorPagination(t *testing.T) {
+	s := useStore(t)
+	for i, position := range [][2]string{{"0x1", "0x0"}, {"0x1", "0x1"}, {"0x2", "0x0"}, {"0x3", "0x0"}, {"0x3", "0x2"}} {
+		record := storedRecord(watched, fmt.Sprintf("0x%02d", i), watched, other)
+		record.BlockNumber, record.TransactionIndex = position[0], position[1]
+		s.Insert(record)
+	}
+
+	hashes, _ := pageThrough(t, watched, 2)
+	if got := strings.Join(hashes, " "); got != "0x00 0x01 0x02 0x03 0x04" {
+		t.Errorf("paged hashes = %s", got)
+	}
+
+	// A record arriving before the cursor's position doesn't shift the
+	// following pages, as an offset would.
+	rec := httptest.NewRecorder()
+	transactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/transactions?address="+watched+"&limit=2", nil))
+	var first searchResponse
+	json.NewDecoder(rec.Body).Decode(&first)
+	early := storedRecord(watched, "0x99", watched, other)
+	early.BlockNumber, early.TransactionIndex = "0x0", "0x0"
+	s.Insert(early)
+
+	rec = httptest.NewRecorder()
+	transactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/transactions?address="+watched+"&limit=2&cursor="+first.NextCursor, nil))
+	var second searchResponse
+	json.NewDecoder(rec.Body).Decode(&second)
+	if got := fmt.Sprint(recordHashes(second.Results)); got != "[0x02 0x03]" {
+		t.Errorf("second page after an early insert = %s", got)
+	}
+}
+
+func TestTransactionsCursorKeepsRecordsAtTheSamePosition(t *testing.T) {
+	s := useStore(t)
+	for _, hash := range []string{"0x0c", "0x0a", "0x0b"} {
+		record := storedRecord(watched, hash, watched, other)
+		record.BlockNumber, record.TransactionIndex = "0x7", ""
+		s.Insert(record)
+	}
+
+	hashes, _ := pageThrough(t, watched, 1)
+	if got := strings.Join(hashes, " "); got != "0x0a 0x0b 0x0c" {
+		t.Errorf("paged hashes = %s, want every record at block 7", got)
+	}
+}
+
+func TestTransactionsListsEachTransactionOnce(t *testing.T) {
+	s := useStore(t)
+	s.Insert(storedRecord(watched, "0x01", watched, other))
+	s.Insert(storedRecord(other, "0x01", watched, other))
+	s.Insert(storedRecord(other, "0x02", other, "0xcc"))
+
+	for _, address := range []string{watched, other} {
+		results, total := s.Transactions(address, nil, 0, 10)
+		if total != len(results) {
+			t.Errorf("%s: total = %d for %d results", address, total, len(results))
+		}
+		if len(results) == 0 || results[0].Hash != "0x01" || results[0].MatchedAddress != address {
+			t.Errorf("%s: first result = %+v, want 0x01 matched for it", address, results)
+		}
+	}
+	if results, _ := s.Transactions(watched, nil, 0, 10); len(results) != 1 {
+		t.Errorf("%s: got %v, want 0x01 once", watched, recordHashes(results))
+	}
+	if results, _ := s.Transactions(other, nil, 0, 10); len(results) != 2 {
+		t.Errorf("%s: got %v, want 0x01 and 0x02", other, recordHashes(results))
+	}
+
+	hashes, totals := pageThrough(t, watched, 1)
+	if fmt.Sprint(hashes) != "[0x01]" || totals[0] != 1 {
+		t.Errorf("paged = %v, totals %v", hashes, totals)
+	}
+}
+
+func TestTransactionsRejectsBadCursor(t *testing.T) {
+	useStore(t)
+	cursor := encodeCursor(watched, storePosition{Block: 1})
+	for _, query := range []string{
+		"address=" + watched + "&cursor=garbage",
+		"address=" + other + "&cursor=" + cursor,
+		"address=" + watched + "&cursor=" + cursor + "&offset=1",
+	} {
+		rec := httptest.NewRecorder()
+		transactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/transactions?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
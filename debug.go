@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var debugMethods = map[string]bool{
+	"eth_blockNumber":    true,
+	"eth_chainId":        true,
+	"net_version":        true,
+	"web3_clientVersion": true,
+}
+
+// maxLoggedBody caps how much of a response body ends up in logs, errors
+// and /debug/endpoint, set with -max-logged-body. Zero means no limit.
+var maxLoggedBody = 1024
+
+// readBodyForLog reads body for logging, keeping at most maxLoggedBody bytes
+// and noting the full size when it cuts. The rest is drained, not kept.
+func readBodyForLog(body io.Reader) (string, error) {
+	if maxLoggedBody <= 0 {
+		contents, err := io.ReadAll(body)
+		return string(contents), err
+	}
+
+	contents, err := io.ReadAll(io.LimitReader(body, int64(maxLoggedBody)+1))
+	if err != nil || len(contents) <= maxLoggedBody {
+		return string(contents), err
+	}
+	rest, err := io.Copy(io.Discard, body)
+	return fmt.Sprintf("%s... (truncated, %d bytes total)", contents[:maxLoggedBody], int64(len(contents))+rest), err
+}
+
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Www-Authenticate":    true,
+}
+
+func isSensitiveHeader(name string) bool {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, hint := range []string{"token", "secret", "key", "session", "auth"} {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+type endpointDebugResponse struct {
+	Method  string              `json:"method"`
+	Status  int                 `json:"status"`
+	Proto   string              `json:"proto"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+}
+
+// debugEndpointHandler makes one harmless RPC call and shows what the
+// endpoint sent back (status, headers and body) to help diagnose rate
+// limiting and caching. Credential-like headers are never echoed.
+func debugEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = "eth_blockNumber"
+	}
+	if !debugMethods[method] {
+		http.Error(w, "Invalid method parameter", http.StatusBadRequest)
+		return
+	}
+
+	req, _, err := newRPCHTTPRequest(r.Context(), method, []interface{}{})
+	if err != nil {
+		http.Error(w, "Error building request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := rateLimitedDo(r.Context(), req)
+	if err != nil {
+		http.Error(w, "Error calling endpoint: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := readBodyForLog(resp.Body)
+	if err != nil {
+		http.Error(w, "Error reading endpoint response: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	headers := make(map[string][]string)
+	for name, values := range resp.Header {
+		if !isSensitiveHeader(name) {
+			headers[name] = values
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpointDebugResponse{
+		Method:  method,
+		Status:  resp.StatusCode,
+		Proto:   resp.Proto,
+		Headers: headers,
+		Body:    body,
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type countingLimiter struct {
+	waits atomic.Int64
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits.Add(1)
+	return ctx.Err()
+}
+
+func TestDebugEndpointHidesSensitiveHeaders(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_blockNumber", "0x10")
+	node.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining", "99")
+		w.Header().Set("X-Api-Key", "leaked")
+		w.Header().Set("Set-Cookie", "session=1")
+		node.serveHTTP(w, r)
+	})
+
+	limiter := &countingLimiter{}
+	rpcLimiter = limiter
+	defer func() { rpcLimiter = nil }()
+
+	rec := httptest.NewRecorder()
+	debugEndpointHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/endpoint", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var debug endpointDebugResponse
+	if err := json.NewDecoder(rec.Body).Decode(&debug); err != nil {
+		t.Fatal(err)
+	}
+	if debug.Method != "eth_blockNumber" || debug.Status != http.StatusOK || !strings.Contains(debug.Body, `"0x10"`) {
+		t.Errorf("debug = %+v", debug)
+	}
+	if _, ok := debug.Headers["X-Ratelimit-Remaining"]; !ok {
+		t.Error("rate limit header missing")
+	}
+	for _, name := range []string{"X-Api-Key", "Set-Cookie"} {
+		if _, ok := debug.Headers[name]; ok {
+			t.Errorf("sensitive header %s echoed", name)
+		}
+	}
+	if limiter.waits.Load() != 1 {
+		t.Errorf("rate limiter waited %d times, want 1", limiter.waits.Load())
+	}
+}
+
+func TestDebugEndpointRejectsOtherMethods(t *testing.T) {
+	rec := httptest.NewRecorder()
+	debugEndpointHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/endpoint?method=eth_sendRawTransaction", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestReadBodyForLog(t *testing.T) {
+	previous := maxLoggedBody
+	defer func() { maxLoggedBody = previous }()
+
+	tests := []struct {
+		limit int
+		body  string
+		want  string
+	}{
+		{limit: 8, body: "short", want: "short"},
+		{limit: 8, body: "exactly8", want: "exactly8"},
+		{limit: 8, body: "<html>502 Bad Gateway</html>", want: "<html>50... (truncated, 28 bytes total)"},
+		{limit: 0, body: strings.Repeat("x", 5000), want: strings.Repeat("x", 5000)},
+	}
+	for _, tt := range tests {
+		maxLoggedBody = tt.limit
+		reader := strings.NewReader(tt.body)
+		got, err := readBodyForLog(reader)
+		if err != nil || got != tt.want {
+			t.Errorf("limit %d: readBodyForLog(%q) = %q, %v, want %q", tt.limit, tt.body, got, err, tt.want)
+		}
+		if reader.Len() != 0 {
+			t.Errorf("limit %d: %d bytes left unread", tt.limit, reader.Len())
+		}
+	}
+}
+
+func TestNonJSONResponseErrorIsTruncated(t *testing.T) {
+	node := newFakeNode(t)
+	node.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>" + strings.Repeat("error page ", 500) + "</html>"))
+	})
+
+	_, err := sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{})
+	if err == nil || !strings.HasPrefix(err.Error(), "received non-JSON response: <html>error page") {
+		t.Fatalf("error = %v", err)
+	}
+	if want := "... (truncated, 5513 bytes total)"; !strings.HasSuffix(err.Error(), want) || len(err.Error()) > maxLoggedBody+100 {
+		t.Errorf("error is %d bytes, want the body cut to %d and ending %q", len(err.Error()), maxLoggedBody, want)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+type scanDiff struct {
+	Previous int           `json:"previous"`
+	Scanned  int           `json:"scanned"`
+	New      []matchRecord `json:"new"`
+}
+
+// storedHashes returns the hashes of every stored transaction touching
+// any of addresses, lowercased.
+func storedHashes(addresses []string) map[string]bool {
+	hashes := make(map[string]bool)
+	for _, address := range addresses {
+		records, _ := store.Transactions(address, nil, 0, math.MaxInt)
+		for _, record := range records {
+			hashes[strings.ToLower(record.Hash)] = true
+		}
+	}
+	return hashes
+}
+
+// diffMatches returns the matches whose transactions are not in previous,
+// once per hash and in scan order, along with how many distinct
+// transactions the scan found.
+func diffMatches(previous map[string]bool, matches []match) ([]matchRecord, int) {
+	added := []matchRecord{}
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		hash := strings.ToLower(m.Tx.Hash)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if !previous[hash] {
+			added = append(added, newMatchRecord(m))
+		}
+	}
+	return added, len(seen)
+}
+
+// diffHandler rescans a range and reports the transactions the store
+// doesn't hold yet. The store is read before the scan, so store=true keeps
+// it up to date for the next diff.
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	scan, ok := parseScanRequest(w, r)
+	if !ok {
+		return
+	}
+
+	previous := storedHashes(scan.Addresses)
+	collector := &matchCollector{}
+	if !scan.checkWriter(w, collector) {
+		return
+	}
+	if _, err := scan.run(r.Context(), collector); err != nil {
+		log.Printf("Error scanning %s for diff: %v", scan.addressList(), err)
+		http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	added, scanned := diffMatches(previous, collector.matches)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanDiff{Previous: len(previous), Scanned: scanned, New: added})
+}
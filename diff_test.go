@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getDiff(t *testing.T, query string) scanDiff {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	diffHandler(rec, httptest.NewRequest(http.MethodGet, "/diff?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var diff scanDiff
+	if err := json.NewDecoder(rec.Body).Decode(&diff); err != nil {
+		t.Fatal(err)
+	}
+	return diff
+}
+
+func TestDiffHandlerReportsNewTransactions(t *testing.T) {
+	s := useStore(t)
+	s.Insert(storedRecord(watched, "0xAA01", watched, other))
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0xaa01", From: watched, To: other}),
+		testBlock(2, Transaction{Hash: "0xaa02", From: other, To: watched}),
+		testBlock(3, Transaction{Hash: "0xaa03", From: watched, To: other}),
+	)
+
+	diff := getDiff(t, "address="+watched+","+other+"&startBlock=1&endBlock=3&store=true")
+	if diff.Previous != 1 || diff.Scanned != 3 {
+		t.Errorf("previous = %d, scanned = %d, want 1 and 3", diff.Previous, diff.Scanned)
+	}
+	if got := fmt.Sprint(recordHashes(diff.New)); got != "[0xaa02 0xaa03]" {
+		t.Errorf("new = %s, want each unseen transaction once", got)
+	}
+
+	diff = getDiff(t, "address="+watched+"&startBlock=1&endBlock=3")
+	if diff.Previous != 3 || len(diff.New) != 0 {
+		t.Errorf("second diff = %+v, want the stored scan to leave nothing new", diff)
+	}
+}
+
+func TestDiffHandlerRejectsBadRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	diffHandler(rec, httptest.NewRequest(http.MethodGet, "/diff?startBlock=1&endBlock=2", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
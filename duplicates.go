@@ -0,0 +1,26 @@
+package main
+
+import "log"
+
+// duplicateDetector flags a transaction hash emitted more than once for the
+// same watched address in a single scan, which points at a reorg or an
+// ordering bug rather than anything a caller asked for.
+type duplicateDetector struct {
+	seen map[string]string
+}
+
+func newDuplicateDetector() *duplicateDetector {
+	return &duplicateDetector{seen: make(map[string]string)}
+}
+
+func (d *duplicateDetector) check(address, hash, blockNumber string) bool {
+	key := address + "/" + hash
+	firstBlock, ok := d.seen[key]
+	if !ok {
+		d.seen[key] = blockNumber
+		return false
+	}
+
+	log.Printf("Warning: duplicate transaction %s for %s emitted in block %s and block %s", hash, address, firstBlock, blockNumber)
+	return true
+}
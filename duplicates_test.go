@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestDuplicateDetector(t *testing.T) {
+	d := newDuplicateDetector()
+
+	if d.check(watched, "0x01", "0x1") {
+		t.Error("first sighting reported as a duplicate")
+	}
+	if d.check(other, "0x01", "0x1") {
+		t.Error("same hash for another address reported as a duplicate")
+	}
+	if !d.check(watched, "0x01", "0x2") {
+		t.Error("second sighting for the same address not reported")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "sync"
+
+type blockResult struct {
+	number          int64
+	block           *BlockWithTransactions
+	inspected       int
+	traces          []blockTrace
+	receipts        map[string]*TransactionReceipt
+	codeSizes       map[string]int
+	rawTransactions map[string]string
+	err             error
+}
+
+// orderedEmitter releases block results strictly in block order while
+// fetches complete out of order. At most maxPending out-of-order results are
+// held; submitters of further blocks wait until the gap fills.
+type orderedEmitter struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	next       int64
+	pending    map[int64]*blockResult
+	maxPending int
+	emit       func(*blockResult)
+}
+
+func newOrderedEmitter(first int64, maxPending int, emit func(*blockResult)) *orderedEmitter {
+	if maxPending < 1 {
+		maxPending = 1
+	}
+	e := &orderedEmitter{
+		next:       first,
+		pending:    make(map[int64]*blockResult),
+		maxPending: maxPending,
+		emit:       emit,
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+func (e *orderedEmitter) Submit(result *blockResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for result.number != e.next && len(e.pending) >= e.maxPending {
+		e.cond.Wait()
+	}
+
+	if result.number != e.next {
+		e.pending[result.number] = result
+		return
+	}
+
+	e.emit(result)
+	e.next++
+	for {
+		queued, ok := e.pending[e.next]
+		if !ok {
+			break
+		}
+		delete(e.pending, e.next)
+		e.emit(queued)
+		e.next++
+	}
+	e.cond.Broadcast()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrderedEmitterKeepsBlockOrder(t *testing.T) {
+	const first, count, maxPending = 100, 50, 4
+
+	var emitted []int64
+	var e *orderedEmitter
+	maxSeen := 0
+	e = newOrderedEmitter(first, maxPending, func(result *blockResult) {
+		emitted = append(emitted, result.number)
+		if len(e.pending) > maxSeen {
+			maxSeen = len(e.pending)
+		}
+	})
+
+	order := rand.New(rand.NewSource(1)).Perm(count)
+	var wg sync.WaitGroup
+	for _, offset := range order {
+		wg.Add(1)
+		go func(number int64) {
+			defer wg.Done()
+			e.Submit(&blockResult{number: number})
+		}(first + int64(offset))
+	}
+	wg.Wait()
+
+	if len(emitted) != count {
+		t.Fatalf("emitted %d results, want %d", len(emitted), count)
+	}
+	for i, number := range emitted {
+		if number != first+int64(i) {
+			t.Fatalf("emitted[%d] = %d, want %d", i, number, first+int64(i))
+		}
+	}
+	if maxSeen > maxPending {
+		t.Errorf("held %d out-of-order results, want at most %d", maxSeen, maxPending)
+	}
+}
+
+func TestOrderedEmitterBlocksWhenBufferFull(t *testing.T) {
+	var emitted []int64
+	e := newOrderedEmitter(1, 2, func(result *blockResult) {
+		emitted = append(emitted, result.number)
+	})
+
+	e.Submit(&blockResult{number: 3})
+	e.Submit(&blockResult{number: 2})
+
+	done := make(chan struct{})
+	go func() {
+		e.Submit(&blockResult{number: 4})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Submit of block 4 returned while the buffer was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	e.Submit(&blockResult{number: 1})
+	<-done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	want := []int64{1, 2, 3, 4}
+	if len(emitted) != len(want) {
+		t.Fatalf("emitted = %v, want %v", emitted, want)
+	}
+	for i := range want {
+		if emitted[i] != want[i] {
+			t.Fatalf("emitted = %v, want %v", emitted, want)
+		}
+	}
+}
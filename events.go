@@ -0,0 +1,28 @@
+package main
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// eventSampled reports whether a transaction's events are decoded under
+// EventSample. The choice comes from the transaction hash, so reruns sample
+// the same transactions and fetch workers can decide without coordinating.
+func (o scanOptions) eventSampled(hash string) bool {
+	if o.EventSample >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(hash)))
+	return float64(h.Sum32()) < o.EventSample*(1<<32)
+}
+
+// receiptEvents returns the receipt's logs with the known events decoded.
+func receiptEvents(receipt *TransactionReceipt) []Log {
+	events := make([]Log, len(receipt.Logs))
+	for i, l := range receipt.Logs {
+		events[i] = l
+		events[i].Decoded = decodeLog(l)
+	}
+	return events
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEventSampled(t *testing.T) {
+	all := scanOptions{EventSample: 1}
+	quarter := scanOptions{EventSample: 0.25}
+
+	sampled := 0
+	for i := 0; i < 4000; i++ {
+		hash := fmt.Sprintf("0x%064x", i)
+		if !all.eventSampled(hash) {
+			t.Fatalf("%s left out of a full sample", hash)
+		}
+		if quarter.eventSampled(hash) {
+			sampled++
+			if !quarter.eventSampled(strings.ToUpper(hash)) {
+				t.Errorf("%s sampled only in lower case", hash)
+			}
+		}
+	}
+	if sampled < 850 || sampled > 1150 {
+		t.Errorf("sampled %d of 4000 at 0.25, want about 1000", sampled)
+	}
+}
+
+func transferLog(hash, from, to string) Log {
+	return Log{
+		Address:         "0xtoken",
+		Topics:          []string{transferEventTopic, topicFor(from), topicFor(to)},
+		Data:            fmt.Sprintf("0x%064x", 500),
+		TransactionHash: hash,
+	}
+}
+
+func TestScanDecodesEvents(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: "0xtoken"}))
+	node.result("eth_getBlockReceipts", []TransactionReceipt{
+		{TransactionHash: "0x01", Status: "0x1", Logs: []Log{transferLog("0x01", watched, other)}},
+	})
+
+	lines := ndjsonLines(t, getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&events=true").Body.String())
+	if len(lines) < 1 || lines[0]["eventsDecoded"] != true {
+		t.Fatalf("lines = %v", lines)
+	}
+	events, _ := lines[0]["events"].([]interface{})
+	if len(events) != 1 {
+		t.Fatalf("events = %v", lines[0]["events"])
+	}
+	decoded, _ := events[0].(map[string]interface{})["decoded"].(map[string]interface{})
+	if decoded["event"] != "Transfer" || decoded["from"] != watched || decoded["to"] != other || decoded["value"] != "500" {
+		t.Errorf("decoded = %v", decoded)
+	}
+}
+
+func TestScanSamplesEvents(t *testing.T) {
+	node := newFakeNode(t)
+	opts := scanOptions{Events: true, EventSample: 0.3}
+	var txs []Transaction
+	var sampled []string
+	for i := 0; i < 20; i++ {
+		hash := fmt.Sprintf("0x%064x", i)
+		txs = append(txs, Transaction{Hash: hash, From: watched})
+		if opts.eventSampled(hash) {
+			sampled = append(sampled, hash)
+		}
+	}
+	if len(sampled) == 0 || len(sampled) == len(txs) {
+		t.Fatalf("sampled %d of %d; pick hashes that split", len(sampled), len(txs))
+	}
+	node.serveBlocks(testBlock(1, txs...))
+	node.handle("eth_getTransactionReceipt", func(params []interface{}) (interface{}, error) {
+		return TransactionReceipt{TransactionHash: params[0].(string), Status: "0x1"}, nil
+	})
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 1, opts, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.EventSample != 0.3 {
+		t.Errorf("summary.EventSample = %v", summary.EventSample)
+	}
+	if calls := node.callCount("eth_getTransactionReceipt"); calls != len(sampled) {
+		t.Errorf("fetched %d receipts, want only the %d sampled", calls, len(sampled))
+	}
+	var decoded []string
+	for _, m := range out.matches {
+		if m.EventsDecoded == nil {
+			t.Fatalf("%s has no eventsDecoded", m.Tx.Hash)
+		}
+		if *m.EventsDecoded {
+			decoded = append(decoded, m.Tx.Hash)
+		}
+	}
+	if fmt.Sprint(decoded) != fmt.Sprint(sampled) {
+		t.Errorf("decoded %v, want %v", decoded, sampled)
+	}
+
+	for _, sample := range []string{"0", "1.5", "most"} {
+		if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&eventSample="+sample); rec.Code != http.StatusBadRequest {
+			t.Errorf("eventSample=%s: status = %d, want %d", sample, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// rpcHandlerFunc answers one JSON-RPC call. Returning an *rpcError sends it
+// as the call's error object; any other error becomes code -32000.
+type rpcHandlerFunc func(params []interface{}) (interface{}, error)
+
+// fakeNode is a JSON-RPC endpoint for tests. It answers single calls and
+// batches from per-method handlers and points the client at itself for the
+// duration of the test.
+type fakeNode struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]rpcHandlerFunc
+	calls    map[string]int
+	batches  int
+	// rawBatch, when set, replaces the whole reply to a batch request.
+	rawBatch func(w http.ResponseWriter, calls []RequestPayload) bool
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	t.Helper()
+	node := &fakeNode{
+		handlers: make(map[string]rpcHandlerFunc),
+		calls:    make(map[string]int),
+	}
+	node.server = httptest.NewServer(http.HandlerFunc(node.serveHTTP))
+
+	previous := currentCredentials.Load()
+	currentCredentials.Store(&rpcCredentials{Endpoint: node.server.URL})
+	t.Cleanup(func() {
+		node.server.Close()
+		currentCredentials.Store(previous)
+	})
+	return node
+}
+
+func (n *fakeNode) handle(method string, handler rpcHandlerFunc) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[method] = handler
+}
+
+// result registers a handler that always returns the same result.
+func (n *fakeNode) result(method string, result interface{}) {
+	n.handle(method, func([]interface{}) (interface{}, error) {
+		return result, nil
+	})
+}
+
+func (n *fakeNode) callCount(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+func (n *fakeNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var calls []RequestPayload
+		if err := json.Unmarshal(body, &calls); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.mu.Lock()
+		n.batches++
+		rawBatch := n.rawBatch
+		n.mu.Unlock()
+		if rawBatch != nil && rawBatch(w, calls) {
+			return
+		}
+
+		responses := make([]map[string]interface{}, len(calls))
+		for i, call := range calls {
+			responses[i] = n.answer(call)
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	var call RequestPayload
+	if err := json.Unmarshal(body, &call); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, n.answer(call))
+}
+
+func (n *fakeNode) answer(call RequestPayload) map[string]interface{} {
+	n.mu.Lock()
+	n.calls[call.Method]++
+	handler := n.handlers[call.Method]
+	n.mu.Unlock()
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": call.ID}
+	if handler == nil {
+		response["error"] = &rpcError{Code: -32601, Message: "the method " + call.Method + " does not exist/is not available"}
+		return response
+	}
+
+	result, err := handler(call.Params)
+	switch rpcErr, ok := err.(*rpcError); {
+	case ok:
+		response["error"] = rpcErr
+	case err != nil:
+		response["error"] = &rpcError{Code: -32000, Message: err.Error()}
+	default:
+		response["result"] = result
+	}
+	return response
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// testBlock builds a block whose hash and parent hash follow from its number,
+// so consecutive test blocks form a chain.
+func testBlock(number int64, txs ...Transaction) *BlockWithTransactions {
+	for i := range txs {
+		txs[i].BlockNumber = fmt.Sprintf("0x%x", number)
+		if txs[i].TransactionIndex == "" {
+			txs[i].TransactionIndex = fmt.Sprintf("0x%x", i)
+		}
+	}
+	return &BlockWithTransactions{
+		Number:       fmt.Sprintf("0x%x", number),
+		Hash:         fmt.Sprintf("0x%064x", number),
+		ParentHash:   fmt.Sprintf("0x%064x", number-1),
+		Timestamp:    fmt.Sprintf("0x%x", 1700000000+12*number),
+		Transactions: txs,
+	}
+}
+
+// serveBlocks answers eth_getBlockByNumber and eth_blockNumber from blocks,
+// with the last one as latest and finalized. Hashes stand in for the
+// transactions when full is false, and unknown blocks are null.
+func (n *fakeNode) serveBlocks(blocks ...*BlockWithTransactions) {
+	byNumber := make(map[string]*BlockWithTransactions, len(blocks))
+	for _, block := range blocks {
+		byNumber[block.Number] = block
+	}
+	latest := blocks[len(blocks)-1]
+
+	n.result("eth_blockNumber", latest.Number)
+	n.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		tag, _ := params[0].(string)
+		full, _ := params[1].(bool)
+		block := byNumber[tag]
+		if tag == "latest" || tag == "finalized" || tag == "safe" {
+			block = latest
+		}
+		if block == nil {
+			return nil, nil
+		}
+		if full {
+			return block, nil
+		}
+
+		header := *block
+		header.Transactions = nil
+		encoded, _ := json.Marshal(header)
+		var fields map[string]interface{}
+		json.Unmarshal(encoded, &fields)
+		hashes := make([]string, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			hashes[i] = tx.Hash
+		}
+		fields["transactions"] = hashes
+		return fields, nil
+	})
+}
+
+// getJSON serves a GET for url from handler and, when it answers 200,
+// decodes the body into a T.
+func getJSON[T any](t *testing.T, handler http.HandlerFunc, url string) (T, *httptest.ResponseRecorder) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	var result T
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return result, rec
+}
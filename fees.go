@@ -0,0 +1,99 @@
+package main
+
+import "math/big"
+
+// effectiveGasPrice is what a transaction actually paid per gas:
+// min(maxFeePerGas, baseFee + maxPriorityFeePerGas) for EIP-1559
+// transactions, and gasPrice for legacy ones. It reports false when the
+// needed fields are missing.
+func effectiveGasPrice(baseFeePerGas string, tx Transaction) (*big.Int, bool) {
+	if tx.MaxFeePerGas != "" && baseFeePerGas != "" {
+		maxFee, err := parseQuantity(tx.MaxFeePerGas)
+		if err != nil {
+			return nil, false
+		}
+		baseFee, err := parseQuantity(baseFeePerGas)
+		if err != nil {
+			return nil, false
+		}
+		priorityFee := new(big.Int)
+		if tx.MaxPriorityFeePerGas != "" {
+			if priorityFee, err = parseQuantity(tx.MaxPriorityFeePerGas); err != nil {
+				return nil, false
+			}
+		}
+
+		price := new(big.Int).Add(baseFee, priorityFee)
+		if price.Cmp(maxFee) > 0 {
+			price = maxFee
+		}
+		return price, true
+	}
+
+	if tx.GasPrice != "" {
+		price, err := parseQuantity(tx.GasPrice)
+		return price, err == nil
+	}
+
+	return nil, false
+}
+
+func effectiveGasPriceHex(m match) string {
+	price, ok := effectiveGasPrice(m.Block.BaseFeePerGas, m.Tx)
+	if !ok {
+		return ""
+	}
+	return "0x" + price.Text(16)
+}
+
+// blockGasUtilization is gasUsed/gasLimit. It reports false when either is
+// missing or the limit is zero.
+func blockGasUtilization(block *BlockWithTransactions) (used, limit *big.Int, ratio float64, ok bool) {
+	used, err := parseQuantity(block.GasUsed)
+	if err != nil {
+		return nil, nil, 0, false
+	}
+	limit, err = parseQuantity(block.GasLimit)
+	if err != nil || limit.Sign() == 0 {
+		return nil, nil, 0, false
+	}
+	ratio, _ = new(big.Rat).SetFrac(used, limit).Float64()
+	return used, limit, ratio, true
+}
+
+const maxGasUtilizationBlocks = 1000
+
+// gasUtilization summarises how full the scanned blocks were. Average is
+// weighted by gas limit: total gas used over total gas limit. Per-block
+// ratios are dropped, and Truncated set, past maxGasUtilizationBlocks.
+type gasUtilization struct {
+	Average   float64           `json:"average"`
+	Blocks    map[int64]float64 `json:"blocks,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`
+
+	totalUsed  big.Int
+	totalLimit big.Int
+}
+
+func (g *gasUtilization) add(number int64, block *BlockWithTransactions) {
+	used, limit, ratio, ok := blockGasUtilization(block)
+	if !ok {
+		return
+	}
+	g.totalUsed.Add(&g.totalUsed, used)
+	g.totalLimit.Add(&g.totalLimit, limit)
+	g.Average, _ = new(big.Rat).SetFrac(&g.totalUsed, &g.totalLimit).Float64()
+
+	if g.Truncated {
+		return
+	}
+	if len(g.Blocks) >= maxGasUtilizationBlocks {
+		g.Blocks = nil
+		g.Truncated = true
+		return
+	}
+	if g.Blocks == nil {
+		g.Blocks = make(map[int64]float64)
+	}
+	g.Blocks[number] = ratio
+}
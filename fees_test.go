@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestEffectiveGasPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseFee string
+		tx      Transaction
+		want    string
+	}{
+		{name: "legacy", baseFee: "0x64", tx: Transaction{GasPrice: "0xc8"}, want: "0xc8"},
+		{name: "base plus tip", baseFee: "0x64", tx: Transaction{GasPrice: "0x6e", MaxFeePerGas: "0x12c", MaxPriorityFeePerGas: "0xa"}, want: "0x6e"},
+		{name: "capped by max fee", baseFee: "0x64", tx: Transaction{MaxFeePerGas: "0x69", MaxPriorityFeePerGas: "0xa"}, want: "0x69"},
+		{name: "no tip", baseFee: "0x64", tx: Transaction{MaxFeePerGas: "0x12c"}, want: "0x64"},
+		{name: "1559 without base fee falls back to gasPrice", tx: Transaction{GasPrice: "0x7", MaxFeePerGas: "0x12c"}, want: "0x7"},
+		{name: "nothing to go on", baseFee: "0x64", tx: Transaction{}, want: ""},
+		{name: "malformed", baseFee: "0x64", tx: Transaction{MaxFeePerGas: "zz"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := testBlock(1)
+			block.BaseFeePerGas = tt.baseFee
+			if got := effectiveGasPriceHex(match{Block: block, Tx: tt.tx}); got != tt.want {
+				t.Errorf("effectiveGasPriceHex = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func gasBlock(number int64, used, limit string) *BlockWithTransactions {
+	block := testBlock(number)
+	block.GasUsed = used
+	block.GasLimit = limit
+	return block
+}
+
+func TestGasUtilizationIsWeightedByLimit(t *testing.T) {
+	var g gasUtilization
+	g.add(1, gasBlock(1, "0x1", "0x4"))
+	g.add(2, gasBlock(2, "0x9", "0xc"))
+	g.add(3, gasBlock(3, "0x5", "0x0"))
+	g.add(4, gasBlock(4, "", "0x10"))
+
+	if g.Average != 0.625 {
+		t.Errorf("Average = %v, want 10/16", g.Average)
+	}
+	if fmt.Sprint(g.Blocks) != "map[1:0.25 2:0.75]" {
+		t.Errorf("Blocks = %v, want blocks without a usable limit left out", g.Blocks)
+	}
+
+	for number := int64(10); number < 10+maxGasUtilizationBlocks; number++ {
+		g.add(number, gasBlock(number, "0x0", "0x4"))
+	}
+	if !g.Truncated || g.Blocks != nil {
+		t.Errorf("truncated = %v, %d ratios kept", g.Truncated, len(g.Blocks))
+	}
+	if want := 10.0 / float64(16+4*maxGasUtilizationBlocks); g.Average != want {
+		t.Errorf("Average = %v after truncation, want %v", g.Average, want)
+	}
+}
+
+func TestScanReportsGasUtilization(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(gasBlock(1, "0x3", "0x4"), gasBlock(2, "0x1", "0x4"))
+
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{GasUtilization: true}, &recordingWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := summary.GasUtilization; g == nil || g.Average != 0.5 || fmt.Sprint(g.Blocks) != "map[1:0.75 2:0.25]" {
+		t.Errorf("gasUtilization = %+v", g)
+	}
+
+	summary, err = fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{}, &recordingWriter{})
+	if err != nil || summary.GasUtilization != nil {
+		t.Errorf("gasUtilization = %+v without the option, err = %v", summary.GasUtilization, err)
+	}
+}
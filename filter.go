@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type txPredicate func(Transaction) bool
+
+type filterField struct {
+	numeric bool
+	get     func(Transaction) string
+}
+
+var filterFields = map[string]filterField{
+	"value":    {numeric: true, get: func(tx Transaction) string { return tx.Value }},
+	"gasPrice": {numeric: true, get: func(tx Transaction) string { return tx.GasPrice }},
+	"from":     {get: func(tx Transaction) string { return tx.From }},
+	"to":       {get: func(tx Transaction) string { return tx.To }},
+	"selector": {get: transactionSelector},
+}
+
+func transactionSelector(tx Transaction) string {
+	if len(tx.Input) < 10 {
+		return ""
+	}
+	return tx.Input[:10]
+}
+
+type filterToken struct {
+	kind  string // "ident", "number", "op", "end"
+	value string
+	pos   int
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: "ident", value: expr[start:i], pos: start})
+		case unicode.IsDigit(c):
+			start := i
+			if strings.HasPrefix(expr[i:], "0x") || strings.HasPrefix(expr[i:], "0X") {
+				i += 2
+				for i < len(expr) && isHexDigit(expr[i]) {
+					i++
+				}
+			} else {
+				for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
+					i++
+				}
+				if i < len(expr) && (expr[i] == 'e' || expr[i] == 'E') {
+					i++
+					if i < len(expr) && (expr[i] == '+' || expr[i] == '-') {
+						i++
+					}
+					for i < len(expr) && unicode.IsDigit(rune(expr[i])) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, filterToken{kind: "number", value: expr[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", ">=", "<=", "&&", "||", ">", "<", "!", "(", ")"} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: "op", value: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: "end", pos: len(expr)}), nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter compiles an expression such as
+// `value > 1e18 && (to == 0xabc... || from == 0xabc...)` into a predicate.
+func parseFilter(expr string) (txPredicate, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	predicate, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != "end" {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.value, tok.pos)
+	}
+	return predicate, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != "end" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) parseOr() (txPredicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().value == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tx Transaction) bool { return l(tx) || right(tx) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (txPredicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().value == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tx Transaction) bool { return l(tx) && right(tx) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (txPredicate, error) {
+	tok := p.peek()
+	if tok.kind == "op" && tok.value == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(tx Transaction) bool { return !operand(tx) }, nil
+	}
+	if tok.kind == "op" && tok.value == "(" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.value != ")" {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (txPredicate, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != "ident" {
+		return nil, fmt.Errorf("expected field name at position %d", fieldTok.pos)
+	}
+	if p.peek().value == "(" {
+		return nil, fmt.Errorf("unknown function %q", fieldTok.value)
+	}
+	field, ok := filterFields[fieldTok.value]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", fieldTok.value)
+	}
+
+	opTok := p.next()
+	switch opTok.value {
+	case "==", "!=", ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("expected comparison operator after %s at position %d", fieldTok.value, opTok.pos)
+	}
+
+	literalTok := p.next()
+	if literalTok.kind != "number" {
+		return nil, fmt.Errorf("expected literal after %s %s at position %d", fieldTok.value, opTok.value, literalTok.pos)
+	}
+
+	if field.numeric {
+		return numericComparison(field, opTok.value, literalTok.value)
+	}
+	return stringComparison(fieldTok.value, field, opTok.value, literalTok.value)
+}
+
+func numericComparison(field filterField, op, literal string) (txPredicate, error) {
+	want, err := parseFilterNumber(literal)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(tx Transaction) bool {
+		got, err := parseQuantity(field.get(tx))
+		if err != nil {
+			return false
+		}
+		cmp := got.Cmp(want)
+		switch op {
+		case "==":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}, nil
+}
+
+func stringComparison(name string, field filterField, op, literal string) (txPredicate, error) {
+	if op != "==" && op != "!=" {
+		return nil, fmt.Errorf("operator %s is not supported for %s", op, name)
+	}
+	if !strings.HasPrefix(strings.ToLower(literal), "0x") {
+		return nil, fmt.Errorf("%s must be compared with a 0x-prefixed hex value", name)
+	}
+
+	return func(tx Transaction) bool {
+		equal := strings.EqualFold(field.get(tx), literal)
+		return equal == (op == "==")
+	}, nil
+}
+
+func parseFilterNumber(literal string) (*big.Int, error) {
+	if strings.HasPrefix(strings.ToLower(literal), "0x") {
+		return parseQuantity(strings.ToLower(literal))
+	}
+
+	value, _, err := big.ParseFloat(literal, 10, 256, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", literal)
+	}
+	integer, accuracy := value.Int(nil)
+	if accuracy != big.Exact {
+		return nil, fmt.Errorf("number %q is not an integer", literal)
+	}
+	return integer, nil
+}
+
+// transactionType reads a transaction's EIP-2718 type. Blocks from before
+// typed transactions leave it out, which makes them legacy (0).
+func transactionType(tx Transaction) (uint64, bool) {
+	if tx.Type == "" {
+		return 0, true
+	}
+	t, err := parseQuantity(tx.Type)
+	if err != nil || !t.IsUint64() {
+		return 0, false
+	}
+	return t.Uint64(), true
+}
+
+// parseTypeFilter accepts the transaction types listed in params, each in
+// hex (0x2) or decimal (2), with commas separating several.
+func parseTypeFilter(params []string) (txPredicate, error) {
+	types := make(map[uint64]bool)
+	for _, param := range params {
+		for _, value := range strings.Split(param, ",") {
+			value = strings.ToLower(strings.TrimSpace(value))
+			digits, base := value, 10
+			if strings.HasPrefix(value, "0x") {
+				digits, base = value[2:], 16
+			}
+			t, err := strconv.ParseUint(digits, base, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transaction type %q", value)
+			}
+			types[t] = true
+		}
+	}
+	return func(tx Transaction) bool {
+		t, ok := transactionType(tx)
+		return ok && types[t]
+	}, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseFilterEval(t *testing.T) {
+	tx := Transaction{
+		From:     watched,
+		To:       other,
+		Value:    "0xde0b6b3a7640000", // 1 ether
+		GasPrice: "0x3b9aca00",        // 1 gwei
+		Input:    "0xa9059cbb000000000000000000000000",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "value == 1e18", want: true},
+		{expr: "value > 1e18", want: false},
+		{expr: "value >= 1000000000000000000", want: true},
+		{expr: "value < 0xde0b6b3a7640001", want: true},
+		{expr: "gasPrice <= 1e9 && value != 0", want: true},
+		{expr: "from == 0x" + strings.ToUpper(watched[2:]), want: true},
+		{expr: "from == " + watched, want: true},
+		{expr: "to == " + watched + " || from == " + watched, want: true},
+		{expr: "!(to == " + other + ")", want: false},
+		{expr: "selector == 0xA9059CBB", want: true},
+		{expr: "selector != 0xa9059cbb || value > 2e18", want: false},
+		{expr: "value > 2e18 || value > 0 && gasPrice > 1e10", want: false},
+		{expr: "(value > 2e18 || value > 0) && gasPrice < 1e10", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			predicate, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("parseFilter: %v", err)
+			}
+			if got := predicate(tx); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "nonce > 1", wantErr: `unknown field "nonce"`},
+		{expr: "value >", wantErr: "expected literal"},
+		{expr: "value 5", wantErr: "expected comparison operator"},
+		{expr: "(value > 1", wantErr: "expected )"},
+		{expr: "value > 1 value", wantErr: "unexpected"},
+		{expr: "value > 1.5", wantErr: "not an integer"},
+		{expr: "from > 0xabc", wantErr: "operator > is not supported for from"},
+		{expr: "to == 12", wantErr: "0x-prefixed"},
+		{expr: "value > 1 # comment", wantErr: "unexpected character"},
+		{expr: "len(to) > 1", wantErr: `unknown function "len"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseFilter(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanAppliesFilter(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1,
+		Transaction{Hash: "0x01", From: watched, To: other, Value: "0x10"},
+		Transaction{Hash: "0x02", From: watched, To: other, Value: "0x1"},
+	))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&filter=value+>+5")
+	var hashes []string
+	for _, line := range ndjsonLines(t, rec.Body.String()) {
+		if line["type"] == "transaction" {
+			hashes = append(hashes, line["hash"].(string))
+		}
+	}
+	if len(hashes) != 1 || hashes[0] != "0x01" {
+		t.Errorf("matched %v, want only 0x01", hashes)
+	}
+
+	rec = getScan(t, "address="+watched+"&startBlock=1&endBlock=1&filter=value+>>+5")
+	if rec.Code != http.StatusBadRequest || !strings.HasPrefix(rec.Body.String(), "Invalid filter parameter") {
+		t.Errorf("bad filter: status %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestParseTypeFilter(t *testing.T) {
+	tests := []struct {
+		params []string
+		want   string
+	}{
+		{params: []string{"0x2"}, want: "[0x02]"},
+		{params: []string{"2"}, want: "[0x02]"},
+		{params: []string{"0x0"}, want: "[0x00 0x01]"},
+		{params: []string{"0x2", "0x3"}, want: "[0x02 0x03]"},
+		{params: []string{"0x1, 0X3"}, want: "[0x11 0x03]"},
+	}
+	txs := []Transaction{{Hash: "0x00", Type: "0x0"}, {Hash: "0x01"}, {Hash: "0x11", Type: "0x1"}, {Hash: "0x02", Type: "0x2"}, {Hash: "0x03", Type: "0x3"}, {Hash: "0xff", Type: "two"}}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.params, "&"), func(t *testing.T) {
+			accept, err := parseTypeFilter(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var matched []string
+			for _, tx := range txs {
+				if accept(tx) {
+					matched = append(matched, tx.Hash)
+				}
+			}
+			if got := "[" + strings.Join(matched, " ") + "]"; got != tt.want {
+				t.Errorf("matched %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, param := range []string{"", "legacy", "0x", "0x100", "-1"} {
+		if _, err := parseTypeFilter([]string{param}); err == nil {
+			t.Errorf("parseTypeFilter(%q) accepted it", param)
+		}
+	}
+}
+
+func TestScanFiltersByTransactionType(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1,
+		Transaction{Hash: "0x01", From: watched, To: other},
+		Transaction{Hash: "0x02", From: watched, To: other, Type: "0x1"},
+		Transaction{Hash: "0x03", From: watched, To: other, Type: "0x2", Value: "0x10"},
+		Transaction{Hash: "0x04", From: other, To: watched, Type: "0x2", Value: "0x1"},
+		Transaction{Hash: "0x05", From: watched, To: other, Type: "0x3"},
+	))
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "type=0x2", want: "[0x03 0x04]"},
+		{query: "type=0x0&type=3", want: "[0x01 0x05]"},
+		{query: "type=0x1,0x3", want: "[0x02 0x05]"},
+		{query: "type=0x2&filter=value+>+5", want: "[0x03]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&"+tt.query)
+			var hashes []string
+			for _, line := range ndjsonLines(t, rec.Body.String()) {
+				if line["type"] == "transaction" {
+					hashes = append(hashes, line["hash"].(string))
+				}
+			}
+			if got := "[" + strings.Join(hashes, " ") + "]"; got != tt.want {
+				t.Errorf("matched %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanRejectsBadTypeFilter(t *testing.T) {
+	newFakeNode(t)
+	for query, want := range map[string]string{
+		"type=eip1559":                "Invalid type parameter",
+		"type=0x2&method=traceFilter": "can't be used with method=traceFilter",
+	} {
+		rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&"+query)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: status %d, body %q", query, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	maxGasTrendBlocks = 10000
+
+	// headerBatchBlocks is how many headers are asked for per batch.
+	headerBatchBlocks = 100
+)
+
+// gasTrendPoint is one block of the /gas-trend series. BaseFeePerGas is
+// left out before London.
+type gasTrendPoint struct {
+	Number         int64   `json:"number"`
+	Timestamp      int64   `json:"timestamp"`
+	GasUsed        int64   `json:"gasUsed"`
+	GasLimit       int64   `json:"gasLimit"`
+	GasUsedPercent float64 `json:"gasUsedPercent"`
+	BaseFeePerGas  string  `json:"baseFeePerGas,omitempty"`
+	BaseFeeGwei    string  `json:"baseFeeGwei,omitempty"`
+}
+
+type gasTrend struct {
+	StartBlock int64           `json:"startBlock"`
+	EndBlock   int64           `json:"endBlock"`
+	Points     []gasTrendPoint `json:"points"`
+}
+
+func newGasTrendPoint(number int64, header *BlockWithTransactions) (gasTrendPoint, error) {
+	point := gasTrendPoint{Number: number}
+	used, limit, ratio, ok := blockGasUtilization(header)
+	if !ok {
+		return point, fmt.Errorf("block %d has no gasUsed or gasLimit", number)
+	}
+	point.GasUsed, point.GasLimit, point.GasUsedPercent = used.Int64(), limit.Int64(), ratio*100
+	if timestamp, err := parseQuantity(header.Timestamp); err == nil {
+		point.Timestamp = timestamp.Int64()
+	}
+	if header.BaseFeePerGas != "" {
+		point.BaseFeePerGas = header.BaseFeePerGas
+		point.BaseFeeGwei = convertWeiToGwei(header.BaseFeePerGas)
+	}
+	return point, nil
+}
+
+// headerRange fetches the headers of blocks from to to, without
+// transaction bodies, in batches of headerBatchBlocks.
+func headerRange(ctx context.Context, from, to int64, each func(number int64, header *BlockWithTransactions) error) error {
+	for start := from; start <= to; start += headerBatchBlocks {
+		end := min(start+headerBatchBlocks-1, to)
+		var calls []rpcCall
+		for number := start; number <= end; number++ {
+			calls = append(calls, rpcCall{Method: "eth_getBlockByNumber", Params: []interface{}{fmt.Sprintf("0x%x", number), false}})
+		}
+		results, err := sendRPCBatch(ctx, calls)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			number := start + int64(i)
+			if result.Err != nil {
+				return fmt.Errorf("failed to fetch block %d: %v", number, result.Err)
+			}
+			var header BlockWithTransactions
+			if err := decodeResult(result.Response, &header); err != nil {
+				return fmt.Errorf("failed to decode block %d: %v", number, err)
+			}
+			if err := each(number, &header); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func gasTrendHandler(w http.ResponseWriter, r *http.Request) {
+	startBlock, err := strconv.ParseInt(r.URL.Query().Get("startBlock"), 10, 64)
+	if err != nil || startBlock < 0 {
+		http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+		return
+	}
+	latest, err := getLatestBlockNumber()
+	if err != nil {
+		http.Error(w, "Error fetching latest block: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	endBlock := latest
+	if param := r.URL.Query().Get("endBlock"); param != "" {
+		endBlock, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || endBlock < startBlock {
+			http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
+			return
+		}
+		endBlock = min(endBlock, latest)
+	}
+	if startBlock > endBlock {
+		http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+		return
+	}
+	if endBlock-startBlock+1 > maxGasTrendBlocks {
+		http.Error(w, fmt.Sprintf("Range too large, at most %d blocks", maxGasTrendBlocks), http.StatusBadRequest)
+		return
+	}
+	if !allowScan(w, r) {
+		return
+	}
+
+	trend := gasTrend{StartBlock: startBlock, EndBlock: endBlock, Points: []gasTrendPoint{}}
+	err = headerRange(r.Context(), startBlock, endBlock, func(number int64, header *BlockWithTransactions) error {
+		point, err := newGasTrendPoint(number, header)
+		if err != nil {
+			return err
+		}
+		trend.Points = append(trend.Points, point)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Error fetching block headers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trend)
+}
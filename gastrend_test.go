@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// gasTrendBlocks builds blocks 1..n with distinct gas figures. Blocks
+// before london have no base fee.
+func gasTrendBlocks(n, london int64) []*BlockWithTransactions {
+	var blocks []*BlockWithTransactions
+	for number := int64(1); number <= n; number++ {
+		block := gasBlock(number, fmt.Sprintf("0x%x", 1000*number), "0x1c9c380")
+		if number >= london {
+			block.BaseFeePerGas = fmt.Sprintf("0x%x", 1000000000+number)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestGasTrendMatchesHeaders(t *testing.T) {
+	node := newFakeNode(t)
+	blocks := gasTrendBlocks(260, 100)
+	node.serveBlocks(blocks...)
+
+	trend, rec := getJSON[gasTrend](t, gasTrendHandler, "/gas-trend?startBlock=3&endBlock=250")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if trend.StartBlock != 3 || trend.EndBlock != 250 || len(trend.Points) != 248 {
+		t.Fatalf("trend covers %d-%d with %d points", trend.StartBlock, trend.EndBlock, len(trend.Points))
+	}
+	for i, point := range trend.Points {
+		header := blocks[point.Number-1]
+		used, limit, ratio, _ := blockGasUtilization(header)
+		timestamp, _ := parseQuantity(header.Timestamp)
+		want := gasTrendPoint{
+			Number:         int64(3 + i),
+			Timestamp:      timestamp.Int64(),
+			GasUsed:        used.Int64(),
+			GasLimit:       limit.Int64(),
+			GasUsedPercent: ratio * 100,
+			BaseFeePerGas:  header.BaseFeePerGas,
+		}
+		if header.BaseFeePerGas != "" {
+			want.BaseFeeGwei = convertWeiToGwei(header.BaseFeePerGas)
+		}
+		if point != want {
+			t.Fatalf("point %d = %+v, want %+v", i, point, want)
+		}
+	}
+	if point := trend.Points[0]; point.GasUsed != 3000 || point.GasLimit != 30000000 || point.BaseFeePerGas != "" {
+		t.Errorf("pre-London point = %+v", point)
+	}
+	if point := trend.Points[len(trend.Points)-1]; point.BaseFeePerGas != "0x3b9acafa" || point.BaseFeeGwei != "1.000000" {
+		t.Errorf("last point base fee = %s (%s gwei)", point.BaseFeePerGas, point.BaseFeeGwei)
+	}
+
+	if node.batches != 3 {
+		t.Errorf("headers fetched in %d batches, want %d", node.batches, 3)
+	}
+}
+
+func TestGasTrendDefaultsToLatest(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(gasTrendBlocks(5, 1)...)
+
+	trend, rec := getJSON[gasTrend](t, gasTrendHandler, "/gas-trend?startBlock=4&endBlock=99")
+	if rec.Code != http.StatusOK || trend.EndBlock != 5 || len(trend.Points) != 2 {
+		t.Errorf("status = %d, trend = %+v, want blocks 4-5", rec.Code, trend)
+	}
+	trend, rec = getJSON[gasTrend](t, gasTrendHandler, "/gas-trend?startBlock=5")
+	if rec.Code != http.StatusOK || len(trend.Points) != 1 || trend.Points[0].Number != 5 {
+		t.Errorf("status = %d, trend = %+v, want block 5", rec.Code, trend)
+	}
+}
+
+func TestGasTrendErrors(t *testing.T) {
+	node := newFakeNode(t)
+	blocks := gasTrendBlocks(20, 1)
+	blocks[9].GasLimit = ""
+	node.serveBlocks(blocks...)
+	node.result("eth_blockNumber", fmt.Sprintf("0x%x", 2*maxGasTrendBlocks))
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{query: "", code: http.StatusBadRequest},
+		{query: "startBlock=-1", code: http.StatusBadRequest},
+		{query: "startBlock=5&endBlock=4", code: http.StatusBadRequest},
+		{query: fmt.Sprintf("startBlock=1&endBlock=%d", maxGasTrendBlocks+1), code: http.StatusBadRequest},
+		{query: "startBlock=8&endBlock=12", code: http.StatusInternalServerError},
+		{query: "startBlock=30&endBlock=31", code: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if _, rec := getJSON[gasTrend](t, gasTrendHandler, "/gas-trend?"+tt.query); rec.Code != tt.code {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseWriter holds back the response header until the handler writes
+// a body, so bodiless responses go out without a Content-Encoding and the
+// Content-Type can still be sniffed from the uncompressed bytes.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	head        bool
+	status      int
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	if !w.allowsBody() {
+		w.writeHeader()
+	}
+}
+
+func (w *gzipResponseWriter) allowsBody() bool {
+	return !w.head && w.status != http.StatusNoContent && w.status != http.StatusNotModified
+}
+
+func (w *gzipResponseWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// startGzip commits the header with gzip encoding, sniffing the Content-Type
+// from the first uncompressed write when the handler didn't set one.
+func (w *gzipResponseWriter) startGzip(first []byte) {
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(first) > 0 {
+		header.Set("Content-Type", http.DetectContentType(first))
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.writeHeader()
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.gz == nil && !w.wroteHeader {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if !w.allowsBody() {
+			w.writeHeader()
+		} else if len(b) == 0 {
+			return 0, nil
+		} else {
+			w.startGzip(b)
+		}
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush pushes buffered compressed data through to the client so streamed
+// output keeps arriving in real time.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil && !w.wroteHeader {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if w.allowsBody() {
+			w.startGzip(nil)
+		} else {
+			w.writeHeader()
+		}
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close finishes the gzip stream, or sends the held-back header if the
+// handler set a status but never wrote a body.
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+		return
+	}
+	if w.status != 0 {
+		w.writeHeader()
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding = strings.TrimSpace(strings.Split(encoding, ";")[0])
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+func withGzip(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+		defer gw.close()
+
+		next(gw, r)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveGzip(t *testing.T, method string, acceptEncoding string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	withGzip(handler)(rec, req)
+	return rec
+}
+
+func TestWithGzipRoundTrip(t *testing.T) {
+	body := strings.Repeat(`{"hash":"0xabc","value":"1"}`, 100)
+	rec := serveGzip(t, http.MethodGet, "deflate, gzip;q=0.8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body[:10])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, body[10:])
+	})
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Errorf("decoded body = %q, want %q", decoded, body)
+	}
+}
+
+func TestWithGzipSniffsContentType(t *testing.T) {
+	rec := serveGzip(t, http.MethodGet, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><body>hello</body></html>")
+	})
+
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/html; charset=utf-8", got)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+}
+
+func TestWithGzipBodilessResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+		body   string
+	}{
+		{name: "no content", method: http.MethodGet, status: http.StatusNoContent},
+		{name: "not modified", method: http.MethodGet, status: http.StatusNotModified},
+		{name: "head", method: http.MethodHead, status: http.StatusOK, body: "ignored"},
+		{name: "status without body", method: http.MethodGet, status: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveGzip(t, tt.method, "gzip", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				if tt.body != "" {
+					io.WriteString(w, tt.body)
+				}
+			})
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestWithGzipWithoutAcceptEncoding(t *testing.T) {
+	rec := serveGzip(t, http.MethodGet, "", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	})
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if got := rec.Body.String(); got != "plain" {
+		t.Errorf("body = %q, want plain", got)
+	}
+}
+
+func TestWithGzipErrorStatusKeepsCode(t *testing.T) {
+	rec := serveGzip(t, http.MethodGet, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid address parameter", http.StatusBadRequest)
+	})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	decoded, _ := io.ReadAll(gz)
+	if strings.TrimSpace(string(decoded)) != "Invalid address parameter" {
+		t.Errorf("decoded body = %q", decoded)
+	}
+}
+
+func TestWithGzipStreamsScanResults(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: "0xcc"}),
+		testBlock(3, Transaction{Hash: "0x03", From: other, To: watched}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/fetch-transactions?address="+watched+"&startBlock=1&endBlock=3&format=ndjson", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	withGzip(fetchTransactionsHandler)(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+
+	var hashes []string
+	for _, line := range ndjsonLines(t, string(decoded)) {
+		if line["type"] == "transaction" {
+			hashes = append(hashes, line["hash"].(string))
+		}
+	}
+	if strings.Join(hashes, " ") != "0x01 0x03" {
+		t.Errorf("matched %v, want 0x01 and 0x03", hashes)
+	}
+}
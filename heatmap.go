@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type matchCollector struct {
+	matches []match
+}
+
+func (c *matchCollector) WriteMatch(m match) error {
+	c.matches = append(c.matches, m)
+	return nil
+}
+
+func (c *matchCollector) Flush() error {
+	return nil
+}
+
+type activityBucket struct {
+	Start        time.Time `json:"start"`
+	Transactions int       `json:"transactions"`
+	ValueWei     string    `json:"valueWei"`
+	ValueEther   string    `json:"valueEther"`
+}
+
+type hourOfDayBucket struct {
+	Hour         int    `json:"hour"`
+	Transactions int    `json:"transactions"`
+	ValueWei     string `json:"valueWei"`
+	ValueEther   string `json:"valueEther"`
+}
+
+// hourOfDay is the bucket value that folds the whole range onto the 24
+// hours of a day instead of laying it out in time.
+const hourOfDay = "hourOfDay"
+
+func parseBucketSize(value string) (time.Duration, error) {
+	switch value {
+	case "", "day":
+		return 24 * time.Hour, nil
+	case "hour":
+		return time.Hour, nil
+	default:
+		return time.ParseDuration(value)
+	}
+}
+
+// distinctTransfers drops the copies of a match reported for each further
+// watched address it touches, so a transfer between two watched addresses
+// counts once. Internal transfers of one transaction stay separate.
+func distinctTransfers(matches []match) []match {
+	seen := make(map[[4]string]bool, len(matches))
+	distinct := make([]match, 0, len(matches))
+	for _, m := range matches {
+		key := [4]string{m.Tx.Hash, m.Tx.From, m.Tx.To, m.Tx.Value}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, m)
+	}
+	return distinct
+}
+
+// bucketActivity groups matches by block timestamp into buckets of the given
+// size, aligned to the Unix epoch, and returns them in time order. The size
+// is whole seconds.
+func bucketActivity(matches []match, bucketSize time.Duration) ([]activityBucket, error) {
+	totals := make(map[int64]*big.Int)
+	counts := make(map[int64]int)
+	size := int64(bucketSize / time.Second)
+
+	for _, m := range distinctTransfers(matches) {
+		timestamp, err := parseQuantity(m.Block.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseQuantity(m.Tx.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		start := timestamp.Int64() - timestamp.Int64()%size
+		if totals[start] == nil {
+			totals[start] = new(big.Int)
+		}
+		totals[start].Add(totals[start], value)
+		counts[start]++
+	}
+
+	buckets := make([]activityBucket, 0, len(totals))
+	for start, total := range totals {
+		buckets = append(buckets, activityBucket{
+			Start:        time.Unix(start, 0).UTC(),
+			Transactions: counts[start],
+			ValueWei:     total.String(),
+			ValueEther:   formatEther(total),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	return buckets, nil
+}
+
+// activityByHourOfDay totals matches by the UTC hour of their block
+// timestamp, returning all 24 hours in order, empty ones included.
+func activityByHourOfDay(matches []match) ([]hourOfDayBucket, error) {
+	var totals [24]big.Int
+	var counts [24]int
+
+	for _, m := range distinctTransfers(matches) {
+		timestamp, err := parseQuantity(m.Block.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseQuantity(m.Tx.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		hour := time.Unix(timestamp.Int64(), 0).UTC().Hour()
+		totals[hour].Add(&totals[hour], value)
+		counts[hour]++
+	}
+
+	buckets := make([]hourOfDayBucket, 24)
+	for hour := range buckets {
+		buckets[hour] = hourOfDayBucket{
+			Hour:         hour,
+			Transactions: counts[hour],
+			ValueWei:     totals[hour].String(),
+			ValueEther:   formatEther(&totals[hour]),
+		}
+	}
+	return buckets, nil
+}
+
+// withBlockTimestamps fills in the block timestamp of matches that came
+// without one, as trace_filter matches do, from the block header. Matches
+// whose header can't be fetched are logged and left out.
+func withBlockTimestamps(ctx context.Context, matches []match) []match {
+	timestamps := make(map[string]string)
+	kept := matches[:0]
+	for _, m := range matches {
+		if m.Block.Timestamp == "" {
+			timestamp, ok := timestamps[m.Block.Number]
+			if !ok {
+				header, err := getBlockHeader(ctx, m.Block.Number)
+				if err != nil || header.Timestamp == "" {
+					log.Printf("Error fetching timestamp of block %s, leaving its matches out of the heatmap: %v", m.Block.Number, err)
+				} else {
+					timestamp = header.Timestamp
+				}
+				timestamps[m.Block.Number] = timestamp
+			}
+			if timestamp == "" {
+				continue
+			}
+			block := *m.Block
+			block.Timestamp = timestamp
+			m.Block = &block
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+func activityHeatmapHandler(w http.ResponseWriter, r *http.Request) {
+	bucket := r.URL.Query().Get("bucket")
+	var bucketSize time.Duration
+	if bucket != hourOfDay {
+		var err error
+		bucketSize, err = parseBucketSize(bucket)
+		if err != nil || bucketSize < time.Second || bucketSize%time.Second != 0 {
+			http.Error(w, "Invalid bucket parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	scan, ok := parseScanRequest(w, r)
+	if !ok {
+		return
+	}
+
+	collector := &matchCollector{}
+	if !scan.checkWriter(w, collector) {
+		return
+	}
+	if _, err := scan.run(r.Context(), collector); err != nil {
+		log.Printf("Error scanning activity for %s: %v", scan.addressList(), err)
+		http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matches := withBlockTimestamps(r.Context(), collector.matches)
+
+	if bucket == hourOfDay {
+		hours, err := activityByHourOfDay(matches)
+		if err != nil {
+			http.Error(w, "Error bucketing transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hours)
+		return
+	}
+
+	buckets, err := bucketActivity(matches, bucketSize)
+	if err != nil {
+		http.Error(w, "Error bucketing transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buckets)
+}
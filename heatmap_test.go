@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func timestampedMatch(at time.Time, value string) match {
+	block := testBlock(1)
+	block.Timestamp = fmt.Sprintf("0x%x", at.Unix())
+	return match{Block: block, Tx: Transaction{Value: value}}
+}
+
+func TestBucketActivity(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	matches := []match{
+		timestampedMatch(day.Add(25*time.Hour), "0x3"),
+		timestampedMatch(day.Add(time.Hour), "0xde0b6b3a7640000"),
+		timestampedMatch(day.Add(23*time.Hour), "0x1"),
+	}
+
+	buckets, err := bucketActivity(matches, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2: %+v", len(buckets), buckets)
+	}
+	if !buckets[0].Start.Equal(day) || buckets[0].Transactions != 2 || buckets[0].ValueWei != "1000000000000000001" {
+		t.Errorf("first bucket = %+v", buckets[0])
+	}
+	if !buckets[1].Start.Equal(day.Add(24*time.Hour)) || buckets[1].Transactions != 1 || buckets[1].ValueWei != "3" {
+		t.Errorf("second bucket = %+v", buckets[1])
+	}
+}
+
+func TestBucketActivityAlignsToTheEpoch(t *testing.T) {
+	at := time.Date(2024, 3, 1, 13, 30, 0, 0, time.UTC)
+	for _, size := range []time.Duration{5 * time.Hour, 7 * 24 * time.Hour, 90 * time.Second} {
+		buckets, err := bucketActivity([]match{timestampedMatch(at, "0x1")}, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seconds := int64(size / time.Second)
+		want := time.Unix(at.Unix()-at.Unix()%seconds, 0).UTC()
+		if len(buckets) != 1 || !buckets[0].Start.Equal(want) {
+			t.Errorf("%v buckets = %+v, want one starting at %v", size, buckets, want)
+		}
+	}
+}
+
+func TestActivityCountsATransferBetweenWatchedAddressesOnce(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	transfer := timestampedMatch(at, "0x5")
+	transfer.Tx.Hash, transfer.Tx.From, transfer.Tx.To = "0x01", watched, other
+	copied := transfer
+	copied.Address = other
+	internal := transfer
+	internal.Tx.To, internal.Tx.Value = "0xcc", "0x6"
+	matches := []match{transfer, copied, internal}
+
+	buckets, err := bucketActivity(matches, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Transactions != 2 || buckets[0].ValueWei != "11" {
+		t.Errorf("buckets = %+v, want the copy for the second address left out", buckets)
+	}
+
+	hours, err := activityByHourOfDay(matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hours[9].Transactions != 2 || hours[9].ValueWei != "11" {
+		t.Errorf("hour 9 = %+v, want the copy for the second address left out", hours[9])
+	}
+}
+
+func TestParseBucketSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 24 * time.Hour},
+		{value: "day", want: 24 * time.Hour},
+		{value: "hour", want: time.Hour},
+		{value: "15m", want: 15 * time.Minute},
+		{value: "week", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseBucketSize(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseBucketSize(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestActivityHeatmapHandler(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x5"}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: watched, Value: "0x6"}),
+	)
+
+	rec := httptest.NewRecorder()
+	activityHeatmapHandler(rec, httptest.NewRequest(http.MethodGet, "/activity-heatmap?address="+watched+"&startBlock=1&endBlock=2&bucket=hour", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var buckets []activityBucket
+	if err := json.NewDecoder(rec.Body).Decode(&buckets); err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Transactions != 2 || buckets[0].ValueWei != "11" {
+		t.Errorf("buckets = %+v", buckets)
+	}
+}
+
+func TestActivityHeatmapRejectsBadBucket(t *testing.T) {
+	for _, bucket := range []string{"-1h", "500ms", "1500ms"} {
+		rec := httptest.NewRecorder()
+		activityHeatmapHandler(rec, httptest.NewRequest(http.MethodGet, "/activity-heatmap?address="+watched+"&startBlock=1&endBlock=2&bucket="+bucket, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("bucket=%s: status = %d, want %d", bucket, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestActivityHeatmapFetchesTimestampsForTraceMatches(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3))
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if params[0] == "0x2" {
+			return nil, fmt.Errorf("header not found")
+		}
+		return serve(params)
+	})
+	serveTraceFilter(node, []blockTrace{
+		transferTrace(1, 0, "0x01", watched, other, "0x1"),
+		transferTrace(1, 1, "0x02", watched, other, "0x2"),
+		transferTrace(2, 0, "0x03", watched, other, "0x4"),
+		transferTrace(3, 0, "0x04", watched, other, "0x8"),
+	})
+
+	rec := httptest.NewRecorder()
+	activityHeatmapHandler(rec, httptest.NewRequest(http.MethodGet, "/activity-heatmap?address="+watched+"&startBlock=1&endBlock=3&method=traceFilter", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var buckets []activityBucket
+	if err := json.NewDecoder(rec.Body).Decode(&buckets); err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Transactions != 3 || buckets[0].ValueWei != "11" {
+		t.Errorf("buckets = %+v, want block 2's match left out", buckets)
+	}
+}
+
+func TestActivityByHourOfDay(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	matches := []match{
+		timestampedMatch(day.Add(9*time.Hour+5*time.Minute), "0x1"),
+		timestampedMatch(day.Add(33*time.Hour+50*time.Minute), "0xde0b6b3a7640000"),
+		timestampedMatch(day.Add(23*time.Hour+59*time.Minute), "0x2"),
+	}
+
+	hours, err := activityByHourOfDay(matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 24 {
+		t.Fatalf("got %d hours, want 24", len(hours))
+	}
+	for hour, bucket := range hours {
+		want := hourOfDayBucket{Hour: hour, ValueWei: "0", ValueEther: formatEther(new(big.Int))}
+		switch hour {
+		case 9:
+			want.Transactions, want.ValueWei, want.ValueEther = 2, "1000000000000000001", "1.000000"
+		case 23:
+			want.Transactions, want.ValueWei, want.ValueEther = 1, "2", "0.000000"
+		}
+		if bucket != want {
+			t.Errorf("hour %d = %+v, want %+v", hour, bucket, want)
+		}
+	}
+
+	if _, err := activityByHourOfDay([]match{timestampedMatch(day, "value")}); err == nil {
+		t.Error("bucketed an unreadable value")
+	}
+}
+
+func TestActivityHeatmapByHourOfDay(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x5"}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: watched, Value: "0x6"}),
+	)
+
+	rec := httptest.NewRecorder()
+	activityHeatmapHandler(rec, httptest.NewRequest(http.MethodGet, "/activity-heatmap?address="+watched+"&startBlock=1&endBlock=2&bucket=hourOfDay", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var hours []hourOfDayBucket
+	if err := json.NewDecoder(rec.Body).Decode(&hours); err != nil {
+		t.Fatal(err)
+	}
+	// Test block timestamps fall at 22:13 UTC.
+	if len(hours) != 24 || hours[22].Transactions != 2 || hours[22].ValueWei != "11" || hours[21].Transactions != 0 {
+		t.Errorf("hours = %+v", hours)
+	}
+}
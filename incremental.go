@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// incrementalStartBlock is the configured start for an address's first
+// incremental scan; -1 means the request must provide startBlock.
+var incrementalStartBlock int64 = -1
+
+// Checkpoint and SetCheckpoint key addresses case-insensitively, so a
+// checksummed address resumes from the same checkpoint as its lowercase form.
+func (s *Store) Checkpoint(address string) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	block, ok := s.checkpoints[strings.ToLower(address)]
+	return block, ok
+}
+
+func (s *Store) SetCheckpoint(address string, block int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[strings.ToLower(address)] = block
+}
+
+// incrementalStart picks the first block an incremental scan must cover: the
+// block after the oldest checkpoint, or firstRun for addresses never scanned.
+func incrementalStart(store *Store, addresses []string, firstRun int64) (int64, error) {
+	start := int64(-1)
+	for _, address := range addresses {
+		from := firstRun
+		if checkpoint, ok := store.Checkpoint(address); ok {
+			from = checkpoint + 1
+		} else if firstRun < 0 {
+			return 0, fmt.Errorf("no previous scan for %s; provide startBlock for the first run", address)
+		}
+		if start < 0 || from < start {
+			start = from
+		}
+	}
+	return start, nil
+}
+
+// advanceCheckpoints records how far a finished incremental scan got. Blocks
+// that failed are not skipped: the checkpoint stops just before the first one
+// so the next run retries it.
+func advanceCheckpoints(store *Store, addresses []string, startBlock, endBlock int64, summary scanSummary) {
+	last := endBlock
+	if len(summary.FailedBlocks) > 0 {
+		last = slices.Min(summary.FailedBlocks) - 1
+	}
+	if last < startBlock {
+		return
+	}
+
+	for _, address := range addresses {
+		if checkpoint, ok := store.Checkpoint(address); !ok || last > checkpoint {
+			store.SetCheckpoint(address, last)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointsIgnoreAddressCase(t *testing.T) {
+	s := newStore()
+	s.SetCheckpoint("0xAbCdEf", 10)
+	if block, ok := s.Checkpoint("0xabcdef"); !ok || block != 10 {
+		t.Errorf("Checkpoint(lowercase) = %d, %v", block, ok)
+	}
+	if block, ok := s.Checkpoint("0xABCDEF"); !ok || block != 10 {
+		t.Errorf("Checkpoint(uppercase) = %d, %v", block, ok)
+	}
+}
+
+func TestIncrementalStart(t *testing.T) {
+	s := newStore()
+	s.SetCheckpoint(watched, 20)
+	s.SetCheckpoint(other, 10)
+
+	if start, err := incrementalStart(s, []string{watched, other}, -1); err != nil || start != 11 {
+		t.Errorf("start = %d, %v; want 11, the block after the oldest checkpoint", start, err)
+	}
+	if start, err := incrementalStart(s, []string{watched, "0xcc"}, 5); err != nil || start != 5 {
+		t.Errorf("start with a new address = %d, %v; want 5", start, err)
+	}
+	if _, err := incrementalStart(s, []string{"0xcc"}, -1); err == nil {
+		t.Error("new address without a first-run start: no error")
+	}
+}
+
+func TestAdvanceCheckpoints(t *testing.T) {
+	s := newStore()
+	advanceCheckpoints(s, []string{watched}, 1, 10, scanSummary{FailedBlocks: []int64{7, 4}})
+	if block, _ := s.Checkpoint(watched); block != 3 {
+		t.Errorf("checkpoint = %d, want 3, before the first failed block", block)
+	}
+
+	advanceCheckpoints(s, []string{watched}, 1, 2, scanSummary{})
+	if block, _ := s.Checkpoint(watched); block != 3 {
+		t.Errorf("checkpoint moved back to %d", block)
+	}
+
+	advanceCheckpoints(s, []string{other}, 5, 10, scanSummary{FailedBlocks: []int64{5}})
+	if _, ok := s.Checkpoint(other); ok {
+		t.Error("checkpoint set although the first block failed")
+	}
+}
+
+func TestSinceLastScanResumes(t *testing.T) {
+	useStore(t)
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched}),
+	)
+
+	checksummed := "0x00000000000000000000000000000000000000AA"
+	rec := getScan(t, "address="+checksummed+"&startBlock=1&sinceLastScan=true&format=ndjson")
+	if lines := ndjsonLines(t, rec.Body.String()); len(lines) == 0 || lines[len(lines)-1]["blocksScanned"] != float64(2) {
+		t.Fatalf("first run: %v", lines)
+	}
+
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched}),
+		testBlock(3, Transaction{Hash: "0x03", From: watched}),
+	)
+	rec = getScan(t, "address="+watched+"&sinceLastScan=true&format=ndjson")
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) != 2 || lines[0]["hash"] != "0x03" {
+		t.Errorf("second run lines = %v, want only block 3", lines)
+	}
+
+	rec = getScan(t, "address=0xcc&sinceLastScan=true")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "provide startBlock") {
+		t.Errorf("unscanned address: %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+)
+
+// scanStats counts a scan's progress while it runs so throughput can be
+// read live from another goroutine.
+type scanStats struct {
+	Blocks       atomic.Int64
+	Transactions atomic.Int64
+	Matches      atomic.Int64
+}
+
+type job struct {
+	id         string
+	addresses  []string
+	startBlock int64
+	endBlock   int64
+	started    time.Time
+	stats      scanStats
+
+	mu       sync.Mutex
+	state    string
+	finished time.Time
+	err      error
+	summary  *scanSummary
+	result   interface{}
+}
+
+type jobStatus struct {
+	ID                    string       `json:"id"`
+	State                 string       `json:"state"`
+	Addresses             []string     `json:"addresses"`
+	StartBlock            int64        `json:"startBlock"`
+	EndBlock              int64        `json:"endBlock"`
+	BlocksProcessed       int64        `json:"blocksProcessed"`
+	TransactionsInspected int64        `json:"transactionsInspected"`
+	Matches               int64        `json:"matches"`
+	ElapsedSeconds        float64      `json:"elapsedSeconds"`
+	BlocksPerSecond       float64      `json:"blocksPerSecond"`
+	TransactionsPerSecond float64      `json:"transactionsPerSecond"`
+	MatchesPerSecond      float64      `json:"matchesPerSecond"`
+	Error                 string       `json:"error,omitempty"`
+	Summary               *scanSummary `json:"summary,omitempty"`
+	Result                interface{}  `json:"result,omitempty"`
+}
+
+type jobRegistry struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[string]*job
+}
+
+var jobs = &jobRegistry{jobs: make(map[string]*job)}
+
+func (r *jobRegistry) start(scan scanRequest) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	j := &job{
+		id:         strconv.FormatInt(r.nextID, 10),
+		addresses:  scan.Addresses,
+		startBlock: scan.StartBlock,
+		endBlock:   scan.EndBlock,
+		started:    time.Now(),
+		state:      jobRunning,
+	}
+	r.jobs[j.id] = j
+	return j
+}
+
+func (r *jobRegistry) get(id string) (*job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	return j, ok
+}
+
+func (r *jobRegistry) list() []*job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].started.Before(list[b].started) })
+	return list
+}
+
+func (j *job) finish(summary scanSummary, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finished = time.Now()
+	j.summary = &summary
+	j.err = err
+	if err != nil {
+		j.state = jobFailed
+	} else {
+		j.state = jobCompleted
+	}
+}
+
+// finishWith finishes a job whose output is a result, such as a contract's
+// timeline, rather than matches written elsewhere. The result is shown
+// with the job's status.
+func (j *job) finishWith(result interface{}, summary scanSummary, err error) {
+	j.mu.Lock()
+	j.result = result
+	j.mu.Unlock()
+	j.finish(summary, err)
+}
+
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	end := time.Now()
+	if !j.finished.IsZero() {
+		end = j.finished
+	}
+	elapsed := end.Sub(j.started).Seconds()
+
+	status := jobStatus{
+		ID:                    j.id,
+		State:                 j.state,
+		Addresses:             j.addresses,
+		StartBlock:            j.startBlock,
+		EndBlock:              j.endBlock,
+		BlocksProcessed:       j.stats.Blocks.Load(),
+		TransactionsInspected: j.stats.Transactions.Load(),
+		Matches:               j.stats.Matches.Load(),
+		ElapsedSeconds:        elapsed,
+		Summary:               j.summary,
+		Result:                j.result,
+	}
+	if elapsed > 0 {
+		status.BlocksPerSecond = float64(status.BlocksProcessed) / elapsed
+		status.TransactionsPerSecond = float64(status.TransactionsInspected) / elapsed
+		status.MatchesPerSecond = float64(status.Matches) / elapsed
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		j, ok := jobs.get(id)
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(j.status())
+		return
+	}
+
+	statuses := []jobStatus{}
+	for _, j := range jobs.list() {
+		statuses = append(statuses, j.status())
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTextScanRunsAsJob(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: other, To: other}, Transaction{Hash: "0x02", From: other, To: other}),
+		testBlock(2, Transaction{Hash: "0x03", From: other, To: other}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2")
+	id := regexp.MustCompile(`\(job (\d+)\)`).FindStringSubmatch(rec.Body.String())
+	if id == nil {
+		t.Fatalf("response %q names no job", rec.Body)
+	}
+
+	var status jobStatus
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var rec *httptest.ResponseRecorder
+		if status, rec = getJSON[jobStatus](t, jobsHandler, "/jobs?id="+id[1]); rec.Code != http.StatusOK {
+			t.Fatalf("job status code = %d", rec.Code)
+		}
+		if status.State != jobRunning {
+			break
+		}
+	}
+
+	if status.State != jobCompleted {
+		t.Fatalf("job state = %q (%s)", status.State, status.Error)
+	}
+	if status.BlocksProcessed != 2 || status.TransactionsInspected != 3 || status.Matches != 0 {
+		t.Errorf("job counters = %+v", status)
+	}
+	if status.Summary == nil || status.Summary.BlocksScanned != 2 {
+		t.Errorf("job summary = %+v", status.Summary)
+	}
+
+	if _, rec := getJSON[jobStatus](t, jobsHandler, "/jobs?id=nope"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
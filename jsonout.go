@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+type fieldCase string
+
+const (
+	camelCase fieldCase = "camel"
+	snakeCase fieldCase = "snake"
+)
+
+func parseFieldCase(value string) (fieldCase, error) {
+	switch value {
+	case "", string(camelCase):
+		return camelCase, nil
+	case string(snakeCase):
+		return snakeCase, nil
+	default:
+		return "", fmt.Errorf("unknown field case %q", value)
+	}
+}
+
+type matchRecord struct {
+	Transaction
+	ValueEther        string `json:"valueEther"`
+	BaseFeePerGas     string `json:"baseFeePerGas,omitempty"`
+	EffectiveGasPrice string `json:"effectiveGasPrice,omitempty"`
+	FromLabel         string `json:"fromLabel,omitempty"`
+	ToLabel           string `json:"toLabel,omitempty"`
+	MatchedAddress    string `json:"matchedAddress"`
+	Action            string `json:"action"`
+	USDValue          string `json:"usdValue,omitempty"`
+	Status            string `json:"status,omitempty"`
+	GasUsed           string `json:"gasUsed,omitempty"`
+	CodeSize          *int   `json:"codeSize,omitempty"`
+	Confirmations     *int64 `json:"confirmations,omitempty"`
+	RawTransaction    string `json:"rawTransaction,omitempty"`
+	EventsDecoded     *bool  `json:"eventsDecoded,omitempty"`
+	Events            []Log  `json:"events,omitempty"`
+	ChainID           int64  `json:"chainId,omitempty"`
+}
+
+func newMatchRecord(m match) matchRecord {
+	record := matchRecord{
+		Transaction:       m.Tx,
+		ValueEther:        convertWeiToEther(m.Tx.Value),
+		BaseFeePerGas:     m.Block.BaseFeePerGas,
+		EffectiveGasPrice: effectiveGasPriceHex(m),
+		FromLabel:         labels.label(m.Tx.From),
+		ToLabel:           labels.label(m.Tx.To),
+		MatchedAddress:    m.Address,
+		Action:            actions.label(m.Tx),
+		USDValue:          usdValue(m.Tx.Value, m.USDPrice),
+		ChainID:           m.ChainID,
+		CodeSize:          m.CodeSize,
+		Confirmations:     m.Confirmations,
+		RawTransaction:    m.RawTransaction,
+		EventsDecoded:     m.EventsDecoded,
+		Events:            m.Events,
+	}
+	if m.Receipt != nil {
+		record.Status = m.Receipt.Status
+		record.GasUsed = m.Receipt.GasUsed
+	}
+	return record
+}
+
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func renameKeys(value interface{}, rename func(string) string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			renamed[rename(key)] = renameKeys(nested, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = renameKeys(nested, rename)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// marshalWithCase encodes value with its native camelCase tags, re-keying
+// the result when another casing is requested.
+func marshalWithCase(value interface{}, casing fieldCase) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil || casing != snakeCase {
+		return encoded, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(generic, toSnakeCase))
+}
+
+type ndjsonMatchWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	casing  fieldCase
+}
+
+func newNDJSONMatchWriter(w io.Writer, casing fieldCase) *ndjsonMatchWriter {
+	n := &ndjsonMatchWriter{w: w, casing: casing}
+	n.flusher, _ = w.(http.Flusher)
+	return n
+}
+
+func (n *ndjsonMatchWriter) writeLine(value interface{}) error {
+	line, err := marshalWithCase(value, n.casing)
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(append(line, '\n'))
+	return err
+}
+
+type ndjsonMatchEvent struct {
+	Type string `json:"type"`
+	matchRecord
+}
+
+type ndjsonWithdrawalEvent struct {
+	Type string `json:"type"`
+	withdrawalRecord
+}
+
+type ndjsonSelfDestructEvent struct {
+	Type string `json:"type"`
+	selfDestructRecord
+}
+
+type ndjsonSummaryEvent struct {
+	Type string `json:"type"`
+	scanSummary
+}
+
+type ndjsonErrorEvent struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+func (n *ndjsonMatchWriter) WriteMatch(m match) error {
+	return n.writeLine(ndjsonMatchEvent{Type: "transaction", matchRecord: newMatchRecord(m)})
+}
+
+func (n *ndjsonMatchWriter) WriteWithdrawal(block *BlockWithTransactions, withdrawal Withdrawal) error {
+	return n.writeLine(ndjsonWithdrawalEvent{Type: "withdrawal", withdrawalRecord: newWithdrawalRecord(block, withdrawal)})
+}
+
+func (n *ndjsonMatchWriter) WriteSelfDestruct(block *BlockWithTransactions, sd selfDestruct) error {
+	return n.writeLine(ndjsonSelfDestructEvent{Type: "selfDestruct", selfDestructRecord: newSelfDestructRecord(block, sd)})
+}
+
+// WriteSummary ends a successful stream so clients can tell a finished scan
+// from a dropped connection.
+func (n *ndjsonMatchWriter) WriteSummary(summary scanSummary) error {
+	if err := n.writeLine(ndjsonSummaryEvent{Type: "complete", scanSummary: summary}); err != nil {
+		return err
+	}
+	return n.Flush()
+}
+
+func (n *ndjsonMatchWriter) WriteError(scanErr error) error {
+	if err := n.writeLine(ndjsonErrorEvent{Type: "error", Error: scanErr.Error()}); err != nil {
+		return err
+	}
+	return n.Flush()
+}
+
+func (n *ndjsonMatchWriter) Flush() error {
+	if n.flusher != nil {
+		n.flusher.Flush()
+	}
+	return nil
+}
+
+// groupMatchesByAddress builds one result list per watched address, each
+// address present even when it had no matches.
+func groupMatchesByAddress(addresses []string, matches []match) map[string][]matchRecord {
+	grouped := make(map[string][]matchRecord, len(addresses))
+	for _, address := range addresses {
+		grouped[address] = []matchRecord{}
+	}
+	for _, m := range matches {
+		grouped[m.Address] = append(grouped[m.Address], newMatchRecord(m))
+	}
+	return grouped
+}
+
+type blockGroup struct {
+	TransactionCount int           `json:"transactionCount,omitempty"`
+	Matches          []matchRecord `json:"matches"`
+}
+
+// groupMatchesByBlock builds one group per block with matches, keyed by
+// decimal block number, next to the block's total transaction count. The
+// count is left out where the scan didn't see whole blocks (trace_filter).
+func groupMatchesByBlock(matches []match) map[string]blockGroup {
+	grouped := make(map[string]blockGroup)
+	for _, m := range matches {
+		key := decimalOrEmpty(m.Block.Number)
+		group := grouped[key]
+		group.TransactionCount = m.BlockTransactions
+		group.Matches = append(group.Matches, newMatchRecord(m))
+		grouped[key] = group
+	}
+	return grouped
+}
+
+// writeGroupedJSON writes a map of result groups, applying the field casing
+// to the groups but never to the map keys, which are data.
+func writeGroupedJSON[T any](w http.ResponseWriter, grouped map[string]T, casing fieldCase) error {
+	encodedGroups := make(map[string]json.RawMessage, len(grouped))
+	for key, group := range grouped {
+		encoded, err := marshalWithCase(group, casing)
+		if err != nil {
+			return err
+		}
+		encodedGroups[key] = encoded
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(encodedGroups)
+}
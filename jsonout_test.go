@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// ndjsonLines decodes every line of an NDJSON body.
+func ndjsonLines(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("decoding NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestNDJSONOutputFieldCase(t *testing.T) {
+	tests := []struct {
+		fieldCase string
+		present   []string
+		absent    []string
+	}{
+		{fieldCase: "", present: []string{"blockNumber", "valueEther", "matchedAddress"}, absent: []string{"block_number"}},
+		{fieldCase: "camel", present: []string{"blockNumber", "gasPrice", "v", "r", "s", "yParity"}, absent: []string{"gas_price"}},
+		{fieldCase: "snake", present: []string{"block_number", "value_ether", "matched_address", "gas_price", "y_parity"}, absent: []string{"blockNumber", "yParity"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("fieldCase="+tt.fieldCase, func(t *testing.T) {
+			node := newFakeNode(t)
+			node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x1", GasPrice: "0x2", V: "0x1", R: "0x1b", S: "0x2c", YParity: "0x1"}))
+
+			rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&fieldCase="+tt.fieldCase)
+			if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			lines := ndjsonLines(t, rec.Body.String())
+			if len(lines) == 0 || lines[0]["type"] != "transaction" {
+				t.Fatalf("first line is not a transaction: %v", lines)
+			}
+			for _, key := range tt.present {
+				if _, ok := lines[0][key]; !ok {
+					t.Errorf("key %q missing from %v", key, lines[0])
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := lines[0][key]; ok {
+					t.Errorf("unexpected key %q in %v", key, lines[0])
+				}
+			}
+		})
+	}
+}
+
+func TestNDJSONRejectsUnknownFieldCase(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&fieldCase=kebab")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"blockNumber":          "block_number",
+		"hash":                 "hash",
+		"maxPriorityFeePerGas": "max_priority_fee_per_gas",
+		"chainId":              "chain_id",
+	} {
+		if got := toSnakeCase(name); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNDJSONStreamEndsWithSummary(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}),
+		testBlock(2),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=3&format=ndjson")
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want a match and the summary: %v", len(lines), lines)
+	}
+	summary := lines[1]
+	if summary["type"] != "complete" || summary["blocksScanned"] != float64(2) || summary["matches"] != float64(1) {
+		t.Errorf("summary line = %v", summary)
+	}
+	if failed, ok := summary["failedBlocks"].([]interface{}); !ok || len(failed) != 0 {
+		t.Errorf("failedBlocks = %v, want an empty list", summary["failedBlocks"])
+	}
+}
+
+func TestNDJSONWriteError(t *testing.T) {
+	var out strings.Builder
+	if err := newNDJSONMatchWriter(&out, snakeCase).WriteError(fmt.Errorf("context canceled")); err != nil {
+		t.Fatal(err)
+	}
+	lines := ndjsonLines(t, out.String())
+	if len(lines) != 1 || lines[0]["type"] != "error" || lines[0]["error"] != "context canceled" {
+		t.Errorf("lines = %v", lines)
+	}
+}
+
+func TestNDJSONKeepsAccessLists(t *testing.T) {
+	accessList := []accessListEntry{
+		{Address: other, StorageKeys: []string{"0x" + strings.Repeat("0", 63) + "1"}},
+		{Address: "0xcc", StorageKeys: []string{}},
+	}
+	for _, query := range []string{"", "&streamDecode=true"} {
+		t.Run("query="+query, func(t *testing.T) {
+			node := newFakeNode(t)
+			node.serveBlocks(testBlock(1,
+				Transaction{Hash: "0x01", From: watched, To: other, Type: "0x2", AccessList: accessList},
+				Transaction{Hash: "0x02", From: watched, To: other, Type: "0x0"},
+			))
+
+			rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson"+query)
+			lines := ndjsonLines(t, rec.Body.String())
+			if len(lines) < 2 {
+				t.Fatalf("got %d lines: %s", len(lines), rec.Body)
+			}
+			got, _ := json.Marshal(lines[0]["accessList"])
+			want, _ := json.Marshal(accessList)
+			if string(got) != string(want) {
+				t.Errorf("accessList = %s, want %s", got, want)
+			}
+			if _, ok := lines[1]["accessList"]; ok {
+				t.Errorf("legacy transaction has an accessList: %v", lines[1])
+			}
+		})
+	}
+}
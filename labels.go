@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// addressLabels maps lowercased addresses to human-readable names, loaded
+// from the -labels file.
+type addressLabels map[string]string
+
+var labels addressLabels
+
+func loadAddressLabels(path string) (addressLabels, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode address labels %s: %v", path, err)
+	}
+
+	l := make(addressLabels, len(raw))
+	for address, label := range raw {
+		l[strings.ToLower(strings.TrimSpace(address))] = label
+	}
+	return l, nil
+}
+
+// label returns the address's label, or "" when it has none.
+func (l addressLabels) label(address string) string {
+	return l[strings.ToLower(address)]
+}
+
+// annotate appends the address's label in parentheses when it has one.
+func (l addressLabels) annotate(address string) string {
+	if label := l.label(address); label != "" {
+		return address + " (" + label + ")"
+	}
+	return address
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLabels swaps in a label registry for the duration of the test.
+func useLabels(t *testing.T, l addressLabels) {
+	t.Helper()
+	previous := labels
+	labels = l
+	t.Cleanup(func() { labels = previous })
+}
+
+func TestLoadAddressLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.json")
+	os.WriteFile(path, []byte(`{" 0x00000000000000000000000000000000000000AA ": "Hot Wallet", "0xbb": "Router"}`), 0o600)
+
+	l, err := loadAddressLabels(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.label(watched); got != "Hot Wallet" {
+		t.Errorf("label(%s) = %q, want the trimmed, lower-cased entry", watched, got)
+	}
+	if got := l.label("0xBB"); got != "Router" {
+		t.Errorf("label(0xBB) = %q", got)
+	}
+	if got := l.annotate("0xcc"); got != "0xcc" {
+		t.Errorf("annotate(0xcc) = %q, want it unchanged", got)
+	}
+	if got := l.annotate("0xbb"); got != "0xbb (Router)" {
+		t.Errorf("annotate(0xbb) = %q", got)
+	}
+
+	os.WriteFile(path, []byte(`["0xaa"]`), 0o600)
+	if _, err := loadAddressLabels(path); err == nil || !strings.Contains(err.Error(), "failed to decode") {
+		t.Errorf("error = %v for a list", err)
+	}
+	if _, err := loadAddressLabels(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestMatchesCarryLabels(t *testing.T) {
+	useLabels(t, addressLabels{watched: "Hot Wallet"})
+	block := testBlock(1, Transaction{Hash: "0x01", From: other, To: strings.ToUpper(watched), Value: "0x0"})
+	m := match{Address: watched, Block: block, Tx: block.Transactions[0]}
+
+	record := newMatchRecord(m)
+	if record.ToLabel != "Hot Wallet" || record.FromLabel != "" {
+		t.Errorf("labels = %q / %q", record.FromLabel, record.ToLabel)
+	}
+
+	var buf bytes.Buffer
+	newTextMatchWriter(&buf).WriteMatch(m)
+	if !strings.Contains(buf.String(), "To: "+strings.ToUpper(watched)+" (Hot Wallet)") || strings.Contains(buf.String(), other+" (") {
+		t.Errorf("text line = %q", buf.String())
+	}
+}
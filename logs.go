@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const transferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+type Log struct {
+	Address          string      `json:"address"`
+	Topics           []string    `json:"topics"`
+	Data             string      `json:"data"`
+	BlockNumber      string      `json:"blockNumber"`
+	TransactionHash  string      `json:"transactionHash"`
+	TransactionIndex string      `json:"transactionIndex"`
+	LogIndex         string      `json:"logIndex"`
+	Removed          bool        `json:"removed"`
+	Decoded          *decodedLog `json:"decoded,omitempty"`
+}
+
+// decodedLog is filled in for the events this parser knows how to read.
+type decodedLog struct {
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+type logFilter struct {
+	Addresses []string
+	FromBlock int64
+	ToBlock   int64
+	Topics    [][]string
+}
+
+// params builds the eth_getLogs filter object. A nil entry in Topics is a
+// wildcard for that position; trailing wildcards are dropped.
+func (f logFilter) params() map[string]interface{} {
+	params := map[string]interface{}{
+		"fromBlock": fmt.Sprintf("0x%x", f.FromBlock),
+		"toBlock":   fmt.Sprintf("0x%x", f.ToBlock),
+	}
+	if len(f.Addresses) > 0 {
+		params["address"] = f.Addresses
+	}
+
+	last := len(f.Topics) - 1
+	for last >= 0 && f.Topics[last] == nil {
+		last--
+	}
+	if last >= 0 {
+		topics := make([]interface{}, last+1)
+		for i, values := range f.Topics[:last+1] {
+			if values != nil {
+				topics[i] = values
+			}
+		}
+		params["topics"] = topics
+	}
+	return params
+}
+
+func isTopic(value string) bool {
+	if len(value) != 66 || !strings.HasPrefix(value, "0x") {
+		return false
+	}
+	for _, c := range value[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTopics reads topic0..topic3. Each is a comma-separated list of
+// alternatives; an empty or missing value matches anything.
+func parseTopics(r *http.Request) ([][]string, error) {
+	topics := make([][]string, 4)
+	for i := range topics {
+		param := r.URL.Query().Get(fmt.Sprintf("topic%d", i))
+		if param == "" {
+			continue
+		}
+		for _, value := range strings.Split(param, ",") {
+			value = strings.ToLower(strings.TrimSpace(value))
+			if !isTopic(value) {
+				return nil, fmt.Errorf("topic%d value %q is not a 32-byte hex topic", i, value)
+			}
+			topics[i] = append(topics[i], value)
+		}
+	}
+	return topics, nil
+}
+
+func getLogs(ctx context.Context, filter logFilter) ([]Log, error) {
+	response, err := sendRPCRequestContext(ctx, "eth_getLogs", []interface{}{filter.params()})
+	if err != nil {
+		return nil, err
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []Log
+	if err := json.Unmarshal(resultBytes, &logs); err != nil {
+		return nil, err
+	}
+
+	for i := range logs {
+		logs[i].Decoded = decodeLog(logs[i])
+	}
+	return logs, nil
+}
+
+// decodeLog understands ERC-20 and ERC-721 Transfer events. For ERC-721 the
+// token id is indexed, so it is read from the fourth topic instead of data.
+func decodeLog(l Log) *decodedLog {
+	if len(l.Topics) < 3 || l.Topics[0] != transferEventTopic || !isTopic(l.Topics[1]) || !isTopic(l.Topics[2]) {
+		return nil
+	}
+
+	word := strings.TrimPrefix(l.Data, "0x")
+	if len(l.Topics) == 4 {
+		word = strings.TrimPrefix(l.Topics[3], "0x")
+	}
+	value, ok := new(big.Int).SetString(word, 16)
+	if !ok {
+		return nil
+	}
+
+	return &decodedLog{
+		Event: "Transfer",
+		From:  topicAddress(l.Topics[1]),
+		To:    topicAddress(l.Topics[2]),
+		Value: value.String(),
+	}
+}
+
+func topicAddress(topic string) string {
+	return "0x" + topic[len(topic)-40:]
+}
+
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	startBlockParam := r.URL.Query().Get("startBlock")
+	endBlockParam := r.URL.Query().Get("endBlock")
+	if startBlockParam == "" || endBlockParam == "" {
+		http.Error(w, "Please provide startBlock and endBlock parameters", http.StatusBadRequest)
+		return
+	}
+
+	filter := logFilter{}
+	var err error
+	filter.FromBlock, err = strconv.ParseInt(startBlockParam, 10, 64)
+	if err != nil || filter.FromBlock < 0 {
+		http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+		return
+	}
+	filter.ToBlock, err = strconv.ParseInt(endBlockParam, 10, 64)
+	if err != nil || filter.ToBlock < filter.FromBlock {
+		http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
+		return
+	}
+
+	for _, param := range r.URL.Query()["address"] {
+		for _, address := range strings.Split(param, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				filter.Addresses = append(filter.Addresses, address)
+			}
+		}
+	}
+
+	filter.Topics, err = parseTopics(r)
+	if err != nil {
+		http.Error(w, "Invalid topic parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs, err := getLogsWithFallback(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Error fetching logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func topicFor(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(address, "0x")
+}
+
+func TestLogFilterParams(t *testing.T) {
+	filter := logFilter{
+		Addresses: []string{watched},
+		FromBlock: 16,
+		ToBlock:   32,
+		Topics:    [][]string{{transferEventTopic}, nil, {topicFor(watched)}, nil},
+	}
+	want := map[string]interface{}{
+		"fromBlock": "0x10",
+		"toBlock":   "0x20",
+		"address":   []string{watched},
+		"topics":    []interface{}{[]string{transferEventTopic}, nil, []string{topicFor(watched)}},
+	}
+	if got := filter.params(); !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %#v, want %#v", got, want)
+	}
+
+	if _, ok := (logFilter{Topics: make([][]string, 4)}).params()["topics"]; ok {
+		t.Error("all-wildcard topics were sent")
+	}
+}
+
+func TestDecodeLog(t *testing.T) {
+	erc20 := Log{Topics: []string{transferEventTopic, topicFor(watched), topicFor(other)}, Data: "0x" + fmt.Sprintf("%064x", 1000)}
+	if got := decodeLog(erc20); got == nil || *got != (decodedLog{Event: "Transfer", From: watched, To: other, Value: "1000"}) {
+		t.Errorf("ERC-20 transfer = %+v", got)
+	}
+
+	erc721 := Log{Topics: []string{transferEventTopic, topicFor(watched), topicFor(other), fmt.Sprintf("0x%064x", 7)}, Data: "0x"}
+	if got := decodeLog(erc721); got == nil || got.Value != "7" {
+		t.Errorf("ERC-721 transfer = %+v", got)
+	}
+
+	if got := decodeLog(Log{Topics: []string{fmt.Sprintf("0x%064x", 1)}}); got != nil {
+		t.Errorf("other event decoded as %+v", got)
+	}
+}
+
+func TestLogsHandler(t *testing.T) {
+	node := newFakeNode(t)
+	var filters []map[string]interface{}
+	node.handle("eth_getLogs", func(params []interface{}) (interface{}, error) {
+		filters = append(filters, params[0].(map[string]interface{}))
+		return []Log{{Address: other, Topics: []string{transferEventTopic, topicFor(watched), topicFor(other)}, Data: fmt.Sprintf("0x%064x", 5)}}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	logsHandler(rec, httptest.NewRequest(http.MethodGet, "/logs?startBlock=1&endBlock=2&address="+other+"&topic0=0x"+strings.ToUpper(transferEventTopic[2:]), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var logs []Log
+	if err := json.NewDecoder(rec.Body).Decode(&logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Decoded == nil || logs[0].Decoded.Value != "5" {
+		t.Errorf("logs = %+v", logs)
+	}
+	if len(filters) != 1 || fmt.Sprint(filters[0]["topics"]) != fmt.Sprint([]interface{}{[]interface{}{transferEventTopic}}) {
+		t.Errorf("filters sent = %v", filters)
+	}
+}
+
+func TestLogsHandlerRejectsBadTopic(t *testing.T) {
+	rec := httptest.NewRecorder()
+	logsHandler(rec, httptest.NewRequest(http.MethodGet, "/logs?startBlock=1&endBlock=2&topic2=0x1234", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if body := rec.Body.String(); !strings.HasPrefix(body, "Invalid topic parameter: topic2 value \"0x1234\"") {
+		t.Errorf("body = %q", body)
+	}
+}
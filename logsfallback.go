@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// logsFallbackMaxBlocks, set with -logs-fallback-max-blocks, is the largest
+// range /logs will rebuild from receipts when eth_getLogs fails. Zero turns
+// the fallback off.
+var logsFallbackMaxBlocks int64 = 1000
+
+// receiptBatchBlocks is how many blocks' receipts are asked for per batch.
+const receiptBatchBlocks = 20
+
+// getLogsWithFallback answers from eth_getLogs. A range the endpoint
+// refuses as too broad (too many blocks or results) is split in half and
+// each half asked for again. Once a refused range is within
+// logsFallbackMaxBlocks, or when eth_getLogs is missing altogether, it is
+// rebuilt from the receipts of its blocks. Other errors, rate limits among
+// them, are returned as they are.
+func getLogsWithFallback(ctx context.Context, filter logFilter) ([]Log, error) {
+	logs, err := getLogs(ctx, filter)
+	if err == nil {
+		return logs, nil
+	}
+	tooBroad := logQueryTooBroad(err)
+	if !tooBroad && !isMethodUnsupported(err) {
+		return nil, err
+	}
+
+	span := filter.ToBlock - filter.FromBlock + 1
+	if span <= logsFallbackMaxBlocks {
+		log.Printf("eth_getLogs failed for blocks %d-%d, scanning receipts instead: %v", filter.FromBlock, filter.ToBlock, err)
+		return logsFromReceipts(ctx, filter)
+	}
+	if !tooBroad || span == 1 {
+		return nil, err
+	}
+
+	first, second := filter, filter
+	first.ToBlock = filter.FromBlock + span/2 - 1
+	second.FromBlock = first.ToBlock + 1
+	logs, err = getLogsWithFallback(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	more, err := getLogsWithFallback(ctx, second)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, more...), nil
+}
+
+// logQueryTooBroad reports whether eth_getLogs refused a query for its
+// size, which a narrower query gets past. Providers say so only in the
+// message, and some use the same code for rate limits, so those are ruled
+// out first.
+func logQueryTooBroad(err error) bool {
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	message := strings.ToLower(rpcErr.Message)
+	for _, hint := range []string{"rate limit", "too many requests", "capacity"} {
+		if strings.Contains(message, hint) {
+			return false
+		}
+	}
+	for _, hint := range []string{"range", "results", "too large", "response size", "limit exceeded"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func logsFromReceipts(ctx context.Context, filter logFilter) ([]Log, error) {
+	logs := []Log{}
+	for from := filter.FromBlock; from <= filter.ToBlock; from += receiptBatchBlocks {
+		to := min(from+receiptBatchBlocks-1, filter.ToBlock)
+		receipts, err := rangeReceipts(ctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				if filter.matches(l) {
+					l.Decoded = decodeLog(l)
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// rangeReceipts returns every receipt from blocks from to to, in block
+// order, using eth_getBlockReceipts or, where that is missing, each
+// block's transactions and eth_getTransactionReceipt.
+func rangeReceipts(ctx context.Context, from, to int64) ([]*TransactionReceipt, error) {
+	var calls []rpcCall
+	for number := from; number <= to; number++ {
+		calls = append(calls, rpcCall{Method: "eth_getBlockReceipts", Params: []interface{}{fmt.Sprintf("0x%x", number)}})
+	}
+	results, err := sendRPCBatch(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipts []*TransactionReceipt
+	for i, result := range results {
+		number := from + int64(i)
+		if isMethodUnsupported(result.Err) {
+			blockReceipts, err := blockReceiptsByTransaction(ctx, number)
+			if err != nil {
+				return nil, err
+			}
+			receipts = append(receipts, blockReceipts...)
+			continue
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		var list []*TransactionReceipt
+		if err := decodeResult(result.Response, &list); err != nil {
+			return nil, err
+		}
+		for _, receipt := range list {
+			if receipt != nil {
+				receipts = append(receipts, receipt)
+			}
+		}
+	}
+	return receipts, nil
+}
+
+func blockReceiptsByTransaction(ctx context.Context, number int64) ([]*TransactionReceipt, error) {
+	block, err := getBlockHeader(ctx, fmt.Sprintf("0x%x", number))
+	if err != nil {
+		return nil, err
+	}
+	if len(block.TransactionHashes) == 0 {
+		return nil, nil
+	}
+
+	calls := make([]rpcCall, len(block.TransactionHashes))
+	for i, hash := range block.TransactionHashes {
+		calls[i] = rpcCall{Method: "eth_getTransactionReceipt", Params: []interface{}{hash}}
+	}
+	results, err := sendRPCBatch(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	var receipts []*TransactionReceipt
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		var receipt *TransactionReceipt
+		if err := decodeResult(result.Response, &receipt); err != nil {
+			return nil, err
+		}
+		if receipt != nil {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+// matches applies the filter the way eth_getLogs does: any of Addresses,
+// and at each topic position any of the listed values, nil matching all.
+func (f logFilter) matches(l Log) bool {
+	if len(f.Addresses) > 0 && !containsFold(f.Addresses, l.Address) {
+		return false
+	}
+	for i, values := range f.Topics {
+		if values == nil {
+			continue
+		}
+		if i >= len(l.Topics) || !containsFold(values, l.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
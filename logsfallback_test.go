@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLogFilterMatches(t *testing.T) {
+	transfer := Log{Address: other, Topics: []string{transferEventTopic, topicFor(watched), topicFor(other)}}
+	tests := []struct {
+		name   string
+		filter logFilter
+		want   bool
+	}{
+		{name: "no filter", filter: logFilter{}, want: true},
+		{name: "address in any case", filter: logFilter{Addresses: []string{"0xCC", "0x00000000000000000000000000000000000000BB"}}, want: true},
+		{name: "other address", filter: logFilter{Addresses: []string{watched}}, want: false},
+		{name: "topic wildcard", filter: logFilter{Topics: [][]string{nil, {topicFor(watched)}}}, want: true},
+		{name: "any of a position", filter: logFilter{Topics: [][]string{{fmt.Sprintf("0x%064x", 1), transferEventTopic}}}, want: true},
+		{name: "wrong topic", filter: logFilter{Topics: [][]string{nil, nil, {topicFor(watched)}}}, want: false},
+		{name: "topic past the end", filter: logFilter{Topics: [][]string{nil, nil, nil, {topicFor(watched)}}}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(transfer); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// refuseGetLogs makes eth_getLogs fail the way providers reject big queries.
+func refuseGetLogs(node *fakeNode) {
+	node.handle("eth_getLogs", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32005, Message: "query returned more than 10000 results"}
+	})
+}
+
+func receiptWithLogs(hash string, logs ...Log) *TransactionReceipt {
+	for i := range logs {
+		logs[i].TransactionHash = hash
+	}
+	return &TransactionReceipt{TransactionHash: hash, Logs: logs}
+}
+
+func TestLogsFallBackToBlockReceipts(t *testing.T) {
+	node := newFakeNode(t)
+	refuseGetLogs(node)
+	wanted := Log{Address: other, Topics: []string{transferEventTopic, topicFor(watched), topicFor(other)}, Data: fmt.Sprintf("0x%064x", 5)}
+	unrelated := Log{Address: "0xcc", Topics: []string{transferEventTopic}}
+	node.handle("eth_getBlockReceipts", func(params []interface{}) (interface{}, error) {
+		switch params[0] {
+		case "0x1":
+			return []*TransactionReceipt{receiptWithLogs("0x01", wanted, unrelated)}, nil
+		case "0x2":
+			return []*TransactionReceipt{receiptWithLogs("0x02"), receiptWithLogs("0x03", wanted)}, nil
+		}
+		return []*TransactionReceipt{}, nil
+	})
+
+	logs, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=3&address="+other)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(logs) != 2 || logs[0].TransactionHash != "0x01" || logs[1].TransactionHash != "0x03" {
+		t.Fatalf("logs = %+v, want the matching log of 0x01 and 0x03", logs)
+	}
+	if logs[0].Decoded == nil || logs[0].Decoded.Value != "5" {
+		t.Errorf("fallback log not decoded: %+v", logs[0])
+	}
+	if calls := node.callCount("eth_getBlockReceipts"); calls != 3 {
+		t.Errorf("eth_getBlockReceipts called %d times, want once per block", calls)
+	}
+}
+
+func TestLogsFallBackToTransactionReceipts(t *testing.T) {
+	node := newFakeNode(t)
+	refuseGetLogs(node)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01"}, Transaction{Hash: "0x02"}),
+		testBlock(2),
+	)
+	node.handle("eth_getTransactionReceipt", func(params []interface{}) (interface{}, error) {
+		hash := params[0].(string)
+		return receiptWithLogs(hash, Log{Address: other, Topics: []string{transferEventTopic}}), nil
+	})
+
+	logs, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(logs) != 2 || logs[0].TransactionHash != "0x01" || logs[1].TransactionHash != "0x02" {
+		t.Errorf("logs = %+v", logs)
+	}
+}
+
+func TestLogsFallbackIsBounded(t *testing.T) {
+	previous := logsFallbackMaxBlocks
+	t.Cleanup(func() { logsFallbackMaxBlocks = previous })
+
+	node := newFakeNode(t)
+	refuseGetLogs(node)
+	node.result("eth_getBlockReceipts", []*TransactionReceipt{})
+
+	logsFallbackMaxBlocks = 0
+	if _, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=3"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("fallback off: status = %d, want the eth_getLogs error", rec.Code)
+	}
+	if calls := node.callCount("eth_getBlockReceipts"); calls != 0 {
+		t.Errorf("eth_getBlockReceipts called %d times with the fallback off", calls)
+	}
+
+	// 1-3 splits into 1 and 2-3, both short enough for receipts.
+	logsFallbackMaxBlocks = 2
+	if _, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=3"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d once split within the limit: %s", rec.Code, rec.Body)
+	}
+	if calls := node.callCount("eth_getBlockReceipts"); calls != 3 {
+		t.Errorf("eth_getBlockReceipts called %d times, want once per block", calls)
+	}
+}
+
+func TestLogsSplitRangesTheEndpointRefuses(t *testing.T) {
+	previous := logsFallbackMaxBlocks
+	logsFallbackMaxBlocks = 0
+	t.Cleanup(func() { logsFallbackMaxBlocks = previous })
+
+	node := newFakeNode(t)
+	var asked []string
+	node.handle("eth_getLogs", func(params []interface{}) (interface{}, error) {
+		filter := params[0].(map[string]interface{})
+		from, _ := parseQuantity(filter["fromBlock"].(string))
+		to, _ := parseQuantity(filter["toBlock"].(string))
+		asked = append(asked, fmt.Sprintf("%d-%d", from, to))
+		if to.Int64()-from.Int64()+1 > 2 {
+			return nil, &rpcError{Code: -32602, Message: "block range is too large"}
+		}
+		var logs []Log
+		for number := from.Int64(); number <= to.Int64(); number++ {
+			logs = append(logs, Log{Address: other, BlockNumber: fmt.Sprintf("0x%x", number)})
+		}
+		return logs, nil
+	})
+
+	logs, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=5")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var blocks []string
+	for _, l := range logs {
+		blocks = append(blocks, l.BlockNumber)
+	}
+	if fmt.Sprint(blocks) != "[0x1 0x2 0x3 0x4 0x5]" {
+		t.Errorf("logs from blocks %v, want every block in order", blocks)
+	}
+	if fmt.Sprint(asked) != "[1-5 1-2 3-5 3-3 4-5]" {
+		t.Errorf("asked for %v", asked)
+	}
+}
+
+func TestLogsReturnOtherErrorsAsTheyAre(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_getLogs", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32005, Message: "daily request count exceeded, request rate limited"}
+	})
+	node.result("eth_getBlockReceipts", []*TransactionReceipt{})
+
+	if _, rec := getJSON[[]Log](t, logsHandler, "/logs?startBlock=1&endBlock=3"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want the rate limit error", rec.Code)
+	}
+	if calls := node.callCount("eth_getLogs"); calls != 1 {
+		t.Errorf("eth_getLogs called %d times, want no retries of narrower ranges", calls)
+	}
+	if calls := node.callCount("eth_getBlockReceipts"); calls != 0 {
+		t.Errorf("eth_getBlockReceipts called %d times for a rate limit", calls)
+	}
+}
@@ -2,68 +2,285 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"math"
+	"math/big"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const ethEndpoint = "https://cloudflare-eth.com"
 
+const consoleProgressInterval = 30 * time.Second
+
 type Transaction struct {
 	Hash        string `json:"hash"`
 	From        string `json:"from"`
 	To          string `json:"to"`
 	Value       string `json:"value"`
+	GasPrice    string `json:"gasPrice"`
+	Gas         string `json:"gas"`
+	Input       string `json:"input"`
 	BlockNumber string `json:"blockNumber"`
+
+	TransactionIndex     string `json:"transactionIndex,omitempty"`
+	Nonce                string `json:"nonce,omitempty"`
+	Type                 string `json:"type,omitempty"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+
+	AccessList []accessListEntry `json:"accessList,omitempty"`
+
+	// Signature fields. Typed transactions carry yParity, and usually v
+	// with the same value too.
+	V       string `json:"v,omitempty"`
+	R       string `json:"r,omitempty"`
+	S       string `json:"s,omitempty"`
+	YParity string `json:"yParity,omitempty"`
+}
+
+// accessListEntry is one EIP-2930 access list item, carried by type 1 and
+// type 2 transactions.
+type accessListEntry struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storageKeys"`
 }
 
 type BlockWithTransactions struct {
-	Number       string        `json:"number"`
-	Transactions []Transaction `json:"transactions"`
+	Number        string        `json:"number"`
+	Hash          string        `json:"hash"`
+	ParentHash    string        `json:"parentHash"`
+	Timestamp     string        `json:"timestamp"`
+	BaseFeePerGas string        `json:"baseFeePerGas,omitempty"`
+	GasUsed       string        `json:"gasUsed,omitempty"`
+	GasLimit      string        `json:"gasLimit,omitempty"`
+	Transactions  []Transaction `json:"transactions"`
+	Withdrawals   []Withdrawal  `json:"withdrawals,omitempty"`
+
+	// TransactionHashes is set instead of Transactions when the node
+	// returned bare hashes, as it does for full=false.
+	TransactionHashes []string `json:"transactionHashes,omitempty"`
+}
+
+func (b *BlockWithTransactions) UnmarshalJSON(data []byte) error {
+	type plainBlock BlockWithTransactions
+	var raw struct {
+		plainBlock
+		Transactions json.RawMessage `json:"transactions"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*b = BlockWithTransactions(raw.plainBlock)
+	b.Transactions, b.TransactionHashes = nil, nil
+	if len(raw.Transactions) == 0 || string(raw.Transactions) == "null" {
+		return nil
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(raw.Transactions, &elements); err != nil {
+		return err
+	}
+	for _, element := range elements {
+		tx, hash, err := decodeTransactionElement(element)
+		switch {
+		case err != nil:
+			return err
+		case hash != "":
+			b.TransactionHashes = append(b.TransactionHashes, hash)
+		default:
+			b.Transactions = append(b.Transactions, tx)
+		}
+	}
+	return nil
+}
+
+// decodeTransactionElement decodes one element of a block's transactions
+// array, which is either a full transaction object or, for full=false, a
+// hash string. Only one of the results is set.
+func decodeTransactionElement(element json.RawMessage) (Transaction, string, error) {
+	var tx Transaction
+	if len(element) > 0 && element[0] == '"' {
+		var hash string
+		err := json.Unmarshal(element, &hash)
+		return tx, hash, err
+	}
+	err := json.Unmarshal(element, &tx)
+	return tx, "", err
 }
 
 type RequestPayload struct {
 	Jsonrpc string        `json:"jsonrpc"`
 	Method  string        `json:"method"`
 	Params  []interface{} `json:"params"`
-	ID      int           `json:"id"`
+	ID      int64         `json:"id"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+var rpcRequestID atomic.Int64
+
+// validateRPCResponse checks that a response answers the request. An error
+// reply may carry a null id, as JSON-RPC 2.0 requires when the node
+// couldn't read the request's.
+func validateRPCResponse(responsePayload map[string]interface{}, requestID int64) error {
+	if version, _ := responsePayload["jsonrpc"].(string); version != "2.0" {
+		return fmt.Errorf("unexpected jsonrpc version in response: %v", responsePayload["jsonrpc"])
+	}
+
+	if responsePayload["error"] != nil && responsePayload["id"] == nil {
+		return nil
+	}
+	if id, ok := responsePayload["id"].(float64); !ok || int64(id) != requestID {
+		return fmt.Errorf("response id %v does not match request id %d", responsePayload["id"], requestID)
+	}
+
+	return nil
 }
 
 func sendRPCRequest(method string, params []interface{}) (map[string]interface{}, error) {
-	requestPayload := RequestPayload{
+	return sendRPCRequestContext(context.Background(), method, params)
+}
+
+func sendRPCRequestContext(ctx context.Context, method string, params []interface{}) (map[string]interface{}, error) {
+	resp, requestID, err := postRPCRequest(ctx, method, params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var responsePayload map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&responsePayload); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %v", err)
+	}
+
+	if err := validateRPCResponse(responsePayload, requestID); err != nil {
+		return nil, err
+	}
+
+	if err := rpcErrorFromPayload(responsePayload); err != nil {
+		return nil, err
+	}
+
+	return responsePayload, nil
+}
+
+// postRPCRequest sends a single JSON-RPC call and returns the JSON response
+// for the caller to decode and close.
+func postRPCRequest(ctx context.Context, method string, params []interface{}) (*http.Response, int64, error) {
+	req, requestID, err := newRPCHTTPRequest(ctx, method, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := doRPCRequest(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp, requestID, nil
+}
+
+// doRPCRequest sends a prepared request, single or batch, once the rate
+// limiter allows it.
+func doRPCRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	resp, err := rateLimitedDo(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "application/json" {
+		defer resp.Body.Close()
+		body, _ := readBodyForLog(resp.Body)
+		return nil, fmt.Errorf("received non-JSON response: %s", body)
+	}
+
+	return resp, nil
+}
+
+// rateLimitedDo sends req with rpcClient once the rate limiter allows it,
+// returning whatever the endpoint answered.
+func rateLimitedDo(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if rpcLimiter != nil {
+		if err := rpcLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return rpcClient.Do(req)
+}
+
+func newRPCPayload(method string, params []interface{}) RequestPayload {
+	return RequestPayload{
 		Jsonrpc: "2.0",
 		Method:  method,
 		Params:  params,
-		ID:      1,
+		ID:      rpcRequestID.Add(1),
 	}
+}
 
-	payloadBytes, err := json.Marshal(requestPayload)
+func newRPCHTTPRequest(ctx context.Context, method string, params []interface{}) (*http.Request, int64, error) {
+	requestPayload := newRPCPayload(method, params)
+	req, err := newRPCPayloadRequest(ctx, requestPayload)
+	return req, requestPayload.ID, err
+}
+
+// newRPCPayloadRequest builds the HTTP request for a single payload or a
+// batch of them.
+func newRPCPayloadRequest(ctx context.Context, payload interface{}) (*http.Request, error) {
+	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Post(ethEndpoint, "application/json", bytes.NewBuffer(payloadBytes))
+	creds := rpcEndpointCredentials()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.Endpoint, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	contentType := resp.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		bodyBytes, _ := io.ReadAll(resp.Body) // Use io.ReadAll instead of ioutil.ReadAll
-		return nil, fmt.Errorf("received non-JSON response: %s", string(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	if creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	}
+	if rpcSigner != nil {
+		if err := rpcSigner.Sign(req, payloadBytes); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %v", err)
+		}
 	}
 
-	var responsePayload map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&responsePayload); err != nil {
-		return nil, fmt.Errorf("failed to decode JSON response: %v", err)
+	return req, nil
+}
+
+func rpcErrorFromPayload(responsePayload map[string]interface{}) error {
+	if responsePayload["error"] == nil {
+		return nil
 	}
 
-	return responsePayload, nil
+	errorBytes, err := json.Marshal(responsePayload["error"])
+	if err != nil {
+		return err
+	}
+	var rpcErr rpcError
+	if err := json.Unmarshal(errorBytes, &rpcErr); err != nil {
+		return fmt.Errorf("failed to decode JSON-RPC error: %v", err)
+	}
+	return &rpcErr
 }
 
 func getLatestBlockNumber() (int64, error) {
@@ -77,17 +294,39 @@ func getLatestBlockNumber() (int64, error) {
 		return 0, fmt.Errorf("invalid response format for block number")
 	}
 
-	blockNumber, err := strconv.ParseInt(blockHex[2:], 16, 64)
+	blockNumber, err := parseQuantity(blockHex)
 	if err != nil {
 		return 0, err
 	}
 
-	return blockNumber, nil
+	return blockNumber.Int64(), nil
+}
+
+func getBlockByNumber(ctx context.Context, blockNumber string) (*BlockWithTransactions, error) {
+	return fetchBlockByNumber(ctx, blockNumber, true)
+}
+
+// getBlockHeader fetches a block without transaction bodies; only their
+// hashes, in TransactionHashes, come back.
+func getBlockHeader(ctx context.Context, blockNumber string) (*BlockWithTransactions, error) {
+	return fetchBlockByNumber(ctx, blockNumber, false)
+}
+
+func fetchBlockByNumber(ctx context.Context, blockNumber string, full bool) (*BlockWithTransactions, error) {
+	if block, ok := recentBlocks.get(blockNumber, full); ok {
+		return block, nil
+	}
+	if blockFlights != nil {
+		return blockFlights.do(ctx, blockNumber, full, func() (*BlockWithTransactions, error) {
+			return requestBlockByNumber(ctx, blockNumber, full)
+		})
+	}
+	return requestBlockByNumber(ctx, blockNumber, full)
 }
 
-func getBlockByNumber(blockNumber string) (*BlockWithTransactions, error) {
-	params := []interface{}{blockNumber, true}
-	response, err := sendRPCRequest("eth_getBlockByNumber", params)
+func requestBlockByNumber(ctx context.Context, blockNumber string, full bool) (*BlockWithTransactions, error) {
+	params := []interface{}{blockNumber, full}
+	response, err := sendRPCRequestContext(ctx, "eth_getBlockByNumber", params)
 	if err != nil {
 		return nil, err
 	}
@@ -105,71 +344,723 @@ func getBlockByNumber(blockNumber string) (*BlockWithTransactions, error) {
 	return &block, nil
 }
 
-func fetchTransactions(address string, startBlock, endBlock int64) {
-	for i := startBlock; i <= endBlock; i++ {
-		blockNumberHex := fmt.Sprintf("0x%x", i)
+func fetchTransactions(ctx context.Context, addresses []string, startBlock, endBlock int64, opts scanOptions, out matchWriter) (scanSummary, error) {
+	defer opts.batchStoreWrites()()
 
-		block, err := getBlockByNumber(blockNumberHex)
-		if err != nil {
-			log.Printf("Error fetching block %s: %v", blockNumberHex, err)
-			continue
-		}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.ReorderBuffer < 1 {
+		opts.ReorderBuffer = opts.Concurrency
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = defaultProgressInterval
+	}
 
-		for _, tx := range block.Transactions {
-			if tx.From == address || tx.To == address {
-				fmt.Printf("Transaction: Block %s | Hash: %s | From: %s | To: %s | Value: %s ETH\n",
-					block.Number, tx.Hash, tx.From, tx.To, convertWeiToEther(tx.Value))
-			}
+	s := &scanner{
+		addresses:    addresses,
+		opts:         opts,
+		out:          out,
+		duplicates:   newDuplicateDetector(),
+		started:      time.Now(),
+		total:        endBlock - startBlock + 1,
+		lastReported: -1,
+		summary:      scanSummary{FailedBlocks: []int64{}},
+	}
+	if opts.GasUtilization {
+		s.summary.GasUtilization = &gasUtilization{}
+	}
+	if opts.Events && opts.EventSample < 1 {
+		s.summary.EventSample = opts.EventSample
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeErr error
+	emitter := newOrderedEmitter(startBlock, opts.ReorderBuffer, func(result *blockResult) {
+		if writeErr != nil || ctx.Err() != nil {
+			return
+		}
+		s.processed++
+		s.reportProgress(false)
+		if result.err != nil {
+			log.Printf("Error fetching block 0x%x, retrying at the end of the scan: %v", result.number, result.err)
+			s.deferredBlocks = append(s.deferredBlocks, result.number)
+			s.previousHash = ""
+			return
+		}
+		if s.opts.VerifyContinuity {
+			s.checkContinuity(result)
+		}
+		if err := s.writeBlock(result); err != nil {
+			writeErr = err
+			cancel()
 		}
+	})
 
-		time.Sleep(5 * time.Second)
+	throttle := newBlockThrottle(opts.MaxBlocksPerSecond)
+	fetchAll := fetchRange(fetchWithOwnWorkers)
+	if fetchWorkers != nil {
+		fetchAll = fetchWorkers.fetch
+	}
+	fetchAll(ctx, startBlock, endBlock, opts.Concurrency, throttle, func(number int64) bool {
+		result := s.fetchBlockWithRetry(ctx, number)
+		emitter.Submit(result)
+		return result.err == nil
+	})
+
+	if writeErr != nil {
+		return s.finish(), writeErr
+	}
+	s.reportProgress(true)
+
+	// Blocks that exhausted their retries get one more round once the rest of
+	// the range is done, so transient errors don't cost data. Their matches
+	// are emitted after the in-order results.
+	for _, number := range s.deferredBlocks {
+		if err := throttle.wait(ctx); err != nil {
+			break
+		}
+		result := s.fetchBlockWithRetry(ctx, number)
+		if result.err != nil {
+			log.Printf("Error fetching block 0x%x on final pass, giving up: %v", number, result.err)
+			s.summary.FailedBlocks = append(s.summary.FailedBlocks, number)
+			continue
+		}
+		if err := s.writeBlock(result); err != nil {
+			return s.finish(), err
+		}
+		pause(ctx, blockPause)
 	}
+
+	return s.finish(), ctx.Err()
 }
 
 func convertWeiToEther(weiValue string) string {
-	wei, _ := strconv.ParseInt(weiValue[2:], 16, 64)
-	return fmt.Sprintf("%f", float64(wei)/1e18)
+	wei, err := parseQuantity(weiValue)
+	if err != nil {
+		wei = new(big.Int)
+	}
+	return formatEther(wei)
 }
 
-func fetchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
-	address := r.URL.Query().Get("address")
+func convertWeiToGwei(weiValue string) string {
+	wei, err := parseQuantity(weiValue)
+	if err != nil {
+		wei = new(big.Int)
+	}
+	return formatGwei(wei)
+}
+
+type scanRequest struct {
+	Addresses  []string
+	StartBlock int64
+	EndBlock   int64
+	Options    scanOptions
+
+	// USD scans price matches at the ETH price fetched when the scan starts.
+	USD bool
+
+	// ChainID labels matches with the endpoint's chain ID.
+	ChainID bool
+
+	// Incremental scans resume from each address's stored checkpoint and
+	// advance it when they finish.
+	Incremental bool
+}
+
+// parseScanRequest reads the address, block range and scan options shared by
+// the scanning endpoints. On failure it writes the error response itself.
+func parseScanRequest(w http.ResponseWriter, r *http.Request) (scanRequest, bool) {
+	var addresses []string
+	for _, param := range r.URL.Query()["address"] {
+		for _, address := range strings.Split(param, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
 	startBlockParam := r.URL.Query().Get("startBlock")
 	endBlockParam := r.URL.Query().Get("endBlock")
+	incremental := r.URL.Query().Get("sinceLastScan") == "true"
 
-	if address == "" || startBlockParam == "" || endBlockParam == "" {
+	if len(addresses) == 0 || (!incremental && (startBlockParam == "" || endBlockParam == "")) {
 		http.Error(w, "Please provide address, startBlock, and endBlock parameters", http.StatusBadRequest)
-		return
+		return scanRequest{}, false
 	}
 
-	startBlockRange, err := strconv.ParseInt(startBlockParam, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
-		return
+	var err error
+	startBlockRange := incrementalStartBlock
+	if startBlockParam != "" {
+		startBlockRange, err = strconv.ParseInt(startBlockParam, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid startBlock parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
 	}
 
-	endBlockRange, err := strconv.ParseInt(endBlockParam, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
-		return
+	endBlockRange := int64(math.MaxInt64)
+	if endBlockParam != "" {
+		endBlockRange, err = strconv.ParseInt(endBlockParam, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid endBlock parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+
+	opts := scanOptions{Retries: defaultBlockRetries}
+	if retriesParam := r.URL.Query().Get("retries"); retriesParam != "" {
+		opts.Retries, err = strconv.Atoi(retriesParam)
+		if err != nil || opts.Retries < 0 {
+			http.Error(w, "Invalid retries parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+	if concurrencyParam := r.URL.Query().Get("concurrency"); concurrencyParam != "" {
+		opts.Concurrency, err = strconv.Atoi(concurrencyParam)
+		if err != nil || opts.Concurrency < 1 {
+			http.Error(w, "Invalid concurrency parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+	if rateParam := r.URL.Query().Get("maxBlocksPerSecond"); rateParam != "" {
+		opts.MaxBlocksPerSecond, err = strconv.ParseFloat(rateParam, 64)
+		if err != nil || opts.MaxBlocksPerSecond <= 0 {
+			http.Error(w, "Invalid maxBlocksPerSecond parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+	if limitParam := r.URL.Query().Get("emitLimit"); limitParam != "" {
+		opts.EmitLimit, err = strconv.ParseInt(limitParam, 10, 64)
+		if err != nil || opts.EmitLimit < 1 {
+			http.Error(w, "Invalid emitLimit parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+	opts.SelfDestructs = r.URL.Query().Get("selfDestructs") == "true"
+	opts.Withdrawals = r.URL.Query().Get("withdrawals") == "true"
+	opts.StreamDecode = r.URL.Query().Get("streamDecode") == "true"
+	opts.Receipts = r.URL.Query().Get("receipts") == "true"
+	opts.VerifyContinuity = r.URL.Query().Get("verifyContinuity") == "true"
+	opts.GasUtilization = r.URL.Query().Get("gasUtilization") == "true"
+	opts.RawTransactions = r.URL.Query().Get("rawTransactions") == "true"
+	opts.Events = r.URL.Query().Get("events") == "true"
+	opts.EventSample = 1
+	if sampleParam := r.URL.Query().Get("eventSample"); sampleParam != "" {
+		opts.EventSample, err = strconv.ParseFloat(sampleParam, 64)
+		if err != nil || opts.EventSample <= 0 || opts.EventSample > 1 {
+			http.Error(w, "Invalid eventSample parameter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+		opts.Events = true
+	}
+	if r.URL.Query().Get("codeSize") == "true" {
+		opts.CodeSizes = newCodeSizeCache()
+	}
+	if r.URL.Query().Get("store") == "true" {
+		opts.Store = store
+	}
+
+	switch method := r.URL.Query().Get("method"); method {
+	case "traceFilter":
+		opts.TraceFilter = true
+	case "", "blocks":
+	default:
+		http.Error(w, "Invalid method parameter", http.StatusBadRequest)
+		return scanRequest{}, false
+	}
+
+	if filterParam := r.URL.Query().Get("filter"); filterParam != "" {
+		opts.Filter, err = parseFilter(filterParam)
+		if err != nil {
+			http.Error(w, "Invalid filter parameter: "+err.Error(), http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+	}
+	if typeParams := r.URL.Query()["type"]; len(typeParams) > 0 {
+		// Traces don't say what type the transaction was.
+		if opts.TraceFilter {
+			http.Error(w, "The type parameter can't be used with method=traceFilter", http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+		typeFilter, err := parseTypeFilter(typeParams)
+		if err != nil {
+			http.Error(w, "Invalid type parameter: "+err.Error(), http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+		if filter := opts.Filter; filter != nil {
+			opts.Filter = func(tx Transaction) bool { return filter(tx) && typeFilter(tx) }
+		} else {
+			opts.Filter = typeFilter
+		}
+	}
+
+	if !allowScan(w, r) {
+		return scanRequest{}, false
 	}
 
 	latestBlock, err := getLatestBlockNumber()
 	if err != nil {
 		http.Error(w, "Error fetching latest block number: "+err.Error(), http.StatusInternalServerError)
-		return
+		return scanRequest{}, false
 	}
 
 	if endBlockRange > latestBlock {
 		endBlockRange = latestBlock
 	}
+	opts.Head = latestBlock
+
+	if incremental {
+		startBlockRange, err = incrementalStart(store, addresses, startBlockRange)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return scanRequest{}, false
+		}
+		opts.Store = store
+	}
+
+	return scanRequest{
+		Addresses:   addresses,
+		StartBlock:  startBlockRange,
+		EndBlock:    endBlockRange,
+		Options:     opts,
+		USD:         r.URL.Query().Get("usd") == "true",
+		ChainID:     r.URL.Query().Get("chainId") == "true",
+		Incremental: incremental,
+	}, true
+}
+
+// checkWriter answers 400 when the scan asks for self-destructs or
+// withdrawals that out has no way to report, rather than fetching them only
+// to drop them.
+func (s scanRequest) checkWriter(w http.ResponseWriter, out matchWriter) bool {
+	if _, ok := out.(selfDestructWriter); s.Options.SelfDestructs && !ok {
+		http.Error(w, "selfDestructs=true is not supported by this output", http.StatusBadRequest)
+		return false
+	}
+	if _, ok := out.(withdrawalWriter); s.Options.Withdrawals && !ok {
+		http.Error(w, "withdrawals=true is not supported by this output", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s scanRequest) run(ctx context.Context, out matchWriter) (scanSummary, error) {
+	if s.USD {
+		s.Options.USDPrice = scanPrice(ctx, prices)
+	}
+	if s.ChainID {
+		id, err := chainIDs.get(ctx)
+		if err != nil {
+			return scanSummary{FailedBlocks: []int64{}}, fmt.Errorf("failed to fetch chain ID: %v", err)
+		}
+		s.Options.ChainID = id
+	}
+	summary, err := s.scan(ctx, out)
+	if s.Incremental && err == nil {
+		advanceCheckpoints(store, s.Addresses, s.StartBlock, s.EndBlock, summary)
+	}
+	return summary, err
+}
+
+func (s scanRequest) scan(ctx context.Context, out matchWriter) (scanSummary, error) {
+	if s.Options.TraceFilter {
+		summary, err := fetchTransfersByTraceFilter(ctx, s.Addresses, s.StartBlock, s.EndBlock, s.Options, out)
+		if !isMethodUnsupported(err) || summary.Matches > 0 {
+			return summary, err
+		}
+		log.Printf("Endpoint does not support trace_filter, falling back to a full block scan: %v", err)
+	}
+	return fetchTransactions(ctx, s.Addresses, s.StartBlock, s.EndBlock, s.Options, out)
+}
+
+func (s scanRequest) addressList() string {
+	return strings.Join(s.Addresses, ", ")
+}
+
+func fetchTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	scan, ok := parseScanRequest(w, r)
+	if !ok {
+		return
+	}
+
+	casing, err := parseFieldCase(r.URL.Query().Get("fieldCase"))
+	if err != nil {
+		http.Error(w, "Invalid fieldCase parameter", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("uniqueCounterparties") == "true" {
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(uniqueCounterparties(scan.Addresses, collector.matches))
+		return
+	}
+
+	if r.URL.Query().Get("nonceGaps") == "true" {
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nonceGaps(scan.Addresses, collector.matches))
+		return
+	}
+
+	if r.URL.Query().Get("replacements") == "true" {
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var pendingTxs []Transaction
+		if pending, err := getBlockByNumber(r.Context(), "pending"); err != nil {
+			log.Printf("Error fetching pending transactions, checking mined ones only: %v", err)
+		} else {
+			pendingTxs = pending.Transactions
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nonceReplacements(scan.Addresses, collector.matches, pendingTxs))
+		return
+	}
+
+	if r.URL.Query().Get("backAndForth") == "true" {
+		window := int64(defaultWashWindow)
+		if windowParam := r.URL.Query().Get("washWindow"); windowParam != "" {
+			var err error
+			window, err = strconv.ParseInt(windowParam, 10, 64)
+			if err != nil || window < 1 {
+				http.Error(w, "Invalid washWindow parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		minRoundTrips := defaultWashMinRoundTrips
+		if minParam := r.URL.Query().Get("washMinRoundTrips"); minParam != "" {
+			var err error
+			minRoundTrips, err = strconv.Atoi(minParam)
+			if err != nil || minRoundTrips < 1 {
+				http.Error(w, "Invalid washMinRoundTrips parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(backAndForthPairs(scan.Addresses, collector.matches, window, minRoundTrips))
+		return
+	}
+
+	switch groupBy := r.URL.Query().Get("groupBy"); groupBy {
+	case "address":
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := writeGroupedJSON(w, groupMatchesByAddress(scan.Addresses, collector.matches), casing); err != nil {
+			log.Printf("Error writing results for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "block":
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := writeGroupedJSON(w, groupMatchesByBlock(collector.matches), casing); err != nil {
+			log.Printf("Error writing results for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "":
+	default:
+		http.Error(w, "Invalid groupBy parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out := newNDJSONMatchWriter(w, casing)
+		summary, err := scan.run(r.Context(), out)
+		if err != nil {
+			log.Printf("Error streaming transactions for %s: %v", scan.addressList(), err)
+			out.WriteError(err)
+			return
+		}
+		out.WriteSummary(summary)
+		return
+	case "csv":
+		// The header goes out with the writer, so check before making one.
+		if !scan.checkWriter(w, (*csvMatchWriter)(nil)) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		out, err := newCSVMatchWriter(w)
+		if err != nil {
+			log.Printf("Error writing CSV header: %v", err)
+			return
+		}
+		if _, err := scan.run(r.Context(), out); err != nil {
+			log.Printf("Error streaming transactions for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "bigquery":
+		out := newBigQueryMatchWriter(w)
+		if !scan.checkWriter(w, out) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if _, err := scan.run(r.Context(), out); err != nil {
+			log.Printf("Error streaming transactions for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "blockscout":
+		collector := &matchCollector{}
+		if !scan.checkWriter(w, collector) {
+			return
+		}
+		if _, err := scan.run(r.Context(), collector); err != nil {
+			http.Error(w, "Error scanning transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeBlockscoutJSON(w, collector.matches); err != nil {
+			log.Printf("Error writing results for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "sqlite":
+		out := &sqliteExportWriter{}
+		if !scan.checkWriter(w, out) {
+			return
+		}
+		if _, err := scan.run(r.Context(), out); err != nil {
+			http.Error(w, "Error fetching transactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		w.Header().Set("Content-Disposition", `attachment; filename="transactions.db"`)
+		if err := writeSQLiteDatabase(w, out.records); err != nil {
+			log.Printf("Error writing SQLite export for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "template":
+		tmpl, err := parseOutputTemplate(r.URL.Query().Get("template"))
+		if err != nil {
+			http.Error(w, "Invalid template parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := scan.run(r.Context(), newTemplateMatchWriter(w, tmpl)); err != nil {
+			log.Printf("Error streaming transactions for %s: %v", scan.addressList(), err)
+		}
+		return
+	case "", "text":
+	default:
+		http.Error(w, "Invalid format parameter", http.StatusBadRequest)
+		return
+	}
 
-	go fetchTransactions(address, startBlockRange, endBlockRange)
+	j := jobs.start(scan)
+	scan.Options.Stats = &j.stats
+	scan.Options.ProgressInterval = consoleProgressInterval
+	scan.Options.Progress = func(processed, total int64) {
+		log.Printf("Scanned %d/%d blocks for %s", processed, total, scan.addressList())
+	}
 
-	fmt.Fprintf(w, "Fetching transactions for address: %s from block %d to %d", address, startBlockRange, endBlockRange)
+	go func() {
+		summary, err := scan.run(context.Background(), newConsoleMatchWriter(os.Stdout))
+		j.finish(summary, err)
+		if err != nil {
+			log.Printf("Error fetching transactions for %s: %v", scan.addressList(), err)
+			return
+		}
+		log.Printf("Finished scanning %s: %d blocks, %d matches, %d failed blocks in %.1fs",
+			scan.addressList(), summary.BlocksScanned, summary.Matches, len(summary.FailedBlocks), summary.DurationSeconds)
+	}()
+
+	fmt.Fprintf(w, "Fetching transactions for address: %s from block %d to %d (job %s)", scan.addressList(), scan.StartBlock, scan.EndBlock, j.id)
 }
 
 func main() {
-	http.HandleFunc("/fetch-transactions", fetchTransactionsHandler)
+	forceHTTP2 := flag.Bool("http2", false, "negotiate HTTP/2 with the RPC endpoint when it supports it")
+	h2c := flag.Bool("h2c", false, "with -http2, speak HTTP/2 without TLS to an http:// RPC endpoint (prior knowledge)")
+	endpointFile := flag.String("endpoint-file", "", "file containing the RPC endpoint URL, re-read on SIGHUP")
+	tokenFile := flag.String("token-file", "", "file containing a bearer token for the RPC endpoint, re-read on SIGHUP")
+	outputTemplate := flag.String("output-template", "", "text/template applied to each match printed to the console, e.g. \"{{.Hash}} {{.ValueEther}}\"")
+	actionsFile := flag.String("actions", "", "JSON file adding selector and per-contract action labels")
+	flag.Int64Var(&incrementalStartBlock, "incremental-start", -1, "block to start from on an address's first sinceLastScan run when startBlock is not given")
+	rpcRate := flag.Float64("rpc-rate", 0, "maximum RPC requests per second, 0 for unlimited")
+	rpcBurst := flag.Int("rpc-burst", 1, "RPC requests allowed in a burst above -rpc-rate")
+	rateLimitBackend := flag.String("rate-limit-backend", "local", "where the -rpc-rate budget is kept: local, or redis to share it between instances")
+	redisAddr := flag.String("redis-addr", "localhost:6379", "Redis address for -rate-limit-backend=redis")
+	redisKey := flag.String("redis-key", "eth-parser:rpc-rate", "Redis key holding the shared token bucket")
+	scanRate := flag.Float64("scan-rate", 0, "maximum scans per second each client may start, 0 for unlimited")
+	scanBurst := flag.Int("scan-burst", 1, "scans a client may start in a burst above -scan-rate")
+	scanRateKey := flag.String("scan-rate-key", "ip", "what -scan-rate is counted per: ip, or address for the requested addresses")
+	priceURL := flag.String("price-url", defaultPriceURL, "JSON endpoint giving the ETH price in USD for usd=true")
+	pricePath := flag.String("price-path", "ethereum.usd", "dot-separated path to the price in the -price-url response")
+	fixedPrice := flag.Float64("eth-usd", 0, "use this fixed ETH price in USD instead of -price-url")
+	chainID := flag.Int64("chain-id", 0, "chain ID reported with chainId=true instead of asking the endpoint")
+	watchConfigFile := flag.String("watch-config", "", "JSON file of addresses to watch from the chain head, re-read on SIGHUP")
+	flag.BoolVar(&lenientQuantities, "lenient-quantities", false, "accept uppercase-prefixed, padded and decimal quantities from non-standard endpoints")
+	cursorSecretValue := flag.String("cursor-secret", "", "secret signing /transactions cursors; random per process when empty")
+	labelsFile := flag.String("labels", "", "JSON file mapping addresses to labels shown next to them in results")
+	startupProbe := flag.Bool("startup-probe", false, "check the RPC endpoint responds before serving")
+	startupRetries := flag.Int("startup-retries", 0, "times to retry a failed -startup-probe")
+	startupBackoff := flag.Duration("startup-backoff", time.Second, "wait before the first -startup-probe retry, doubling up to 30s")
+	maxFetchWorkers := flag.Int("fetch-workers", 0, "fixed number of goroutines fetching blocks for all scans together; 0 gives each scan its own")
+	warmBlocks := flag.Int64("warm-blocks", 0, "keep the latest N blocks cached, refreshed in the background, so recent blocks need no RPC call")
+	warmInterval := flag.Duration("warm-interval", defaultWatchPollInterval, "how often -warm-blocks checks for new blocks")
+	coalesceBlocks := flag.Bool("coalesce-blocks", false, "share one eth_getBlockByNumber call between concurrent fetches of the same block")
+	signSecretFile := flag.String("sign-secret-file", "", "file containing a secret to HMAC-sign each RPC request body with")
+	signHeader := flag.String("sign-header", "X-Signature", "header carrying the -sign-secret-file signature")
+	flag.IntVar(&storeBatchSize, "store-batch-size", storeBatchSize, "matches a scan buffers before writing them to the store at once")
+	flag.DurationVar(&storeFlushInterval, "store-flush-interval", storeFlushInterval, "longest a buffered match waits before it is written to the store")
+	flag.Int64Var(&logsFallbackMaxBlocks, "logs-fallback-max-blocks", logsFallbackMaxBlocks, "largest /logs range rebuilt from receipts when eth_getLogs fails, 0 to never fall back")
+	flag.Int64Var(&contractMaxBlocks, "contract-max-blocks", contractMaxBlocks, "longest range from creation to endBlock /contract-activity will collect")
+	flag.IntVar(&maxLoggedBody, "max-logged-body", maxLoggedBody, "bytes of a response body kept in logs and errors, 0 for no limit")
+	flag.Parse()
+
+	if *maxFetchWorkers > 0 {
+		fetchWorkers = newFetchPool(*maxFetchWorkers)
+	}
+	if *coalesceBlocks {
+		blockFlights = newBlockFlightGroup()
+	}
+
+	if *labelsFile != "" {
+		l, err := loadAddressLabels(*labelsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		labels = l
+	}
+
+	if *cursorSecretValue != "" {
+		cursorSecret = []byte(*cursorSecretValue)
+	}
+
+	if *chainID > 0 {
+		chainIDs.configure(*chainID)
+	}
+
+	prices = httpPriceSource{URL: *priceURL, Path: *pricePath}
+	if *fixedPrice > 0 {
+		prices = staticPriceSource(*fixedPrice)
+	}
+
+	limiter, err := newRateLimiter(*rateLimitBackend, *rpcRate, *rpcBurst, *redisAddr, *redisKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rpcLimiter = limiter
+
+	scanLimits, err = newKeyedLimiter(*scanRateKey, *scanRate, *scanBurst)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *actionsFile != "" {
+		registry, err := loadActionRegistry(*actionsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		actions = registry
+	}
+
+	if *outputTemplate != "" {
+		tmpl, err := parseOutputTemplate(*outputTemplate)
+		if err != nil {
+			log.Fatalf("Invalid -output-template: %v", err)
+		}
+		consoleTemplate = tmpl
+	}
+
+	creds, err := loadCredentials(*endpointFile, *tokenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentCredentials.Store(creds)
+	go reloadCredentialsOnSignal(*endpointFile, *tokenFile)
+
+	if *signSecretFile != "" {
+		secret, err := readSecretFile(*signSecretFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rpcSigner = hmacSigner{Header: *signHeader, Secret: []byte(secret)}
+	}
+
+	if *forceHTTP2 {
+		rpcClient = newHTTP2Client(*h2c)
+	}
+
+	if *startupProbe {
+		if err := probeEndpoint(*startupRetries, *startupBackoff); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *warmBlocks > 0 {
+		recentBlocks = newRecentBlockCache(*warmBlocks)
+		go recentBlocks.run(context.Background(), *warmInterval)
+	}
+
+	if *watchConfigFile != "" {
+		config, err := loadWatchConfig(*watchConfigFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := newWatcher(newConsoleMatchWriter(os.Stdout))
+		w.restart(config)
+		go reloadWatchOnSignal(*watchConfigFile, w)
+	}
+
+	http.HandleFunc("/fetch-transactions", withGzip(fetchTransactionsHandler))
+	http.HandleFunc("/wait-for", withGzip(waitForHandler))
+	http.HandleFunc("/activity-heatmap", withGzip(activityHeatmapHandler))
+	http.HandleFunc("/block", withGzip(blockHandler))
+	http.HandleFunc("/debug/endpoint", withGzip(debugEndpointHandler))
+	http.HandleFunc("/search", withGzip(searchHandler))
+	http.HandleFunc("/jobs", withGzip(jobsHandler))
+	http.HandleFunc("/trace", withGzip(traceHandler))
+	http.HandleFunc("/logs", withGzip(logsHandler))
+	http.HandleFunc("/replay", withGzip(replayHandler))
+	http.HandleFunc("/bigquery-schema", withGzip(bigQuerySchemaHandler))
+	http.HandleFunc("/transactions", withGzip(transactionsHandler))
+	http.HandleFunc("/pending", withGzip(pendingHandler))
+	http.HandleFunc("/diff", withGzip(diffHandler))
+	http.HandleFunc("/activity-range", withGzip(activityRangeHandler))
+	http.HandleFunc("/contract-activity", withGzip(contractActivityHandler))
+	http.HandleFunc("/gas-trend", withGzip(gasTrendHandler))
 	fmt.Println("Server is running on port 8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil)) // Start the server on port 8080
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Tests scan a handful of blocks against a local fake node; there is no
+	// provider to be polite to.
+	blockPause = 0
+	os.Exit(m.Run())
+}
+
+func TestBlockUnmarshalsTransactionsOrHashes(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		txs    string
+		hashes string
+	}{
+		{name: "full", json: `{"number":"0x1","transactions":[{"hash":"0x01","from":"0xaa"},{"hash":"0x02"}]}`, txs: "[0x01 0x02]", hashes: "[]"},
+		{name: "hashes", json: `{"number":"0x1","transactions":["0x01","0x02"]}`, txs: "[]", hashes: "[0x01 0x02]"},
+		{name: "empty", json: `{"number":"0x1","transactions":[]}`, txs: "[]", hashes: "[]"},
+		{name: "null", json: `{"number":"0x1","transactions":null}`, txs: "[]", hashes: "[]"},
+		{name: "missing", json: `{"number":"0x1"}`, txs: "[]", hashes: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var block BlockWithTransactions
+			if err := json.Unmarshal([]byte(tt.json), &block); err != nil {
+				t.Fatal(err)
+			}
+			var txs []string
+			for _, tx := range block.Transactions {
+				txs = append(txs, tx.Hash)
+			}
+			if block.Number != "0x1" || fmt.Sprint(txs) != tt.txs || fmt.Sprint(block.TransactionHashes) != tt.hashes {
+				t.Errorf("block = %+v", block)
+			}
+		})
+	}
+
+	var block BlockWithTransactions
+	if err := json.Unmarshal([]byte(`{"transactions":[7]}`), &block); err == nil {
+		t.Error("decoded a number as a transaction")
+	}
+}
+
+func TestTransactionUnmarshalsSignature(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Transaction
+	}{
+		{
+			name: "legacy",
+			json: `{"hash":"0x01","type":"0x0","v":"0x25","r":"0x1b","s":"0x2c"}`,
+			want: Transaction{Hash: "0x01", Type: "0x0", V: "0x25", R: "0x1b", S: "0x2c"},
+		},
+		{
+			name: "typed",
+			json: `{"hash":"0x02","type":"0x2","v":"0x1","yParity":"0x1","r":"0x1b","s":"0x2c"}`,
+			want: Transaction{Hash: "0x02", Type: "0x2", V: "0x1", YParity: "0x1", R: "0x1b", S: "0x2c"},
+		},
+		{
+			name: "unsigned",
+			json: `{"hash":"0x03"}`,
+			want: Transaction{Hash: "0x03"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tx Transaction
+			if err := json.Unmarshal([]byte(tt.json), &tx); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(tx) != fmt.Sprint(tt.want) {
+				t.Errorf("tx = %+v, want %+v", tx, tt.want)
+			}
+			encoded, _ := json.Marshal(tx)
+			var roundTrip map[string]interface{}
+			json.Unmarshal(encoded, &roundTrip)
+			_, hasParity := roundTrip["yParity"]
+			if hasParity != (tt.want.YParity != "") {
+				t.Errorf("re-encoded as %s", encoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type nonceGap struct {
+	// FirstMissing and LastMissing bound the nonces that never showed up
+	// between two of the address's transactions in the range.
+	FirstMissing uint64 `json:"firstMissing"`
+	LastMissing  uint64 `json:"lastMissing"`
+	AfterTx      string `json:"afterTx"`
+	BeforeTx     string `json:"beforeTx"`
+}
+
+type nonceReport struct {
+	Address  string     `json:"address"`
+	Outgoing int        `json:"outgoing"`
+	Lowest   *uint64    `json:"lowestNonce,omitempty"`
+	Highest  *uint64    `json:"highestNonce,omitempty"`
+	Gaps     []nonceGap `json:"gaps"`
+}
+
+// nonceGaps reports, per watched address, the holes in the nonce sequence
+// of its outgoing transactions. Only nonces between the lowest and highest
+// seen in the range can be judged; transactions without a readable nonce
+// are skipped.
+func nonceGaps(addresses []string, matches []match) []nonceReport {
+	reports := []nonceReport{}
+	for _, address := range addresses {
+		type sent struct {
+			nonce uint64
+			hash  string
+		}
+		var txs []sent
+		seen := make(map[string]bool)
+		for _, m := range matches {
+			if m.Address != address || m.Tx.From != address || seen[m.Tx.Hash] {
+				continue
+			}
+			seen[m.Tx.Hash] = true
+			nonce, err := parseQuantity(m.Tx.Nonce)
+			if err != nil || !nonce.IsUint64() {
+				continue
+			}
+			txs = append(txs, sent{nonce: nonce.Uint64(), hash: m.Tx.Hash})
+		}
+		sort.SliceStable(txs, func(i, j int) bool { return txs[i].nonce < txs[j].nonce })
+
+		report := nonceReport{Address: address, Outgoing: len(txs), Gaps: []nonceGap{}}
+		if len(txs) > 0 {
+			report.Lowest, report.Highest = &txs[0].nonce, &txs[len(txs)-1].nonce
+		}
+		for i := 1; i < len(txs); i++ {
+			if txs[i].nonce > txs[i-1].nonce+1 {
+				report.Gaps = append(report.Gaps, nonceGap{
+					FirstMissing: txs[i-1].nonce + 1,
+					LastMissing:  txs[i].nonce - 1,
+					AfterTx:      txs[i-1].hash,
+					BeforeTx:     txs[i].hash,
+				})
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// nonceTransaction is one of the transactions sent with the same nonce.
+// BlockNumber is empty for one still pending; FeeCap is maxFeePerGas, or
+// gasPrice for legacy transactions, in wei.
+type nonceTransaction struct {
+	Hash        string `json:"hash"`
+	BlockNumber string `json:"blockNumber,omitempty"`
+	FeeCap      string `json:"feeCap,omitempty"`
+}
+
+type nonceReplacement struct {
+	Address string `json:"address"`
+	Nonce   uint64 `json:"nonce"`
+	// Mined is nil when none of them was mined in the range.
+	Mined    *nonceTransaction  `json:"mined"`
+	Replaced []nonceTransaction `json:"replaced"`
+}
+
+func newNonceTransaction(tx Transaction, blockNumber string) nonceTransaction {
+	sent := nonceTransaction{Hash: tx.Hash, BlockNumber: blockNumber}
+	if limit, ok := feeCap(tx); ok {
+		sent.FeeCap = limit.String()
+	}
+	return sent
+}
+
+// nonceReplacements finds, per watched address, the nonces it sent more
+// than one transaction with among the range's matches and the pending
+// transactions. Only one of them can be mined; the rest, usually the
+// lower-fee ones a fee bump replaced, are listed as replaced. A pending
+// transaction sharing a nonce with a mined one will be dropped.
+func nonceReplacements(addresses []string, matches []match, pending []Transaction) []nonceReplacement {
+	replacements := []nonceReplacement{}
+	for _, address := range addresses {
+		byNonce := make(map[uint64][]nonceTransaction)
+		mined := make(map[uint64]string)
+		seen := make(map[string]bool)
+		add := func(tx Transaction, blockNumber string) {
+			if strings.ToLower(tx.From) != address || seen[tx.Hash] {
+				return
+			}
+			nonce, err := parseQuantity(tx.Nonce)
+			if err != nil || !nonce.IsUint64() {
+				return
+			}
+			seen[tx.Hash] = true
+			byNonce[nonce.Uint64()] = append(byNonce[nonce.Uint64()], newNonceTransaction(tx, blockNumber))
+			if blockNumber != "" {
+				mined[nonce.Uint64()] = tx.Hash
+			}
+		}
+		for _, m := range matches {
+			if m.Address == address {
+				add(m.Tx, m.Block.Number)
+			}
+		}
+		for _, tx := range pending {
+			add(tx, "")
+		}
+
+		var nonces []uint64
+		for nonce, txs := range byNonce {
+			if len(txs) > 1 {
+				nonces = append(nonces, nonce)
+			}
+		}
+		sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+		for _, nonce := range nonces {
+			replacement := nonceReplacement{Address: address, Nonce: nonce, Replaced: []nonceTransaction{}}
+			for _, sent := range byNonce[nonce] {
+				if sent.Hash == mined[nonce] {
+					replacement.Mined = &sent
+				} else {
+					replacement.Replaced = append(replacement.Replaced, sent)
+				}
+			}
+			replacements = append(replacements, replacement)
+		}
+	}
+	return replacements
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func sentMatch(address, from, hash, nonce string) match {
+	return match{Address: address, Block: testBlock(1), Tx: Transaction{Hash: hash, From: from, Nonce: nonce}}
+}
+
+func TestNonceGaps(t *testing.T) {
+	matches := []match{
+		sentMatch(watched, watched, "0x05", "0x5"),
+		sentMatch(watched, watched, "0x01", "0x1"),
+		sentMatch(watched, watched, "0x02", "0x2"),
+		sentMatch(watched, watched, "0x09", "0x9"),
+		sentMatch(watched, other, "0xin", "0x3"),
+		sentMatch(watched, watched, "0xbad", "nonce"),
+		sentMatch(watched, watched, "0x02", "0x2"),
+	}
+
+	reports := nonceGaps([]string{watched, other}, matches)
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want one per address", len(reports))
+	}
+	report := reports[0]
+	if report.Outgoing != 4 || *report.Lowest != 1 || *report.Highest != 9 {
+		t.Errorf("report = %+v", report)
+	}
+	want := []nonceGap{
+		{FirstMissing: 3, LastMissing: 4, AfterTx: "0x02", BeforeTx: "0x05"},
+		{FirstMissing: 6, LastMissing: 8, AfterTx: "0x05", BeforeTx: "0x09"},
+	}
+	if fmt.Sprint(report.Gaps) != fmt.Sprint(want) {
+		t.Errorf("gaps = %+v, want %+v", report.Gaps, want)
+	}
+	if empty := reports[1]; empty.Address != other || empty.Outgoing != 0 || empty.Lowest != nil || len(empty.Gaps) != 0 {
+		t.Errorf("report for %s = %+v", other, empty)
+	}
+}
+
+func TestNonceGapsHandler(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, Nonce: "0x0"}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched, Nonce: "0x2"}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&nonceGaps=true")
+	var reports []nonceReport
+	if err := json.NewDecoder(rec.Body).Decode(&reports); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if len(reports) != 1 || len(reports[0].Gaps) != 1 || reports[0].Gaps[0].FirstMissing != 1 || reports[0].Gaps[0].LastMissing != 1 {
+		t.Errorf("reports = %+v", reports)
+	}
+}
+
+func TestNonceReplacements(t *testing.T) {
+	mined := func(hash, nonce, block string, fees Transaction) match {
+		fees.Hash, fees.From, fees.Nonce = hash, watched, nonce
+		return match{Address: watched, Block: &BlockWithTransactions{Number: block}, Tx: fees}
+	}
+	matches := []match{
+		mined("0x10", "0x5", "0x1", Transaction{GasPrice: "0x64"}),
+		mined("0x11", "0x6", "0x2", Transaction{MaxFeePerGas: "0xc8"}),
+		{Address: other, Block: testBlock(2), Tx: Transaction{Hash: "0x12", From: watched, Nonce: "0x6"}},
+	}
+	pending := []Transaction{
+		{Hash: "0x20", From: "0x00000000000000000000000000000000000000AA", Nonce: "0x5", GasPrice: "0x32"},
+		{Hash: "0x10", From: watched, Nonce: "0x5", GasPrice: "0x64"},
+		{Hash: "0x21", From: watched, Nonce: "0x7", MaxFeePerGas: "0x10"},
+		{Hash: "0x22", From: watched, Nonce: "0x7", MaxFeePerGas: "0x20"},
+		{Hash: "0x23", From: other, Nonce: "0x7"},
+		{Hash: "0x24", From: watched, Nonce: "seven"},
+	}
+
+	got := nonceReplacements([]string{watched}, matches, pending)
+	encoded, _ := json.Marshal(got)
+	want := `[{"address":"` + watched + `","nonce":5,"mined":{"hash":"0x10","blockNumber":"0x1","feeCap":"100"},"replaced":[{"hash":"0x20","feeCap":"50"}]},` +
+		`{"address":"` + watched + `","nonce":7,"mined":null,"replaced":[{"hash":"0x21","feeCap":"16"},{"hash":"0x22","feeCap":"32"}]}]`
+	if string(encoded) != want {
+		t.Errorf("replacements = %s\nwant %s", encoded, want)
+	}
+
+	if got := nonceReplacements([]string{other}, matches, nil); len(got) != 0 {
+		t.Errorf("replacements for %s = %+v, want none", other, got)
+	}
+}
+
+func TestReplacementsHandler(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, Nonce: "0x0", GasPrice: "0x2"}),
+		testBlock(2),
+	)
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if params[0] == "pending" {
+			return testBlock(3, Transaction{Hash: "0x02", From: watched, Nonce: "0x0", GasPrice: "0x1"}), nil
+		}
+		return serve(params)
+	})
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=2&replacements=true")
+	var replacements []nonceReplacement
+	if err := json.NewDecoder(rec.Body).Decode(&replacements); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if len(replacements) != 1 || replacements[0].Mined == nil || replacements[0].Mined.Hash != "0x01" || len(replacements[0].Replaced) != 1 {
+		t.Errorf("replacements = %+v", replacements)
+	}
+
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if params[0] == "pending" {
+			return nil, fmt.Errorf("pending block not supported")
+		}
+		return serve(params)
+	})
+	rec = getScan(t, "address="+watched+"&startBlock=1&endBlock=2&replacements=true")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("without pending transactions: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type match struct {
+	Address string
+	Block   *BlockWithTransactions
+	Tx      Transaction
+	Receipt *TransactionReceipt
+
+	// USDPrice is the scan's ETH price, or 0 when USD values are off.
+	USDPrice float64
+
+	// ChainID is set when the scan was asked to label matches with it.
+	ChainID int64
+
+	// BlockTransactions is how many transactions the block holds in total,
+	// or 0 when the scan didn't fetch whole blocks.
+	BlockTransactions int
+
+	// RawTransaction is the signed RLP encoding, when the scan fetches it.
+	RawTransaction string
+
+	// CodeSize is the recipient's bytecode size, when the scan looks it up.
+	CodeSize *int
+
+	// Confirmations is the block's depth below the head when the match was
+	// written, counting the block itself.
+	Confirmations *int64
+
+	// EventsDecoded is set when the scan decodes events, false for matches
+	// left out of the sample.
+	EventsDecoded *bool
+	Events        []Log
+}
+
+type matchWriter interface {
+	WriteMatch(m match) error
+	Flush() error
+}
+
+type selfDestructWriter interface {
+	WriteSelfDestruct(block *BlockWithTransactions, sd selfDestruct) error
+}
+
+type textMatchWriter struct {
+	w io.Writer
+}
+
+func newTextMatchWriter(w io.Writer) *textMatchWriter {
+	return &textMatchWriter{w: w}
+}
+
+func (t *textMatchWriter) WriteMatch(m match) error {
+	line := fmt.Sprintf("Transaction: Block %s | Hash: %s | From: %s | To: %s | Value: %s ETH",
+		m.Block.Number, m.Tx.Hash, labels.annotate(m.Tx.From), labels.annotate(m.Tx.To), convertWeiToEther(m.Tx.Value))
+	if m.Block.BaseFeePerGas != "" {
+		line += fmt.Sprintf(" | Base fee: %s gwei", convertWeiToGwei(m.Block.BaseFeePerGas))
+	}
+	if price := effectiveGasPriceHex(m); price != "" {
+		line += fmt.Sprintf(" | Effective gas price: %s gwei", convertWeiToGwei(price))
+	}
+	if action := actions.label(m.Tx); action != ethTransferLabel {
+		line += " | Action: " + action
+	}
+	if usd := usdValue(m.Tx.Value, m.USDPrice); usd != "" {
+		line += " | USD: $" + usd
+	}
+	if m.CodeSize != nil {
+		line += fmt.Sprintf(" | Code size: %d bytes", *m.CodeSize)
+	}
+	if m.Confirmations != nil {
+		line += fmt.Sprintf(" | Confirmations: %d", *m.Confirmations)
+	}
+	_, err := fmt.Fprintln(t.w, line)
+	return err
+}
+
+func (t *textMatchWriter) WriteSelfDestruct(block *BlockWithTransactions, sd selfDestruct) error {
+	_, err := fmt.Fprintf(t.w, "Self-destruct: Block %s | Hash: %s | Contract: %s | Refund: %s | Balance: %s ETH\n",
+		block.Number, sd.TransactionHash, sd.Contract, sd.RefundAddress, convertWeiToEther(sd.Balance))
+	return err
+}
+
+func (t *textMatchWriter) WriteWithdrawal(block *BlockWithTransactions, withdrawal Withdrawal) error {
+	_, err := fmt.Fprintf(t.w, "Withdrawal: Block %s | Index: %s | Validator: %s | To: %s | Amount: %s ETH\n",
+		block.Number, withdrawal.Index, withdrawal.ValidatorIndex, labels.annotate(withdrawal.Address), withdrawalEther(withdrawal.Amount))
+	return err
+}
+
+func (t *textMatchWriter) Flush() error {
+	return nil
+}
+
+var csvHeader = []string{"blockNumber", "hash", "from", "to", "value", "valueEther", "baseFeePerGas", "effectiveGasPrice", "matchedAddress", "action"}
+
+// csvMatchWriter streams rows to an HTTP response, flushing after every block
+// with matches so clients see rows as they are found.
+type csvMatchWriter struct {
+	w       *csv.Writer
+	flusher http.Flusher
+}
+
+func newCSVMatchWriter(w io.Writer) (*csvMatchWriter, error) {
+	c := &csvMatchWriter{w: csv.NewWriter(w)}
+	c.flusher, _ = w.(http.Flusher)
+
+	if err := c.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return c, c.Flush()
+}
+
+func (c *csvMatchWriter) WriteMatch(m match) error {
+	return c.w.Write([]string{
+		m.Block.Number,
+		m.Tx.Hash,
+		m.Tx.From,
+		m.Tx.To,
+		m.Tx.Value,
+		convertWeiToEther(m.Tx.Value),
+		m.Block.BaseFeePerGas,
+		effectiveGasPriceHex(m),
+		m.Address,
+		actions.label(m.Tx),
+	})
+}
+
+func (c *csvMatchWriter) Flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	if c.flusher != nil {
+		c.flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCSVOutputStreamsRowsPerBlock(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0xde0b6b3a7640000"}),
+		testBlock(2, Transaction{Hash: "0x02", From: other, To: other, Value: "0x1"}),
+		testBlock(3, Transaction{Hash: "0x03", From: other, To: watched, Value: "0x0"}),
+	)
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=3&format=csv")
+	if got := rec.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Content-Type = %q, want text/csv", got)
+	}
+	if !rec.Flushed {
+		t.Error("CSV rows were never flushed")
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want header and 2 matches: %v", len(rows), rows)
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("header = %v, want %v", rows[0], csvHeader)
+	}
+	if rows[1][1] != "0x01" || rows[1][5] != "1.000000" || rows[1][8] != watched {
+		t.Errorf("first row = %v", rows[1])
+	}
+	if rows[2][1] != "0x03" || rows[2][0] != "0x3" {
+		t.Errorf("second row = %v", rows[2])
+	}
+}
+
+func TestTextOutputReportsBaseFee(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseFee string
+		want    string
+	}{
+		{name: "post-London", baseFee: "0x3b9aca00", want: " | Base fee: 1.000000 gwei"},
+		{name: "pre-London", baseFee: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			block := testBlock(1)
+			block.BaseFeePerGas = tt.baseFee
+			tx := Transaction{Hash: "0x01", From: watched, To: other, Value: "0x0"}
+			if err := newTextMatchWriter(&out).WriteMatch(match{Address: watched, Block: block, Tx: tx}); err != nil {
+				t.Fatal(err)
+			}
+
+			line := out.String()
+			if tt.want != "" && !strings.Contains(line, tt.want) {
+				t.Errorf("line %q does not contain %q", line, tt.want)
+			}
+			if tt.want == "" && strings.Contains(line, "Base fee") {
+				t.Errorf("line %q reports a base fee for a block without one", line)
+			}
+		})
+	}
+}
+
+func TestBlockDecodesBaseFee(t *testing.T) {
+	var block BlockWithTransactions
+	if err := json.Unmarshal([]byte(`{"number":"0x1","baseFeePerGas":"0x7","transactions":[]}`), &block); err != nil {
+		t.Fatal(err)
+	}
+	if block.BaseFeePerGas != "0x7" {
+		t.Errorf("BaseFeePerGas = %q, want 0x7", block.BaseFeePerGas)
+	}
+	if got := convertWeiToGwei("0x2540be400"); got != "10.000000" {
+		t.Errorf("convertWeiToGwei = %q, want 10.000000", got)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// feeCap is the most a transaction will pay per gas: maxFeePerGas for
+// EIP-1559 transactions, gasPrice for legacy ones.
+func feeCap(tx Transaction) (*big.Int, bool) {
+	value := tx.MaxFeePerGas
+	if value == "" {
+		value = tx.GasPrice
+	}
+	if value == "" {
+		return nil, false
+	}
+	feeCap, err := parseQuantity(value)
+	return feeCap, err == nil
+}
+
+type pendingTransaction struct {
+	Transaction
+	// Includable is false when the fee cap is below the latest base fee,
+	// so the transaction can't be mined until the base fee falls.
+	Includable bool `json:"includable"`
+	// FeeHeadroom is the fee cap minus the base fee, in wei; negative for
+	// stuck transactions.
+	FeeHeadroom string `json:"feeHeadroom"`
+	// Confirmations is always 0, as for matches, until the transaction is
+	// mined.
+	Confirmations int64 `json:"confirmations"`
+}
+
+type pendingResponse struct {
+	BaseFeePerGas string               `json:"baseFeePerGas"`
+	Transactions  []pendingTransaction `json:"transactions"`
+}
+
+func classifyPending(baseFee *big.Int, txs []Transaction) []pendingTransaction {
+	classified := []pendingTransaction{}
+	for _, tx := range txs {
+		limit, ok := feeCap(tx)
+		if !ok {
+			continue
+		}
+		headroom := new(big.Int).Sub(limit, baseFee)
+		classified = append(classified, pendingTransaction{
+			Transaction: tx,
+			Includable:  headroom.Sign() >= 0,
+			FeeHeadroom: headroom.String(),
+		})
+	}
+	return classified
+}
+
+// pendingHandler lists the node's pending transactions, optionally only those
+// touching address, classified against the latest block's base fee.
+func pendingHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("address")))
+
+	latest, err := getBlockByNumber(r.Context(), "latest")
+	if err != nil {
+		http.Error(w, "Error fetching latest block: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	baseFee, err := parseQuantity(latest.BaseFeePerGas)
+	if err != nil {
+		http.Error(w, "The latest block has no base fee", http.StatusNotImplemented)
+		return
+	}
+
+	pending, err := getBlockByNumber(r.Context(), "pending")
+	if err != nil {
+		http.Error(w, "Error fetching pending transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var txs []Transaction
+	for _, tx := range pending.Transactions {
+		if address == "" || strings.ToLower(tx.From) == address || strings.ToLower(tx.To) == address {
+			txs = append(txs, tx)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pendingResponse{
+		BaseFeePerGas: latest.BaseFeePerGas,
+		Transactions:  classifyPending(baseFee, txs),
+	})
+}
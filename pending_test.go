@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyPending(t *testing.T) {
+	txs := []Transaction{
+		{Hash: "0x01", MaxFeePerGas: "0x64", GasPrice: "0x1"},
+		{Hash: "0x02", GasPrice: "0x32"},
+		{Hash: "0x03", MaxFeePerGas: "0x10"},
+		{Hash: "0x04"},
+	}
+	got := classifyPending(big.NewInt(50), txs)
+
+	want := []string{"0x01 true 50", "0x02 true 0", "0x03 false -34"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions, want %d", len(got), len(want))
+	}
+	for i, tx := range got {
+		if line := fmt.Sprintf("%s %v %s", tx.Hash, tx.Includable, tx.FeeHeadroom); line != want[i] {
+			t.Errorf("transaction %d = %s, want %s", i, line, want[i])
+		}
+	}
+}
+
+func TestPendingHandler(t *testing.T) {
+	node := newFakeNode(t)
+	latest := testBlock(9)
+	latest.BaseFeePerGas = "0x64"
+	pending := testBlock(10,
+		Transaction{Hash: "0x01", From: "0x00000000000000000000000000000000000000AA", To: other, MaxFeePerGas: "0xc8"},
+		Transaction{Hash: "0x02", From: other, To: "0xcc", GasPrice: "0x10"},
+		Transaction{Hash: "0x03", From: "0xcc", To: watched, GasPrice: "0x10"},
+	)
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if params[0] == "pending" {
+			return pending, nil
+		}
+		return latest, nil
+	})
+
+	rec := httptest.NewRecorder()
+	pendingHandler(rec, httptest.NewRequest(http.MethodGet, "/pending?address="+watched, nil))
+	var response pendingResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.BaseFeePerGas != "0x64" || len(response.Transactions) != 2 {
+		t.Fatalf("response = %+v", response)
+	}
+	if tx := response.Transactions[0]; tx.Hash != "0x01" || !tx.Includable || tx.FeeHeadroom != "100" {
+		t.Errorf("first transaction = %+v", tx)
+	}
+	if tx := response.Transactions[1]; tx.Hash != "0x03" || tx.Includable || tx.FeeHeadroom != "-84" {
+		t.Errorf("second transaction = %+v", tx)
+	}
+
+	rec = httptest.NewRecorder()
+	pendingHandler(rec, httptest.NewRequest(http.MethodGet, "/pending", nil))
+	json.NewDecoder(rec.Body).Decode(&response)
+	if len(response.Transactions) != 3 {
+		t.Errorf("unfiltered: got %d transactions, want 3", len(response.Transactions))
+	}
+}
+
+func TestPendingHandlerWithoutBaseFee(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+
+	rec := httptest.NewRecorder()
+	pendingHandler(rec, httptest.NewRequest(http.MethodGet, "/pending", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
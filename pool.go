@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// fetchWorkers, when -fetch-workers is set, runs the block fetches of every
+// scan so the process never has more fetch goroutines than its size,
+// whatever the number of concurrent jobs.
+var fetchWorkers *fetchPool
+
+// blockPause is how long a fetch slot rests after each successful fetch.
+var blockPause = 5 * time.Second
+
+// fetchPool is a fixed set of goroutines serving per-scan queues round
+// robin, so a long scan can't starve ones started after it.
+type fetchPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues []*poolQueue
+	next   int
+}
+
+type poolQueue struct {
+	tasks []func()
+}
+
+func newFetchPool(workers int) *fetchPool {
+	p := &fetchPool{}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				p.take()()
+			}
+		}()
+	}
+	return p
+}
+
+func (p *fetchPool) submit(q *poolQueue, task func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(q.tasks) == 0 {
+		p.queues = append(p.queues, q)
+	}
+	q.tasks = append(q.tasks, task)
+	p.cond.Signal()
+}
+
+// take hands out the next scan's oldest task, moving on to the following
+// scan each time. Queues leave the rotation once empty.
+func (p *fetchPool) take() func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queues) == 0 {
+		p.cond.Wait()
+	}
+
+	p.next %= len(p.queues)
+	q := p.queues[p.next]
+	task := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	if len(q.tasks) == 0 {
+		p.queues = append(p.queues[:p.next], p.queues[p.next+1:]...)
+	} else {
+		p.next++
+	}
+	return task
+}
+
+// fetchRange calls fetch for each block from start to end, at most
+// concurrency at a time, pausing a worker's slot after each successful
+// fetch. fetch reports whether the block was fetched.
+type fetchRange func(ctx context.Context, start, end int64, concurrency int, throttle *blockThrottle, fetch func(int64) bool)
+
+// fetchWithOwnWorkers starts concurrency goroutines for this scan alone.
+func fetchWithOwnWorkers(ctx context.Context, start, end int64, concurrency int, throttle *blockThrottle, fetch func(int64) bool) {
+	blockNumbers := make(chan int64)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range blockNumbers {
+				if fetch(i) {
+					pause(ctx, blockPause)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := start; i <= end; i++ {
+		if err := throttle.wait(ctx); err != nil {
+			break
+		}
+		select {
+		case blockNumbers <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(blockNumbers)
+	wg.Wait()
+}
+
+// fetch queues the scan's fetches on the shared pool. The scan still
+// holds at most concurrency slots; a slot stays taken through the pause
+// after a fetch without tying up a pool goroutine.
+func (p *fetchPool) fetch(ctx context.Context, start, end int64, concurrency int, throttle *blockThrottle, fetch func(int64) bool) {
+	q := &poolQueue{}
+	slots := make(chan struct{}, concurrency)
+	release := func() { <-slots }
+	var wg sync.WaitGroup
+
+dispatch:
+	for i := start; i <= end; i++ {
+		if err := throttle.wait(ctx); err != nil {
+			break
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+
+		number := i
+		wg.Add(1)
+		p.submit(q, func() {
+			defer wg.Done()
+			if fetch(number) {
+				time.AfterFunc(blockPause, release)
+			} else {
+				release()
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchPoolTakesRoundRobin(t *testing.T) {
+	p := &fetchPool{}
+	p.cond = sync.NewCond(&p.mu)
+
+	var order []string
+	first, second := &poolQueue{}, &poolQueue{}
+	for _, name := range []string{"a1", "a2", "a3"} {
+		p.submit(first, func() { order = append(order, name) })
+	}
+	for _, name := range []string{"b1", "b2"} {
+		p.submit(second, func() { order = append(order, name) })
+	}
+
+	for i := 0; i < 5; i++ {
+		p.take()()
+	}
+	if got := strings.Join(order, " "); got != "a1 b1 a2 b2 a3" {
+		t.Errorf("order = %s, want the queues interleaved", got)
+	}
+	if len(p.queues) != 0 {
+		t.Errorf("%d queues left in rotation", len(p.queues))
+	}
+}
+
+func TestFetchPoolBoundsConcurrentFetches(t *testing.T) {
+	pool := newFetchPool(2)
+	var running, peak atomic.Int32
+	var fetched sync.Map
+	fetch := func(number int64) bool {
+		for n := running.Add(1); ; {
+			if old := peak.Load(); n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		running.Add(-1)
+		if _, dup := fetched.LoadOrStore(number, true); dup {
+			t.Errorf("block %d fetched twice", number)
+		}
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for scan := int64(0); scan < 3; scan++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.fetch(context.Background(), scan*100, scan*100+9, 4, newBlockThrottle(0), fetch)
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Errorf("%d fetches ran at once on a pool of 2", got)
+	}
+	count := 0
+	fetched.Range(func(key, value any) bool { count++; return true })
+	if count != 30 {
+		t.Errorf("fetched %d blocks, want 30", count)
+	}
+}
+
+func TestScanUsesSharedFetchPool(t *testing.T) {
+	previous := fetchWorkers
+	fetchWorkers = newFetchPool(1)
+	t.Cleanup(func() { fetchWorkers = previous })
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}),
+		testBlock(2),
+		testBlock(3, Transaction{Hash: "0x03", To: watched}),
+	)
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 3, scanOptions{Concurrency: 3}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.BlocksScanned != 3 || strings.Join(out.hashes(), " ") != "0x01 0x03" {
+		t.Errorf("summary = %+v, matches = %v", summary, out.hashes())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// priceSource reports the current ETH price in USD.
+type priceSource interface {
+	ETHPrice(ctx context.Context) (float64, error)
+}
+
+const defaultPriceURL = "https://api.coingecko.com/api/v3/simple/price?ids=ethereum&vs_currencies=usd"
+
+// httpPriceSource reads the price from a JSON document, following Path (a
+// dot-separated list of object keys) to the number.
+type httpPriceSource struct {
+	URL  string
+	Path string
+}
+
+func (p httpPriceSource) ETHPrice(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("price source returned %s", resp.Status)
+	}
+
+	var value interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return 0, fmt.Errorf("failed to decode price response: %v", err)
+	}
+	for _, key := range strings.Split(p.Path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("price response has no %q", p.Path)
+		}
+		value = object[key]
+	}
+
+	price, ok := value.(float64)
+	if !ok || price <= 0 {
+		return 0, fmt.Errorf("price response has no price at %q", p.Path)
+	}
+	return price, nil
+}
+
+// staticPriceSource always reports the same price.
+type staticPriceSource float64
+
+func (p staticPriceSource) ETHPrice(ctx context.Context) (float64, error) {
+	return float64(p), nil
+}
+
+var prices priceSource = httpPriceSource{URL: defaultPriceURL, Path: "ethereum.usd"}
+
+// scanPrice fetches the price once for a scan. A failure is logged and
+// reported as 0, which leaves usdValue off every match.
+func scanPrice(ctx context.Context, source priceSource) float64 {
+	price, err := source.ETHPrice(ctx)
+	if err != nil {
+		log.Printf("Error fetching ETH price, omitting USD values: %v", err)
+		return 0
+	}
+	return price
+}
+
+func usdValue(weiHex string, price float64) string {
+	if price <= 0 {
+		return ""
+	}
+	wei, err := parseQuantity(weiHex)
+	if err != nil {
+		return ""
+	}
+	ether := new(big.Float).Quo(new(big.Float).SetInt(wei), weiPerEther)
+	return new(big.Float).Mul(ether, big.NewFloat(price)).Text('f', 2)
+}
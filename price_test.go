@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPPriceSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		case "/string":
+			w.Write([]byte(`{"ethereum":{"usd":"3000"}}`))
+		default:
+			w.Write([]byte(`{"ethereum":{"usd":3012.5}}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		key     string
+		want    float64
+		wantErr bool
+	}{
+		{path: "/", key: "ethereum.usd", want: 3012.5},
+		{path: "/", key: "ethereum.eur", wantErr: true},
+		{path: "/", key: "ethereum.usd.value", wantErr: true},
+		{path: "/string", key: "ethereum.usd", wantErr: true},
+		{path: "/down", key: "ethereum.usd", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := httpPriceSource{URL: server.URL + tt.path, Path: tt.key}.ETHPrice(context.Background())
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s %s: got %v, %v", tt.path, tt.key, got, err)
+		}
+	}
+}
+
+func TestUSDValue(t *testing.T) {
+	tests := []struct {
+		wei   string
+		price float64
+		want  string
+	}{
+		{wei: "0xde0b6b3a7640000", price: 3012.5, want: "3012.50"},
+		{wei: "0x6f05b59d3b20000", price: 2000, want: "1000.00"},
+		{wei: "0x0", price: 2000, want: "0.00"},
+		{wei: "0xde0b6b3a7640000", price: 0, want: ""},
+		{wei: "bogus", price: 2000, want: ""},
+	}
+	for _, tt := range tests {
+		if got := usdValue(tt.wei, tt.price); got != tt.want {
+			t.Errorf("usdValue(%s, %v) = %q, want %q", tt.wei, tt.price, got, tt.want)
+		}
+	}
+}
+
+type failingPriceSource struct{}
+
+func (failingPriceSource) ETHPrice(ctx context.Context) (float64, error) {
+	return 0, context.DeadlineExceeded
+}
+
+func TestScanAddsUSDValues(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0xde0b6b3a7640000"}))
+	previous := prices
+	defer func() { prices = previous }()
+
+	tests := []struct {
+		name   string
+		source priceSource
+		query  string
+		want   interface{}
+	}{
+		{name: "priced", source: staticPriceSource(2500), query: "&usd=true", want: "2500.00"},
+		{name: "not asked", source: staticPriceSource(2500), want: nil},
+		{name: "price unavailable", source: failingPriceSource{}, query: "&usd=true", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prices = tt.source
+			rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson"+tt.query)
+			lines := ndjsonLines(t, rec.Body.String())
+			if len(lines) == 0 || lines[0]["usdValue"] != tt.want {
+				t.Errorf("first line = %v, want usdValue %v", lines, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	weiPerEther = new(big.Float).SetInt(big.NewInt(1e18))
+	weiPerGwei  = new(big.Float).SetInt(big.NewInt(1e9))
+)
+
+// lenientQuantities, set by -lenient-quantities, accepts quantities from
+// endpoints that don't follow the JSON-RPC hex encoding: a "0X" prefix,
+// surrounding whitespace, and unprefixed decimal strings.
+var lenientQuantities bool
+
+func parseQuantity(value string) (*big.Int, error) {
+	digits, base := strings.TrimPrefix(value, "0x"), 16
+	if lenientQuantities {
+		digits, base = normalizeQuantity(value)
+	}
+
+	quantity, ok := new(big.Int).SetString(digits, base)
+	if !ok || digits == "" {
+		return nil, fmt.Errorf("invalid hex quantity %q", value)
+	}
+	return quantity, nil
+}
+
+// normalizeQuantity picks the base of a loosely formatted quantity. Without a
+// prefix, a string of only decimal digits is read as decimal and anything
+// else as hex.
+func normalizeQuantity(value string) (string, int) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		return value[2:], 16
+	}
+	if strings.Trim(value, "0123456789") == "" {
+		return value, 10
+	}
+	return value, 16
+}
+
+func formatEther(wei *big.Int) string {
+	return new(big.Float).Quo(new(big.Float).SetInt(wei), weiPerEther).Text('f', 6)
+}
+
+func formatGwei(wei *big.Int) string {
+	return new(big.Float).Quo(new(big.Float).SetInt(wei), weiPerGwei).Text('f', 6)
+}
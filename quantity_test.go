@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		value   string
+		strict  string
+		lenient string
+	}{
+		{value: "0x1a", strict: "26", lenient: "26"},
+		{value: "0x0", strict: "0", lenient: "0"},
+		{value: "0X1A", strict: "", lenient: "26"},
+		{value: " 0x1a\n", strict: "", lenient: "26"},
+		{value: "26", strict: "38", lenient: "26"},
+		{value: "1a", strict: "26", lenient: "26"},
+		{value: "0x", strict: "", lenient: ""},
+		{value: "", strict: "", lenient: ""},
+		{value: "0xzz", strict: "", lenient: ""},
+		{value: "0xde0b6b3a7640000000", strict: "4096000000000000000000", lenient: "4096000000000000000000"},
+	}
+
+	defer func() { lenientQuantities = false }()
+	for _, lenient := range []bool{false, true} {
+		lenientQuantities = lenient
+		for _, tt := range tests {
+			want := tt.strict
+			if lenient {
+				want = tt.lenient
+			}
+			got := ""
+			if quantity, err := parseQuantity(tt.value); err == nil {
+				got = quantity.String()
+			}
+			if got != want {
+				t.Errorf("lenient=%v: parseQuantity(%q) = %q, want %q", lenient, tt.value, got, want)
+			}
+		}
+	}
+}
+
+func TestConvertWeiHandlesLargeAndBadValues(t *testing.T) {
+	tests := []struct {
+		wei   string
+		ether string
+		gwei  string
+	}{
+		{wei: "0xde0b6b3a7640000", ether: "1.000000", gwei: "1000000000.000000"},
+		{wei: "0x3635c9adc5dea00000", ether: "1000.000000", gwei: "1000000000000.000000"},
+		{wei: "0x3b9aca00", ether: "0.000000", gwei: "1.000000"},
+		{wei: "garbage", ether: "0.000000", gwei: "0.000000"},
+	}
+	for _, tt := range tests {
+		if got := convertWeiToEther(tt.wei); got != tt.ether {
+			t.Errorf("convertWeiToEther(%s) = %s, want %s", tt.wei, got, tt.ether)
+		}
+		if got := convertWeiToGwei(tt.wei); got != tt.gwei {
+			t.Errorf("convertWeiToGwei(%s) = %s, want %s", tt.wei, got, tt.gwei)
+		}
+	}
+}
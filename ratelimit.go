@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces outgoing RPC requests. Wait blocks until one request
+// may be sent.
+type rateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// rpcLimiter is nil unless -rpc-rate is set.
+var rpcLimiter rateLimiter
+
+func newRateLimiter(backend string, rate float64, burst int, redisAddr, redisKey string) (rateLimiter, error) {
+	if rate <= 0 {
+		return nil, nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	switch backend {
+	case "local":
+		return newLocalLimiter(rate, burst), nil
+	case "redis":
+		return &redisLimiter{addr: redisAddr, key: redisKey, rate: rate, burst: burst}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// localLimiter is a token bucket shared by every request in this process.
+type localLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLocalLimiter(rate float64, burst int) *localLimiter {
+	return &localLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (l *localLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Taking the token up front, even into debt, keeps waiters in order
+	// without another pass through the lock.
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	pause(ctx, wait)
+	return ctx.Err()
+}
+
+// redisTokenBucket refills and takes from the bucket atomically on the Redis
+// server, using the server's clock so instances with skewed clocks still
+// share one budget. It returns 0 when a token was taken, otherwise the
+// milliseconds to wait before trying again.
+const redisTokenBucket = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`
+
+// redisLimiter shares a token bucket between every instance pointed at the
+// same Redis key. It speaks just enough RESP to run the bucket script.
+type redisLimiter struct {
+	addr  string
+	key   string
+	rate  float64
+	burst int
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (l *redisLimiter) Wait(ctx context.Context) error {
+	for {
+		wait, err := l.take(ctx)
+		if err != nil {
+			return fmt.Errorf("redis rate limiter: %v", err)
+		}
+		if wait == 0 {
+			return nil
+		}
+		pause(ctx, time.Duration(wait)*time.Millisecond)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *redisLimiter) take(ctx context.Context) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", l.addr)
+		if err != nil {
+			return 0, err
+		}
+		l.conn = conn
+		l.r = bufio.NewReader(conn)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	l.conn.SetDeadline(deadline)
+
+	wait, err := l.eval(redisTokenBucket, l.key,
+		strconv.FormatFloat(l.rate, 'f', -1, 64), strconv.Itoa(l.burst))
+	if err != nil {
+		// The connection may be left mid-reply; start fresh next time.
+		l.conn.Close()
+		l.conn = nil
+	}
+	return wait, err
+}
+
+func (l *redisLimiter) eval(script, key string, args ...string) (int64, error) {
+	command := append([]string{"EVAL", script, "1", key}, args...)
+
+	buf := []byte("*" + strconv.Itoa(len(command)) + "\r\n")
+	for _, arg := range command {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	if _, err := l.conn.Write(buf); err != nil {
+		return 0, err
+	}
+
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 {
+		return 0, fmt.Errorf("malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '-':
+		return 0, fmt.Errorf("%s", line[1:])
+	default:
+		return 0, fmt.Errorf("unexpected reply %q", line)
+	}
+}
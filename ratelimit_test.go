@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		backend string
+		rate    float64
+		want    string
+		wantErr bool
+	}{
+		{backend: "local", rate: 0, want: "<nil>"},
+		{backend: "local", rate: 5, want: "*main.localLimiter"},
+		{backend: "redis", rate: 5, want: "*main.redisLimiter"},
+		{backend: "memcached", rate: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		limiter, err := newRateLimiter(tt.backend, tt.rate, 1, "localhost:6379", "eth-parser")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s at %v: err = %v", tt.backend, tt.rate, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", limiter); !tt.wantErr && got != tt.want {
+			t.Errorf("%s at %v: limiter = %s, want %s", tt.backend, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestLocalLimiterAllowsBurstThenPaces(t *testing.T) {
+	limiter := newLocalLimiter(50, 3)
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 15*time.Millisecond {
+		t.Errorf("burst of 3 took %v, want no wait", elapsed)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("3 requests past the burst at 50/s took %v, want at least 50ms", elapsed)
+	}
+}
+
+func TestLocalLimiterStopsOnCancel(t *testing.T) {
+	limiter := newLocalLimiter(0.1, 1)
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// fakeRedis answers each command with the next queued RESP reply and
+// records what it was sent.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	replies  []string
+	commands [][]string
+	conns    int
+}
+
+func newFakeRedis(t *testing.T, replies ...string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, replies: replies}
+	t.Cleanup(func() { listener.Close() })
+	go r.serve()
+	return r
+}
+
+func (r *fakeRedis) serve() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns++
+		r.mu.Unlock()
+		go r.serveConn(conn)
+	}
+}
+
+func (r *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		command, err := readRESPArray(reader)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, command)
+		reply := "-ERR no reply queued"
+		if len(r.replies) > 0 {
+			reply, r.replies = r.replies[0], r.replies[1:]
+		}
+		r.mu.Unlock()
+		if _, err := io.WriteString(conn, reply+"\r\n"); err != nil {
+			return
+		}
+	}
+}
+
+func readRESPArray(r *bufio.Reader) ([]string, error) {
+	var count int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &count); err != nil {
+		return nil, err
+	}
+	command := make([]string, count)
+	for i := range command {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		command[i] = string(arg[:size])
+	}
+	return command, nil
+}
+
+func TestRedisLimiterRetriesUntilTokenTaken(t *testing.T) {
+	server := newFakeRedis(t, ":30", ":0")
+	limiter := &redisLimiter{addr: server.listener.Addr().String(), key: "eth-parser:rpc", rate: 2.5, burst: 4}
+
+	started := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait returned after %v, want it to pause for the 30ms the script asked for", elapsed)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != 2 || server.conns != 1 {
+		t.Fatalf("got %d commands over %d connections, want 2 over 1", len(server.commands), server.conns)
+	}
+	command := server.commands[0]
+	want := []string{"EVAL", redisTokenBucket, "1", "eth-parser:rpc", "2.5", strconv.Itoa(4)}
+	if fmt.Sprint(command) != fmt.Sprint(want) {
+		t.Errorf("command = %q", command)
+	}
+}
+
+func TestRedisLimiterReconnectsAfterError(t *testing.T) {
+	server := newFakeRedis(t, "-NOSCRIPT busy", ":0")
+	limiter := &redisLimiter{addr: server.listener.Addr().String(), key: "k", rate: 1, burst: 1}
+
+	if err := limiter.Wait(context.Background()); err == nil {
+		t.Fatal("Wait succeeded on an error reply")
+	}
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait after reconnecting: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns != 2 {
+		t.Errorf("got %d connections, want a fresh one after the error", server.conns)
+	}
+}
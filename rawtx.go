@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// fetchRawTransactions gets the signed RLP encoding of every matched
+// transaction in block with one batch of eth_getRawTransactionByHash.
+// Failures only leave the raw encoding out: the first "method not found"
+// turns the lookups off for the rest of the scan, other errors are logged.
+func (s *scanner) fetchRawTransactions(ctx context.Context, block *BlockWithTransactions) map[string]string {
+	if s.rawTransactionsUnsupported.Load() {
+		return nil
+	}
+
+	var hashes []string
+	var calls []rpcCall
+	for _, tx := range block.Transactions {
+		if s.matches(tx) {
+			hashes = append(hashes, tx.Hash)
+			calls = append(calls, rpcCall{Method: "eth_getRawTransactionByHash", Params: []interface{}{tx.Hash}})
+		}
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+
+	results, err := sendRPCBatch(ctx, calls)
+	if err != nil {
+		log.Printf("Error fetching raw transactions for block %s: %v", block.Number, err)
+		return nil
+	}
+
+	raw := make(map[string]string)
+	for i, result := range results {
+		switch {
+		case isMethodUnsupported(result.Err):
+			if !s.rawTransactionsUnsupported.Swap(true) {
+				log.Printf("Endpoint does not support eth_getRawTransactionByHash, raw transactions disabled: %v", result.Err)
+			}
+			return raw
+		case result.Err != nil:
+			log.Printf("Error fetching raw transaction %s: %v", hashes[i], result.Err)
+		default:
+			if encoded, ok := result.Response["result"].(string); ok {
+				raw[hashes[i]] = encoded
+			}
+		}
+	}
+	return raw
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestScanAddsRawTransactions(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1,
+			Transaction{Hash: "0x01", From: watched, To: other},
+			Transaction{Hash: "0x02", From: other, To: "0xcc"},
+			Transaction{Hash: "0x03", From: other, To: watched},
+		),
+		testBlock(2, Transaction{Hash: "0x04", From: watched, To: other}),
+	)
+	var requested []string
+	node.handle("eth_getRawTransactionByHash", func(params []interface{}) (interface{}, error) {
+		hash := params[0].(string)
+		requested = append(requested, hash)
+		if hash == "0x04" {
+			return nil, fmt.Errorf("transaction indexing is in progress")
+		}
+		return "0xf86c" + hash[2:], nil
+	})
+
+	out := &recordingWriter{}
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{Concurrency: 1, RawTransactions: true}, out); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range out.matches {
+		got = append(got, m.Tx.Hash+"="+m.RawTransaction)
+	}
+	if want := "[0x01=0xf86c01 0x03=0xf86c03 0x04=]"; fmt.Sprint(got) != want {
+		t.Errorf("raw transactions = %v, want %s", got, want)
+	}
+	if fmt.Sprint(requested) != "[0x01 0x03 0x04]" {
+		t.Errorf("requested %v, want only the matches", requested)
+	}
+	if rec := newMatchRecord(out.matches[0]); rec.RawTransaction != "0xf86c01" {
+		t.Errorf("record rawTransaction = %q", rec.RawTransaction)
+	}
+}
+
+func TestScanStopsRawTransactionLookupsWhenUnsupported(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}),
+		testBlock(3, Transaction{Hash: "0x03", From: watched, To: other}),
+	)
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 3, scanOptions{Concurrency: 1, RawTransactions: true}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Matches != 3 || len(summary.FailedBlocks) != 0 {
+		t.Errorf("summary = %+v, want every match kept", summary)
+	}
+	if calls := node.callCount("eth_getRawTransactionByHash"); calls != 1 {
+		t.Errorf("eth_getRawTransactionByHash called %d times, want once before giving up", calls)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	receiptPollInterval = 2 * time.Second
+	defaultWaitTimeout  = 60 * time.Second
+	maxWaitTimeout      = 10 * time.Minute
+)
+
+type TransactionReceipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	BlockHash         string `json:"blockHash"`
+	BlockNumber       string `json:"blockNumber"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	ContractAddress   string `json:"contractAddress"`
+	GasUsed           string `json:"gasUsed"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	Status            string `json:"status"`
+	Logs              []Log  `json:"logs"`
+}
+
+// getTransactionReceipt returns a nil receipt without error while the
+// transaction is still pending or unknown to the node.
+func getTransactionReceipt(ctx context.Context, hash string) (*TransactionReceipt, error) {
+	response, err := sendRPCRequestContext(ctx, "eth_getTransactionReceipt", []interface{}{hash})
+	if err != nil {
+		return nil, err
+	}
+
+	if response["result"] == nil {
+		return nil, nil
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt TransactionReceipt
+	if err := json.Unmarshal(resultBytes, &receipt); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+func waitForReceipt(ctx context.Context, hash string, pollInterval time.Duration) (*TransactionReceipt, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := getTransactionReceipt(ctx, hash)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if receipt != nil {
+			return receipt, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func waitForHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "Please provide a hash parameter", http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultWaitTimeout
+	if timeoutParam := r.URL.Query().Get("timeout"); timeoutParam != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutParam)
+		if err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			http.Error(w, "Invalid timeout parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	receipt, err := waitForReceipt(ctx, hash, receiptPollInterval)
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, fmt.Sprintf("Timed out waiting for transaction %s to be mined", hash), http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching transaction receipt: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if writeCacheHeaders(w, r, receipt.BlockHash+receipt.TransactionHash, isFinalized(r.Context(), receipt.BlockNumber)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
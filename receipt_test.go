@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitForHandlerTimesOut(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_getTransactionReceipt", nil)
+
+	rec := httptest.NewRecorder()
+	waitForHandler(rec, httptest.NewRequest(http.MethodGet, "/wait-for?hash=0xabc&timeout=50ms", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusGatewayTimeout, rec.Body)
+	}
+	if node.callCount("eth_getTransactionReceipt") == 0 {
+		t.Error("handler never polled for the receipt")
+	}
+}
+
+func TestWaitForHandlerReturnsReceipt(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_getTransactionReceipt", map[string]interface{}{
+		"transactionHash": "0xabc",
+		"blockHash":       "0xb10c",
+		"blockNumber":     "0x10",
+		"status":          "0x1",
+	})
+	node.result("eth_getBlockByNumber", map[string]interface{}{"number": "0x20", "hash": "0xf1", "transactions": []interface{}{}})
+
+	rec := httptest.NewRecorder()
+	waitForHandler(rec, httptest.NewRequest(http.MethodGet, "/wait-for?hash=0xabc", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var receipt TransactionReceipt
+	if err := json.NewDecoder(rec.Body).Decode(&receipt); err != nil {
+		t.Fatalf("decoding receipt: %v", err)
+	}
+	if receipt.TransactionHash != "0xabc" || receipt.Status != "0x1" {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control = %q for a finalized receipt", got)
+	}
+}
+
+func TestWaitForHandlerRejectsBadTimeout(t *testing.T) {
+	newFakeNode(t)
+	for _, timeout := range []string{"soon", "-1s", "11m"} {
+		rec := httptest.NewRecorder()
+		waitForHandler(rec, httptest.NewRequest(http.MethodGet, "/wait-for?hash=0xabc&timeout="+timeout, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("timeout=%s: status = %d, want %d", timeout, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWaitForReceiptPollsUntilMined(t *testing.T) {
+	const pending = 3
+	node := newFakeNode(t)
+	node.handle("eth_getTransactionReceipt", func([]interface{}) (interface{}, error) {
+		if node.callCount("eth_getTransactionReceipt") <= pending {
+			return nil, nil
+		}
+		return map[string]interface{}{"transactionHash": "0xabc", "blockNumber": "0x10", "status": "0x1"}, nil
+	})
+
+	receipt, err := waitForReceipt(context.Background(), "0xabc", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.TransactionHash != "0xabc" || receipt.BlockNumber != "0x10" {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if calls := node.callCount("eth_getTransactionReceipt"); calls != pending+1 {
+		t.Errorf("polled %d times, want %d", calls, pending+1)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// callRevert is returned by callAtBlock when the call executed but reverted.
+// Reason is decoded from Data when the node returned revert data.
+type callRevert struct {
+	Message string
+	Data    string
+	Reason  string
+}
+
+func (e *callRevert) Error() string {
+	if e.Reason == "" {
+		return e.Message
+	}
+	return "execution reverted: " + e.Reason
+}
+
+// isMissingState reports errors from nodes that have pruned the requested
+// block's state, which only an archive node keeps.
+func isMissingState(err error) bool {
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+
+	message := strings.ToLower(rpcErr.Message)
+	for _, hint := range []string{"missing trie node", "historical state", "state not available", "state is not available", "pruned", "archive"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func getTransactionByHash(ctx context.Context, hash string) (*Transaction, error) {
+	response, err := sendRPCRequestContext(ctx, "eth_getTransactionByHash", []interface{}{hash})
+	if err != nil {
+		return nil, err
+	}
+
+	if response["result"] == nil {
+		return nil, nil
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var tx Transaction
+	if err := json.Unmarshal(resultBytes, &tx); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// callAtBlock executes tx with eth_call against the state at blockNumber
+// and returns the call's return data.
+func callAtBlock(ctx context.Context, tx Transaction, blockNumber string) (string, error) {
+	call := map[string]string{"from": tx.From, "data": tx.Input}
+	if tx.To != "" {
+		call["to"] = tx.To
+	}
+	if tx.Value != "" {
+		call["value"] = tx.Value
+	}
+
+	response, err := sendRPCRequestContext(ctx, "eth_call", []interface{}{call, blockNumber})
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) && (rpcErr.Code == 3 || strings.Contains(strings.ToLower(rpcErr.Message), "revert")) {
+		revert := &callRevert{Message: rpcErr.Message}
+		revert.Data, _ = rpcErr.Data.(string)
+		revert.Reason = decodeRevertReason(revert.Data)
+		return "", revert
+	}
+	if isMissingState(err) {
+		return "", fmt.Errorf("state at block %s is not available on this node; replaying historical blocks needs an archive node: %w", blockNumber, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	result, _ := response["result"].(string)
+	return result, nil
+}
+
+type replayResult struct {
+	Block      int64  `json:"block"`
+	Result     string `json:"result,omitempty"`
+	Reverted   bool   `json:"reverted"`
+	Reason     string `json:"revertReason,omitempty"`
+	RevertData string `json:"revertData,omitempty"`
+}
+
+// replayHandler re-executes a mined transaction at a chosen block. Without a
+// block parameter it runs against the state just before the transaction's
+// own block.
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "Please provide a hash parameter", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := getTransactionByHash(r.Context(), hash)
+	if err != nil {
+		http.Error(w, "Error fetching transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tx == nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	var block int64
+	if blockParam := r.URL.Query().Get("block"); blockParam != "" {
+		block, err = strconv.ParseInt(blockParam, 10, 64)
+		if err != nil || block < 0 {
+			http.Error(w, "Invalid block parameter", http.StatusBadRequest)
+			return
+		}
+	} else {
+		mined, err := parseQuantity(tx.BlockNumber)
+		if err != nil || mined.Sign() == 0 {
+			http.Error(w, "Transaction is not mined; provide a block parameter", http.StatusBadRequest)
+			return
+		}
+		block = mined.Int64() - 1
+	}
+
+	result := replayResult{Block: block}
+	result.Result, err = callAtBlock(r.Context(), *tx, fmt.Sprintf("0x%x", block))
+	var revert *callRevert
+	if errors.As(err, &revert) {
+		result.Reverted = true
+		result.Reason = revert.Error()
+		result.RevertData = revert.Data
+	} else if isMissingState(err) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		http.Error(w, "Error replaying transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReplayHandlerCallsAtParentBlock(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_getTransactionByHash", Transaction{Hash: "0x01", From: watched, To: other, Input: "0x70a08231", Value: "0x0", BlockNumber: "0x10"})
+	var calledAt []interface{}
+	node.handle("eth_call", func(params []interface{}) (interface{}, error) {
+		calledAt = append(calledAt, params[1])
+		call := params[0].(map[string]interface{})
+		if call["from"] != watched || call["to"] != other || call["data"] != "0x70a08231" {
+			t.Errorf("call object = %v", call)
+		}
+		return "0x2a", nil
+	})
+
+	result, rec := getJSON[replayResult](t, replayHandler, "/replay?hash=0x01")
+	if rec.Code != http.StatusOK || result.Block != 15 || result.Result != "0x2a" || result.Reverted {
+		t.Errorf("default block: %d %+v", rec.Code, result)
+	}
+	result, _ = getJSON[replayResult](t, replayHandler, "/replay?hash=0x01&block=100")
+	if result.Block != 100 {
+		t.Errorf("explicit block: %+v", result)
+	}
+	if len(calledAt) != 2 || calledAt[0] != "0xf" || calledAt[1] != "0x64" {
+		t.Errorf("eth_call blocks = %v", calledAt)
+	}
+}
+
+func TestReplayHandlerErrors(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_getTransactionByHash", nil)
+	if _, rec := getJSON[replayResult](t, replayHandler, "/replay?hash=0x01"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown transaction: status = %d", rec.Code)
+	}
+
+	node.result("eth_getTransactionByHash", Transaction{Hash: "0x01", From: watched})
+	if _, rec := getJSON[replayResult](t, replayHandler, "/replay?hash=0x01"); rec.Code != http.StatusBadRequest {
+		t.Errorf("pending transaction without block: status = %d", rec.Code)
+	}
+
+	node.handle("eth_call", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32000, Message: "missing trie node abc (path )"}
+	})
+	if _, rec := getJSON[replayResult](t, replayHandler, "/replay?hash=0x01&block=1"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("pruned state: status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
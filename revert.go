@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	errorStringSelector = "0x08c379a0"
+	panicSelector       = "0x4e487b71"
+)
+
+// decodeRevertReason turns ABI-encoded revert data into a readable reason.
+// Error(string) yields the string and Panic(uint256) the panic code. Custom
+// errors can't be decoded without their ABI, so only their selector is
+// returned.
+func decodeRevertReason(data string) string {
+	data = strings.ToLower(data)
+	if len(data) < 10 {
+		return ""
+	}
+	selector := data[:10]
+	payload, err := hex.DecodeString(data[10:])
+	if err != nil {
+		return selector
+	}
+
+	switch selector {
+	case errorStringSelector:
+		if reason, ok := decodeABIString(payload); ok {
+			return reason
+		}
+	case panicSelector:
+		if len(payload) >= 32 {
+			return fmt.Sprintf("panic 0x%x", new(big.Int).SetBytes(payload[:32]))
+		}
+	}
+	return selector
+}
+
+// decodeABIString reads a single dynamic string argument: an offset word,
+// then a length word, then the padded bytes.
+func decodeABIString(payload []byte) (string, bool) {
+	if len(payload) < 64 {
+		return "", false
+	}
+	// The words come from the node, so bound them by the payload before
+	// converting, or a huge value overflows the arithmetic below.
+	offset := new(big.Int).SetBytes(payload[:32])
+	if offset.Cmp(big.NewInt(int64(len(payload)-32))) > 0 {
+		return "", false
+	}
+	start := offset.Int64() + 32
+	length := new(big.Int).SetBytes(payload[start-32 : start])
+	if length.Cmp(big.NewInt(int64(len(payload))-start)) > 0 {
+		return "", false
+	}
+	return string(payload[start : start+length.Int64()]), true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// errorStringData ABI-encodes Error(reason).
+func errorStringData(reason string) string {
+	padded := make([]byte, (len(reason)+31)/32*32)
+	copy(padded, reason)
+	return errorStringSelector + fmt.Sprintf("%064x%064x", 32, len(reason)) + hex.EncodeToString(padded)
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "error string", data: errorStringData("insufficient balance"), want: "insufficient balance"},
+		{name: "upper case hex", data: strings.ToUpper(errorStringData("nope")), want: "nope"},
+		{name: "panic", data: panicSelector + fmt.Sprintf("%064x", 0x11), want: "panic 0x11"},
+		{name: "custom error", data: "0xdeadbeef" + fmt.Sprintf("%064x", 1), want: "0xdeadbeef"},
+		{name: "truncated error string", data: errorStringSelector + fmt.Sprintf("%064x", 32), want: errorStringSelector},
+		{name: "huge offset", data: errorStringSelector + fmt.Sprintf("%064x%064x", uint64(0x7fffffffffffffff), 4) + hex.EncodeToString(make([]byte, 32)), want: errorStringSelector},
+		{name: "huge length", data: errorStringSelector + fmt.Sprintf("%064x%064x", 32, uint64(0x7fffffffffffffff)) + hex.EncodeToString(make([]byte, 32)), want: errorStringSelector},
+		{name: "length past the end", data: errorStringSelector + fmt.Sprintf("%064x%064x", 32, 33) + hex.EncodeToString(make([]byte, 32)), want: errorStringSelector},
+		{name: "offset past uint64", data: errorStringSelector + strings.Repeat("f", 64) + fmt.Sprintf("%064x", 0), want: errorStringSelector},
+		{name: "bad hex", data: "0xdeadbeefzz", want: "0xdeadbeef"},
+		{name: "too short", data: "0x08c3", want: ""},
+		{name: "empty", data: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeRevertReason(tt.data); got != tt.want {
+				t.Errorf("decodeRevertReason(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayHandlerReportsRevert(t *testing.T) {
+	node := newFakeNode(t)
+	node.result("eth_getTransactionByHash", Transaction{Hash: "0x01", From: watched, To: other, BlockNumber: "0x10"})
+	data := errorStringData("transfer amount exceeds balance")
+	node.handle("eth_call", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: 3, Message: "execution reverted", Data: data}
+	})
+
+	result, rec := getJSON[replayResult](t, replayHandler, "/replay?hash=0x01")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if !result.Reverted || result.Reason != "execution reverted: transfer amount exceeds balance" || result.RevertData != data {
+		t.Errorf("result = %+v", result)
+	}
+}
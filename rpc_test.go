@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateRPCResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{name: "valid", payload: `{"jsonrpc":"2.0","id":7,"result":"0x1"}`},
+		{name: "wrong version", payload: `{"jsonrpc":"1.0","id":7,"result":"0x1"}`, wantErr: "unexpected jsonrpc version"},
+		{name: "missing version", payload: `{"id":7,"result":"0x1"}`, wantErr: "unexpected jsonrpc version"},
+		{name: "wrong id", payload: `{"jsonrpc":"2.0","id":8,"result":"0x1"}`, wantErr: "does not match request id 7"},
+		{name: "string id", payload: `{"jsonrpc":"2.0","id":"7","result":"0x1"}`, wantErr: "does not match request id 7"},
+		{name: "null id on an error", payload: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`},
+		{name: "null id on a result", payload: `{"jsonrpc":"2.0","id":null,"result":"0x1"}`, wantErr: "does not match request id 7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+				t.Fatal(err)
+			}
+			err := validateRPCResponse(payload, 7)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendRPCRequestRejectsMismatchedResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   func(id int64) map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "wrong id",
+			reply: func(id int64) map[string]interface{} {
+				return map[string]interface{}{"jsonrpc": "2.0", "id": id + 1, "result": "0x1"}
+			},
+			wantErr: "does not match request id",
+		},
+		{
+			name: "wrong version",
+			reply: func(id int64) map[string]interface{} {
+				return map[string]interface{}{"jsonrpc": "1.0", "id": id, "result": "0x1"}
+			},
+			wantErr: "unexpected jsonrpc version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var call RequestPayload
+				json.NewDecoder(r.Body).Decode(&call)
+				writeJSON(w, tt.reply(call.ID))
+			}))
+			defer server.Close()
+			previous := currentCredentials.Load()
+			currentCredentials.Store(&rpcCredentials{Endpoint: server.URL})
+			defer currentCredentials.Store(previous)
+
+			_, err := sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRPCRequestIDsAreUnique(t *testing.T) {
+	seen := make(map[int64]bool)
+	for i := 0; i < 100; i++ {
+		id := newRPCPayload("eth_blockNumber", nil).ID
+		if seen[id] {
+			t.Fatalf("id %d reused", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSendRPCRequestReturnsRPCError(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_call", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: 3, Message: "execution reverted"}
+	})
+
+	_, err := sendRPCRequestContext(context.Background(), "eth_call", []interface{}{})
+	rpcErr, ok := err.(*rpcError)
+	if !ok || rpcErr.Code != 3 {
+		t.Fatalf("error = %#v, want rpc error code 3", err)
+	}
+}
+
+func TestSendRPCRequestReportsErrorWithNullID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{"code": -32600, "message": "invalid request"}})
+	}))
+	defer server.Close()
+	previous := currentCredentials.Load()
+	currentCredentials.Store(&rpcCredentials{Endpoint: server.URL})
+	defer currentCredentials.Store(previous)
+
+	_, err := sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{})
+	rpcErr, ok := err.(*rpcError)
+	if !ok || rpcErr.Code != -32600 {
+		t.Fatalf("error = %v, want the node's invalid request error", err)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBlockRetries     = 2
+	blockRetryBackoff       = time.Second
+	defaultProgressInterval = time.Second
+)
+
+type scanOptions struct {
+	Concurrency   int
+	Retries       int
+	ReorderBuffer int
+	SelfDestructs bool
+	Withdrawals   bool
+	StreamDecode  bool
+	TraceFilter   bool
+	Filter        txPredicate
+	Store         *Store
+	storeBatch    *storeBatch
+	Stats         *scanStats
+
+	// VerifyContinuity checks that each block's parentHash is the hash of the
+	// block before it, flagging reorgs or bad data in the summary.
+	VerifyContinuity bool
+
+	// Receipts fetches each block's receipts in the same batch as the block
+	// and adds status and gas used to matches. It takes precedence over
+	// StreamDecode.
+	Receipts bool
+
+	// Events decodes the logs of matched transactions from their receipts.
+	// With EventSample below 1 only that fraction of them is decoded, and
+	// receipts are only fetched for those when Receipts is off.
+	Events      bool
+	EventSample float64
+
+	// RawTransactions adds each match's signed RLP encoding, on endpoints
+	// with eth_getRawTransactionByHash.
+	RawTransactions bool
+
+	// GasUtilization adds each scanned block's gasUsed/gasLimit to the
+	// summary.
+	GasUtilization bool
+
+	// CodeSizes, when set, adds the code size of each match's recipient.
+	CodeSizes *codeSizeCache
+
+	// EmitLimit, when set, caps how many matches are written and stored.
+	// The scan still runs to the end and counts every match.
+	EmitLimit int64
+
+	// USDPrice, when set, adds each match's value in USD.
+	USDPrice float64
+
+	// ChainID, when set, labels every match with the chain it came from.
+	ChainID int64
+
+	// Head, when set, is the latest block matches count their
+	// confirmations from.
+	Head int64
+
+	// MaxBlocksPerSecond caps how fast the scan advances through the range,
+	// independently of how many RPC calls each block needs. Zero means no cap.
+	MaxBlocksPerSecond float64
+
+	// Progress, when set, is called with the number of blocks processed so
+	// far, at most once per ProgressInterval and always once at the end.
+	Progress         func(processed, total int64)
+	ProgressInterval time.Duration
+}
+
+func (o *scanOptions) confirmations(blockNumber string) *int64 {
+	if o.Head == 0 {
+		return nil
+	}
+	confirmations := confirmationsAt(blockNumber, o.Head)
+	return &confirmations
+}
+
+type scanner struct {
+	addresses  []string
+	opts       scanOptions
+	out        matchWriter
+	duplicates *duplicateDetector
+
+	started        time.Time
+	deferredBlocks []int64
+	summary        scanSummary
+
+	previousHash string
+
+	processed      int64
+	total          int64
+	lastProgressAt time.Time
+	lastReported   int64
+
+	tracingUnsupported         atomic.Bool
+	blockReceiptsUnsupported   atomic.Bool
+	rawTransactionsUnsupported atomic.Bool
+}
+
+type scanSummary struct {
+	BlocksScanned   int64                `json:"blocksScanned"`
+	Matches         int64                `json:"matches"`
+	Emitted         int64                `json:"emitted"`
+	FailedBlocks    []int64              `json:"failedBlocks"`
+	Discontinuities []chainDiscontinuity `json:"discontinuities,omitempty"`
+	DurationSeconds float64              `json:"durationSeconds"`
+
+	// BlockMatches counts matches per block for blocks that had any. It is
+	// dropped, and BlockMatchesTruncated set, once more than
+	// maxBlockMatchCounts blocks have matched.
+	BlockMatches          map[int64]int64 `json:"blockMatches,omitempty"`
+	BlockMatchesTruncated bool            `json:"blockMatchesTruncated,omitempty"`
+
+	// EventSample is set when only that fraction of matches had their
+	// events decoded.
+	EventSample float64 `json:"eventSample,omitempty"`
+
+	GasUtilization *gasUtilization `json:"gasUtilization,omitempty"`
+
+	// Withdrawals counts validator withdrawals to watched addresses, when
+	// the scan looks for them.
+	Withdrawals int64 `json:"withdrawals,omitempty"`
+}
+
+const maxBlockMatchCounts = 1000
+
+func (s *scanSummary) countMatch(block int64) {
+	s.Matches++
+	if s.BlockMatchesTruncated {
+		return
+	}
+	if s.BlockMatches == nil {
+		s.BlockMatches = make(map[int64]int64)
+	}
+	if _, ok := s.BlockMatches[block]; !ok && len(s.BlockMatches) >= maxBlockMatchCounts {
+		s.BlockMatches = nil
+		s.BlockMatchesTruncated = true
+		return
+	}
+	s.BlockMatches[block]++
+}
+
+type chainDiscontinuity struct {
+	Block        int64  `json:"block"`
+	ParentHash   string `json:"parentHash"`
+	PreviousHash string `json:"previousHash"`
+}
+
+func (s *scanner) reportProgress(final bool) {
+	if s.opts.Progress == nil {
+		return
+	}
+	now := time.Now()
+	if s.processed == s.lastReported || (!final && now.Sub(s.lastProgressAt) < s.opts.ProgressInterval) {
+		return
+	}
+	s.lastProgressAt = now
+	s.lastReported = s.processed
+	s.opts.Progress(s.processed, s.total)
+}
+
+// checkContinuity runs on results in block order. Blocks that only arrive
+// on the final retry pass leave a gap that is not checked.
+func (s *scanner) checkContinuity(result *blockResult) {
+	block := result.block
+	if s.previousHash != "" && block.ParentHash != s.previousHash {
+		log.Printf("Warning: block 0x%x parentHash %s does not match previous block hash %s", result.number, block.ParentHash, s.previousHash)
+		s.summary.Discontinuities = append(s.summary.Discontinuities, chainDiscontinuity{
+			Block:        result.number,
+			ParentHash:   block.ParentHash,
+			PreviousHash: s.previousHash,
+		})
+	}
+	s.previousHash = block.Hash
+}
+
+// batchStoreWrites gives a scan with a Store the batch its matches are
+// stored through, returning the flush to defer so nothing queued is lost
+// when the scan ends or is cancelled.
+func (o *scanOptions) batchStoreWrites() func() {
+	if o.Store == nil || o.storeBatch != nil {
+		return func() {}
+	}
+	o.storeBatch = o.Store.newBatch(storeBatchSize, storeFlushInterval)
+	return o.storeBatch.Flush
+}
+
+// recordMatch counts a match in the summary and stats, and writes and stores
+// it unless the scan's emit limit has been reached.
+func recordMatch(out matchWriter, opts scanOptions, summary *scanSummary, block int64, m match) error {
+	if opts.EmitLimit == 0 || summary.Emitted < opts.EmitLimit {
+		if err := out.WriteMatch(m); err != nil {
+			return err
+		}
+		if opts.storeBatch != nil {
+			opts.storeBatch.Add(newMatchRecord(m))
+		}
+		summary.Emitted++
+	}
+
+	summary.countMatch(block)
+	if opts.Stats != nil {
+		opts.Stats.Matches.Add(1)
+	}
+	return nil
+}
+
+func (s *scanner) finish() scanSummary {
+	s.summary.DurationSeconds = time.Since(s.started).Seconds()
+	return s.summary
+}
+
+type blockThrottle struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newBlockThrottle(blocksPerSecond float64) *blockThrottle {
+	if blocksPerSecond <= 0 {
+		return &blockThrottle{}
+	}
+	return &blockThrottle{interval: time.Duration(float64(time.Second) / blocksPerSecond)}
+}
+
+func (t *blockThrottle) wait(ctx context.Context) error {
+	if t.interval == 0 {
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	if t.next.After(now) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.next.Sub(now)):
+		}
+		now = t.next
+	}
+	t.next = now.Add(t.interval)
+	return nil
+}
+
+func pause(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func (s *scanner) fetchBlockWithRetry(ctx context.Context, number int64) *blockResult {
+	result := s.fetchBlock(ctx, number)
+	for attempt := 1; attempt <= s.opts.Retries && result.err != nil && ctx.Err() == nil; attempt++ {
+		log.Printf("Error fetching block 0x%x, retry %d/%d: %v", number, attempt, s.opts.Retries, result.err)
+		pause(ctx, time.Duration(attempt)*blockRetryBackoff)
+		result = s.fetchBlock(ctx, number)
+	}
+	return result
+}
+
+func (s *scanner) fetchBlock(ctx context.Context, number int64) *blockResult {
+	blockNumberHex := fmt.Sprintf("0x%x", number)
+	result := &blockResult{number: number}
+	if s.opts.Receipts || s.opts.Events {
+		result.block, result.receipts, result.err = s.fetchBlockWithReceipts(ctx, blockNumberHex)
+		if result.err == nil {
+			result.inspected = len(result.block.Transactions)
+		}
+	} else if s.opts.StreamDecode {
+		result.block, result.err = streamBlockByNumber(ctx, blockNumberHex, func(tx Transaction) bool {
+			result.inspected++
+			return s.matches(tx)
+		})
+	} else {
+		result.block, result.err = getBlockByNumber(ctx, blockNumberHex)
+		if result.err == nil {
+			result.inspected = len(result.block.Transactions)
+		}
+	}
+
+	if result.err == nil && len(result.block.TransactionHashes) > 0 {
+		result.err = fmt.Errorf("block %s returned transaction hashes instead of transactions", blockNumberHex)
+	}
+
+	if result.err == nil && s.opts.RawTransactions {
+		result.rawTransactions = s.fetchRawTransactions(ctx, result.block)
+	}
+
+	if result.err == nil && s.opts.CodeSizes != nil {
+		result.codeSizes = make(map[string]int)
+		for _, tx := range result.block.Transactions {
+			if !s.matches(tx) {
+				continue
+			}
+			if size, ok := s.opts.CodeSizes.sizeOf(ctx, tx.To); ok {
+				result.codeSizes[tx.To] = size
+			}
+		}
+	}
+
+	if _, ok := s.out.(selfDestructWriter); ok && result.err == nil && s.opts.SelfDestructs && !s.tracingUnsupported.Load() {
+		traces, err := traceBlock(ctx, blockNumberHex)
+		switch {
+		case isMethodUnsupported(err):
+			if !s.tracingUnsupported.Swap(true) {
+				log.Printf("Endpoint does not support trace_block, self-destruct detection disabled: %v", err)
+			}
+		case err != nil:
+			log.Printf("Error tracing block %s: %v", blockNumberHex, err)
+		default:
+			result.traces = traces
+		}
+	}
+
+	return result
+}
+
+// matchedAddresses returns the watched addresses a transaction touches, in
+// watch-list order, or nil when it touches none or fails the filter.
+func (s *scanner) matchedAddresses(tx Transaction) []string {
+	var matched []string
+	for _, address := range s.addresses {
+		if tx.From == address || tx.To == address {
+			matched = append(matched, address)
+		}
+	}
+	if len(matched) == 0 || (s.opts.Filter != nil && !s.opts.Filter(tx)) {
+		return nil
+	}
+	return matched
+}
+
+func (s *scanner) matches(tx Transaction) bool {
+	return s.matchedAddresses(tx) != nil
+}
+
+func (s *scanner) writeBlock(result *blockResult) error {
+	s.summary.BlocksScanned++
+	if s.opts.Stats != nil {
+		s.opts.Stats.Blocks.Add(1)
+		s.opts.Stats.Transactions.Add(int64(result.inspected))
+	}
+	block := result.block
+	if s.summary.GasUtilization != nil {
+		s.summary.GasUtilization.add(result.number, block)
+	}
+	matched := false
+	for _, tx := range block.Transactions {
+		for _, address := range s.matchedAddresses(tx) {
+			s.duplicates.check(address, tx.Hash, block.Number)
+			m := match{Address: address, Block: block, Tx: tx, Receipt: result.receipts[tx.Hash], USDPrice: s.opts.USDPrice, ChainID: s.opts.ChainID}
+			m.RawTransaction = result.rawTransactions[tx.Hash]
+			m.BlockTransactions = result.inspected
+			m.Confirmations = s.opts.confirmations(block.Number)
+			if size, ok := result.codeSizes[tx.To]; ok {
+				m.CodeSize = &size
+			}
+			if s.opts.Events {
+				decoded := m.Receipt != nil && s.opts.eventSampled(tx.Hash)
+				m.EventsDecoded = &decoded
+				if decoded {
+					m.Events = receiptEvents(m.Receipt)
+				}
+			}
+			if err := recordMatch(s.out, s.opts, &s.summary, result.number, m); err != nil {
+				return err
+			}
+			matched = true
+		}
+	}
+
+	if ww, ok := s.out.(withdrawalWriter); ok && s.opts.Withdrawals {
+		for _, withdrawal := range block.Withdrawals {
+			if !slices.Contains(s.addresses, withdrawal.Address) {
+				continue
+			}
+			if err := ww.WriteWithdrawal(block, withdrawal); err != nil {
+				return err
+			}
+			s.summary.Withdrawals++
+			matched = true
+		}
+	}
+
+	if sdw, ok := s.out.(selfDestructWriter); ok {
+		for _, address := range s.addresses {
+			for _, sd := range findSelfDestructs(result.traces, address) {
+				if err := sdw.WriteSelfDestruct(block, sd); err != nil {
+					return err
+				}
+				matched = true
+			}
+		}
+	}
+
+	if matched {
+		return s.out.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	watched = "0x00000000000000000000000000000000000000aa"
+	other   = "0x00000000000000000000000000000000000000bb"
+)
+
+// recordingWriter keeps everything a scan writes, in order.
+type recordingWriter struct {
+	matches       []match
+	selfDestructs []selfDestruct
+	withdrawals   []Withdrawal
+	flushes       int
+}
+
+func (r *recordingWriter) WriteMatch(m match) error {
+	r.matches = append(r.matches, m)
+	return nil
+}
+
+func (r *recordingWriter) WriteSelfDestruct(block *BlockWithTransactions, sd selfDestruct) error {
+	r.selfDestructs = append(r.selfDestructs, sd)
+	return nil
+}
+
+func (r *recordingWriter) WriteWithdrawal(block *BlockWithTransactions, withdrawal Withdrawal) error {
+	r.withdrawals = append(r.withdrawals, withdrawal)
+	return nil
+}
+
+func (r *recordingWriter) Flush() error {
+	r.flushes++
+	return nil
+}
+
+func (r *recordingWriter) hashes() []string {
+	hashes := make([]string, len(r.matches))
+	for i, m := range r.matches {
+		hashes[i] = m.Tx.Hash
+	}
+	return hashes
+}
+
+func TestScanReportsSelfDestructs(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2))
+	node.handle("trace_block", func(params []interface{}) (interface{}, error) {
+		if params[0] != "0x2" {
+			return []blockTrace{}, nil
+		}
+		return []blockTrace{
+			{Type: "call", TransactionHash: "0xcall", Action: traceAction{From: watched, To: other}},
+			{Type: "suicide", TransactionHash: "0xsd1", Action: traceAction{Address: watched, RefundAddress: other, Balance: "0xde0b6b3a7640000"}},
+			{Type: "suicide", TransactionHash: "0xsd2", Action: traceAction{Address: other, RefundAddress: watched, Balance: "0x1"}},
+			{Type: "suicide", TransactionHash: "0xsd3", Action: traceAction{Address: other, RefundAddress: other, Balance: "0x1"}},
+		}, nil
+	})
+
+	out := &recordingWriter{}
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{SelfDestructs: true}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.selfDestructs) != 2 {
+		t.Fatalf("got %d self-destructs, want 2: %+v", len(out.selfDestructs), out.selfDestructs)
+	}
+	if sd := out.selfDestructs[0]; sd.TransactionHash != "0xsd1" || sd.Contract != watched || sd.RefundAddress != other {
+		t.Errorf("first self-destruct = %+v", sd)
+	}
+	if sd := out.selfDestructs[1]; sd.TransactionHash != "0xsd2" || sd.RefundAddress != watched {
+		t.Errorf("second self-destruct = %+v", sd)
+	}
+}
+
+func TestNDJSONReportsSelfDestructs(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+	node.result("trace_block", []blockTrace{
+		{Type: "suicide", TransactionHash: "0xsd1", Action: traceAction{Address: watched, RefundAddress: other, Balance: "0xde0b6b3a7640000"}},
+	})
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&selfDestructs=true")
+	var events []map[string]interface{}
+	for _, line := range ndjsonLines(t, rec.Body.String()) {
+		if line["type"] == "selfDestruct" {
+			events = append(events, line)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d self-destruct events: %s", len(events), rec.Body)
+	}
+	sd := events[0]
+	if sd["transactionHash"] != "0xsd1" || sd["contract"] != watched || sd["refundAddress"] != other || sd["balanceEther"] != "1.000000" || sd["blockNumber"] != "0x1" {
+		t.Errorf("self-destruct event = %v", sd)
+	}
+}
+
+func TestScanRejectsBlockEventsTheOutputCantWrite(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+	node.result("trace_block", []blockTrace{})
+
+	for _, query := range []string{
+		"format=csv&selfDestructs=true",
+		"format=bigquery&withdrawals=true",
+		"format=blockscout&selfDestructs=true",
+		"format=sqlite&withdrawals=true",
+		"groupBy=address&selfDestructs=true",
+		"nonceGaps=true&withdrawals=true",
+	} {
+		rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&"+query)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not supported by this output") {
+			t.Errorf("%s: status %d, body %q", query, rec.Code, rec.Body)
+		}
+	}
+	if calls := node.callCount("eth_getBlockByNumber") + node.callCount("trace_block"); calls != 0 {
+		t.Errorf("made %d block calls for refused scans", calls)
+	}
+}
+
+func TestScanSkipsTracingForWritersWithoutSelfDestructs(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2))
+	node.result("trace_block", []blockTrace{})
+
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{SelfDestructs: true}, &matchCollector{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := node.callCount("trace_block"); calls != 0 {
+		t.Errorf("trace_block called %d times for a writer that drops self-destructs", calls)
+	}
+}
+
+func TestScanSkipsTracingWhenUnsupported(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3))
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 3, scanOptions{SelfDestructs: true}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.BlocksScanned != 3 || len(summary.FailedBlocks) != 0 {
+		t.Errorf("summary = %+v, want 3 blocks and no failures", summary)
+	}
+	if calls := node.callCount("trace_block"); calls != 1 {
+		t.Errorf("trace_block called %d times, want 1 before it is disabled", calls)
+	}
+}
+
+// getScan runs fetchTransactionsHandler against the fake node for the query.
+func getScan(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	fetchTransactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/fetch-transactions?"+query, nil))
+	return rec
+}
+
+func TestScanAttributesMatchesToEachAddress(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1,
+		Transaction{Hash: "0x01", From: watched, To: other},
+		Transaction{Hash: "0x02", From: other, To: "0xcc"},
+		Transaction{Hash: "0x03", From: "0xcc", To: watched},
+	))
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched, other}, 1, 1, scanOptions{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range out.matches {
+		got = append(got, m.Tx.Hash+"/"+m.Address)
+	}
+	want := []string{"0x01/" + watched, "0x01/" + other, "0x02/" + other, "0x03/" + watched}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	if summary.Matches != 4 {
+		t.Errorf("summary.Matches = %d, want 4", summary.Matches)
+	}
+}
+
+func TestGroupByAddressListsEveryAddress(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: "0xcc"}))
+
+	rec := getScan(t, "address="+watched+","+other+"&startBlock=1&endBlock=1&groupBy=address")
+	var grouped map[string][]matchRecord
+	if err := json.NewDecoder(rec.Body).Decode(&grouped); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if len(grouped[watched]) != 1 || grouped[watched][0].MatchedAddress != watched {
+		t.Errorf("%s group = %+v", watched, grouped[watched])
+	}
+	if group, ok := grouped[other]; !ok || len(group) != 0 {
+		t.Errorf("%s group = %+v, want present and empty", other, group)
+	}
+}
+
+func TestGroupByBlockCountsEveryTransaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		countKey string
+	}{
+		{name: "blocks", countKey: "transactionCount"},
+		{name: "stream decode", query: "&streamDecode=true", countKey: "transactionCount"},
+		{name: "snake case", query: "&fieldCase=snake", countKey: "transaction_count"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(t)
+			node.serveBlocks(
+				testBlock(9, Transaction{Hash: "0x01", From: watched, To: other}, Transaction{Hash: "0x02", From: other, To: "0xcc"}, Transaction{Hash: "0x03", From: other, To: watched}),
+				testBlock(10, Transaction{Hash: "0x04", From: other, To: "0xcc"}),
+			)
+
+			rec := getScan(t, "address="+watched+"&startBlock=9&endBlock=10&groupBy=block"+tt.query)
+			var grouped map[string]map[string]json.RawMessage
+			if err := json.NewDecoder(rec.Body).Decode(&grouped); err != nil {
+				t.Fatalf("decoding %q: %v", rec.Body, err)
+			}
+			if _, ok := grouped["10"]; ok || len(grouped) != 1 {
+				t.Errorf("groups = %v, want only block 9", grouped)
+			}
+			var count int
+			var records []json.RawMessage
+			json.Unmarshal(grouped["9"][tt.countKey], &count)
+			json.Unmarshal(grouped["9"]["matches"], &records)
+			if count != 3 || len(records) != 2 {
+				t.Errorf("block 9 = %d transactions, %d matches, want 3 and 2", count, len(records))
+			}
+		})
+	}
+}
+
+func TestGroupByBlockLeavesOutCountForTraceFilter(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+	serveTraceFilter(node, []blockTrace{transferTrace(5, 0, "0x01", watched, other, "0x1")})
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=5&groupBy=block&method=traceFilter")
+	var grouped map[string]map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&grouped); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	if group, ok := grouped["5"]; !ok || group["matches"] == nil || group["transactionCount"] != nil {
+		t.Errorf("block 5 group = %v, want matches without a transaction count", grouped["5"])
+	}
+}
+
+func TestScanRetriesFailedBlocksAtTheEnd(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched}),
+		testBlock(3, Transaction{Hash: "0x03", From: watched}),
+		testBlock(4, Transaction{Hash: "0x04", From: watched}),
+	)
+	serve := node.handlers["eth_getBlockByNumber"]
+	attempts := make(map[string]int)
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		number := params[0].(string)
+		attempts[number]++
+		if number == "0x4" || (number == "0x2" && attempts[number] == 1) {
+			return nil, fmt.Errorf("upstream timeout")
+		}
+		return serve(params)
+	})
+
+	out := &recordingWriter{}
+	started := time.Now()
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 4, scanOptions{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(out.hashes(), " "); got != "0x01 0x03 0x02" {
+		t.Errorf("matches = %s, want the retried block last", got)
+	}
+	if len(summary.FailedBlocks) != 1 || summary.FailedBlocks[0] != 4 {
+		t.Errorf("FailedBlocks = %v, want [4]", summary.FailedBlocks)
+	}
+	if attempts["0x4"] != 2 {
+		t.Errorf("block 4 fetched %d times, want 2", attempts["0x4"])
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("scan took %v; the final pass should rest blockPause, not a fixed delay", elapsed)
+	}
+}
+
+func TestScanFinalPassRestsBetweenBlocks(t *testing.T) {
+	previous := blockPause
+	blockPause = 100 * time.Millisecond
+	t.Cleanup(func() { blockPause = previous })
+
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched}))
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		if node.callCount("eth_getBlockByNumber") == 1 {
+			return nil, fmt.Errorf("upstream timeout")
+		}
+		return serve(params)
+	})
+
+	out := &recordingWriter{}
+	started := time.Now()
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 1, scanOptions{}, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(out.hashes(), " "); got != "0x01" {
+		t.Errorf("matches = %s, want the retried block", got)
+	}
+	if elapsed := time.Since(started); elapsed < blockPause {
+		t.Errorf("scan took %v, want a rest of blockPause after the retried block", elapsed)
+	}
+}
+
+func TestScanReportsProgress(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3), testBlock(4))
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     []int64
+	}{
+		{name: "rate limited", interval: time.Hour, want: []int64{1, 4}},
+		{name: "every block", interval: time.Nanosecond, want: []int64{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []int64
+			opts := scanOptions{
+				ProgressInterval: tt.interval,
+				Progress: func(processed, total int64) {
+					if total != 4 {
+						t.Errorf("total = %d, want 4", total)
+					}
+					reported = append(reported, processed)
+				},
+			}
+			if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 4, opts, &recordingWriter{}); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(reported) != fmt.Sprint(tt.want) {
+				t.Errorf("progress = %v, want %v", reported, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockThrottlePacesBlocks(t *testing.T) {
+	throttle := newBlockThrottle(50)
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := throttle.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 80*time.Millisecond {
+		t.Errorf("5 blocks at 50/s took %v, want at least 80ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newBlockThrottle(0).wait(ctx); err != context.Canceled {
+		t.Errorf("unthrottled wait on a cancelled context = %v", err)
+	}
+}
+
+func TestScanHonoursMaxBlocksPerSecond(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3), testBlock(4))
+
+	started := time.Now()
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 4, scanOptions{Concurrency: 4, MaxBlocksPerSecond: 40}, &recordingWriter{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 70*time.Millisecond {
+		t.Errorf("4 blocks at 40/s took %v, want at least 70ms", elapsed)
+	}
+
+	if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=4&maxBlocksPerSecond=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("maxBlocksPerSecond=0: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestScanVerifiesContinuity(t *testing.T) {
+	node := newFakeNode(t)
+	forked := testBlock(3)
+	forked.ParentHash = "0xforked"
+	node.serveBlocks(testBlock(1), testBlock(2), forked, testBlock(4))
+
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 4, scanOptions{VerifyContinuity: true}, &recordingWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []chainDiscontinuity{{Block: 3, ParentHash: "0xforked", PreviousHash: testBlock(2).Hash}}
+	if fmt.Sprint(summary.Discontinuities) != fmt.Sprint(want) {
+		t.Errorf("discontinuities = %+v, want %+v", summary.Discontinuities, want)
+	}
+
+	summary, err = fetchTransactions(context.Background(), []string{watched}, 1, 4, scanOptions{}, &recordingWriter{})
+	if err != nil || summary.Discontinuities != nil {
+		t.Errorf("unchecked scan: discontinuities = %+v, err = %v", summary.Discontinuities, err)
+	}
+}
+
+func TestSummaryBlockMatchesAreBounded(t *testing.T) {
+	var summary scanSummary
+	summary.countMatch(5)
+	summary.countMatch(5)
+	summary.countMatch(9)
+	if summary.Matches != 3 || fmt.Sprint(summary.BlockMatches) != "map[5:2 9:1]" {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	for block := int64(100); block < 100+maxBlockMatchCounts; block++ {
+		summary.countMatch(block)
+	}
+	if !summary.BlockMatchesTruncated || summary.BlockMatches != nil {
+		t.Errorf("after %d blocks: truncated = %v, %d counts kept", maxBlockMatchCounts+2, summary.BlockMatchesTruncated, len(summary.BlockMatches))
+	}
+	if summary.Matches != 3+maxBlockMatchCounts {
+		t.Errorf("Matches = %d, want every match counted", summary.Matches)
+	}
+}
+
+func TestScanEmitLimitCountsEveryMatch(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched}, Transaction{Hash: "0x02", From: watched}),
+		testBlock(2, Transaction{Hash: "0x03", From: watched}),
+		testBlock(3, Transaction{Hash: "0x04", To: watched}),
+	)
+	s := newStore()
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 3, scanOptions{EmitLimit: 2, Store: s}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(out.hashes(), " "); got != "0x01 0x02" {
+		t.Errorf("written = %s, want the first 2", got)
+	}
+	if summary.Matches != 4 || summary.Emitted != 2 || summary.BlocksScanned != 3 {
+		t.Errorf("summary = %+v, want 4 matches, 2 emitted, 3 blocks", summary)
+	}
+	if results, total := s.Transactions(watched, nil, 0, 10); total != 2 {
+		t.Errorf("stored %v, want only the emitted matches", recordHashes(results))
+	}
+
+	for _, limit := range []string{"0", "-1", "many"} {
+		if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=3&emitLimit="+limit); rec.Code != http.StatusBadRequest {
+			t.Errorf("emitLimit=%s: status = %d, want %d", limit, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// serveHashOnlyBlocks makes the node answer every block request in the
+// full=false shape.
+func serveHashOnlyBlocks(node *fakeNode) {
+	serve := node.handlers["eth_getBlockByNumber"]
+	node.handle("eth_getBlockByNumber", func(params []interface{}) (interface{}, error) {
+		return serve([]interface{}{params[0], false})
+	})
+}
+
+func TestScanFailsBlocksWithOnlyHashes(t *testing.T) {
+	for _, streamDecode := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streamDecode=%v", streamDecode), func(t *testing.T) {
+			node := newFakeNode(t)
+			node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched}), testBlock(2))
+			serveHashOnlyBlocks(node)
+
+			out := &recordingWriter{}
+			summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{StreamDecode: streamDecode}, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(summary.FailedBlocks) != "[1]" || len(out.matches) != 0 {
+				t.Errorf("failed = %v, matches = %v, want block 1 failed", summary.FailedBlocks, out.hashes())
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanLimits is nil unless -scan-rate is set.
+var scanLimits *keyedLimiter
+
+// keyedLimiter keeps a token bucket per client so one requester launching
+// scans can't starve the others. Unlike localLimiter it never waits: a
+// request without a token is refused. A bucket left idle long enough to
+// refill completely is the same as a new one, so those are evicted.
+type keyedLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	byAddress bool
+	buckets   map[string]*keyedBucket
+	swept     time.Time
+}
+
+type keyedBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newKeyedLimiter(key string, rate float64, burst int) (*keyedLimiter, error) {
+	if rate <= 0 {
+		return nil, nil
+	}
+	if key != "ip" && key != "address" {
+		return nil, fmt.Errorf("unknown scan rate key %q", key)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &keyedLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		byAddress: key == "address",
+		buckets:   make(map[string]*keyedBucket),
+		swept:     time.Now(),
+	}, nil
+}
+
+// key is the client's IP, or the requested addresses with -scan-rate-key
+// address. X-Forwarded-For is ignored since any client can set it.
+func (l *keyedLimiter) key(r *http.Request) string {
+	if l.byAddress {
+		return strings.ToLower(strings.Join(r.URL.Query()["address"], ","))
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allow takes a token from key's bucket. When there is none it returns
+// false and how long until one is available.
+func (l *keyedLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idle := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) >= idle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= idle {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &keyedBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// allowScan writes a 429 and returns false when the client is over its scan
+// rate.
+func allowScan(w http.ResponseWriter, r *http.Request) bool {
+	if scanLimits == nil {
+		return true
+	}
+	ok, wait := scanLimits.allow(scanLimits.key(r), time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many scans, try again later", http.StatusTooManyRequests)
+	}
+	return ok
+}
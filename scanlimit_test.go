@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewKeyedLimiter(t *testing.T) {
+	if l, err := newKeyedLimiter("ip", 0, 5); l != nil || err != nil {
+		t.Errorf("rate 0 = %v, %v, want no limiter", l, err)
+	}
+	if _, err := newKeyedLimiter("token", 1, 1); err == nil {
+		t.Error("accepted an unknown key")
+	}
+	if l, err := newKeyedLimiter("address", 1, 0); err != nil || l.burst != 1 || !l.byAddress {
+		t.Errorf("limiter = %+v, %v", l, err)
+	}
+}
+
+func TestKeyedLimiterAllow(t *testing.T) {
+	l, _ := newKeyedLimiter("ip", 2, 3)
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a", start); !ok {
+			t.Fatalf("scan %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a", start)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("over the burst: allow = %v, wait %v, want refused for 500ms", ok, wait)
+	}
+	if ok, _ := l.allow("b", start); !ok {
+		t.Error("another client was refused")
+	}
+	if ok, _ := l.allow("a", start.Add(500*time.Millisecond)); !ok {
+		t.Error("refused after a token refilled")
+	}
+
+	l.allow("b", start.Add(10*time.Second))
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets = %v, want the idle one evicted", l.buckets)
+	}
+}
+
+func TestKeyedLimiterKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/fetch-transactions?address=0xAA&address=0xbb", nil)
+	r.RemoteAddr = "198.51.100.7:51234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+	byIP, _ := newKeyedLimiter("ip", 1, 1)
+	byAddress, _ := newKeyedLimiter("address", 1, 1)
+	if got := byIP.key(r); got != "198.51.100.7" {
+		t.Errorf("ip key = %q", got)
+	}
+	if got := byAddress.key(r); got != "0xaa,0xbb" {
+		t.Errorf("address key = %q", got)
+	}
+}
+
+func TestScanRateLimitRefusesWithRetryAfter(t *testing.T) {
+	previous := scanLimits
+	scanLimits, _ = newKeyedLimiter("ip", 0.1, 1)
+	t.Cleanup(func() { scanLimits = previous })
+
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+
+	if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1"); rec.Code != http.StatusOK {
+		t.Fatalf("first scan: status = %d: %s", rec.Code, rec.Body)
+	}
+	calls := node.callCount("eth_blockNumber")
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "10" {
+		t.Errorf("second scan: status = %d, Retry-After = %q, want 429 after 10s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if node.callCount("eth_blockNumber") != calls {
+		t.Error("the refused scan still called the node")
+	}
+}
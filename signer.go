@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestSigner adds whatever signature a provider expects to an outgoing
+// RPC request, given the exact body that will be sent.
+type requestSigner interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// rpcSigner signs every RPC request when set, with -sign-secret-file.
+var rpcSigner requestSigner
+
+// hmacSigner puts the hex HMAC-SHA256 of the request body in Header.
+type hmacSigner struct {
+	Header string
+	Secret []byte
+}
+
+func (s hmacSigner) Sign(req *http.Request, body []byte) error {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(body)
+	req.Header.Set(s.Header, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
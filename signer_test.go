@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestHMACSignerSignsEachRequestBody(t *testing.T) {
+	secret := []byte("s3cret")
+	var mu sync.Mutex
+	var unsigned int
+	node := newFakeNode(t)
+	node.result("eth_blockNumber", "0x10")
+	handler := node.server.Config.Handler
+	node.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if got := r.Header.Get("X-Test-Signature"); got != hex.EncodeToString(mac.Sum(nil)) {
+			mu.Lock()
+			unsigned++
+			mu.Unlock()
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	})
+
+	previous := rpcSigner
+	rpcSigner = hmacSigner{Header: "X-Test-Signature", Secret: secret}
+	t.Cleanup(func() { rpcSigner = previous })
+
+	if _, err := sendRPCRequestContext(context.Background(), "eth_blockNumber", []interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := sendRPCBatch(context.Background(), []rpcCall{{Method: "eth_blockNumber"}, {Method: "eth_blockNumber"}})
+	if err != nil || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("batch = %+v, %v", results, err)
+	}
+	if node.batches != 1 {
+		t.Errorf("batches = %d, want 1", node.batches)
+	}
+	if unsigned != 0 {
+		t.Errorf("%d requests had no valid signature", unsigned)
+	}
+}
+
+func TestHMACSignerHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := (hmacSigner{Header: "X-Signature", Secret: []byte("key")}).Sign(req, []byte("The quick brown fox jumps over the lazy dog")); err != nil {
+		t.Fatal(err)
+	}
+	// The widely published HMAC-SHA256 example for this key and message.
+	want := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got := req.Header.Get("X-Signature"); got != want {
+		t.Errorf("X-Signature = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// This file writes scan results as a self-contained SQLite database. There is
+// no SQLite driver in the standard library, so it lays out the file format
+// directly: a freshly built database with one table and its indexes, every
+// b-tree packed bottom-up and no overflow pages.
+
+const (
+	sqlitePageSize = 4096
+
+	// sqliteMaxLocalPayload is the largest table record stored without
+	// overflow pages (usable size - 35); sqliteMaxIndexPayload the same for
+	// index keys ((usable-12)*64/255 - 23).
+	sqliteMaxLocalPayload = sqlitePageSize - 35
+	sqliteMaxIndexPayload = (sqlitePageSize-12)*64/255 - 23
+
+	sqlitePageTableInterior = 0x05
+	sqlitePageTableLeaf     = 0x0d
+	sqlitePageIndexInterior = 0x02
+	sqlitePageIndexLeaf     = 0x0a
+)
+
+const sqliteTransactionsTable = `CREATE TABLE transactions (
+	id INTEGER PRIMARY KEY,
+	block_number INTEGER NOT NULL,
+	transaction_index INTEGER,
+	hash TEXT NOT NULL,
+	from_address TEXT,
+	to_address TEXT,
+	value TEXT,
+	value_ether TEXT,
+	gas_price TEXT,
+	selector TEXT,
+	matched_address TEXT NOT NULL,
+	action TEXT
+)`
+
+var sqliteIndexes = []struct {
+	name   string
+	sql    string
+	column func(matchRecord) interface{}
+}{
+	{
+		name:   "transactions_matched_address",
+		sql:    "CREATE INDEX transactions_matched_address ON transactions (matched_address)",
+		column: func(r matchRecord) interface{} { return r.MatchedAddress },
+	},
+	{
+		name:   "transactions_block_number",
+		sql:    "CREATE INDEX transactions_block_number ON transactions (block_number)",
+		column: func(r matchRecord) interface{} { return recordPosition(r).Block },
+	},
+}
+
+func sqliteTransactionRow(r matchRecord) []interface{} {
+	position := recordPosition(r)
+	var index interface{}
+	if r.TransactionIndex != "" {
+		index = position.Index
+	}
+	var value, gasPrice interface{}
+	if decimal := decimalQuantity(r.Value); decimal != nil {
+		value = *decimal
+	}
+	if decimal := decimalQuantity(r.GasPrice); decimal != nil {
+		gasPrice = *decimal
+	}
+	return []interface{}{
+		nil, // id aliases the rowid, so the record stores NULL
+		position.Block,
+		index,
+		r.Hash,
+		sqliteText(r.From),
+		sqliteText(r.To),
+		value,
+		r.ValueEther,
+		gasPrice,
+		sqliteText(transactionSelector(r.Transaction)),
+		r.MatchedAddress,
+		r.Action,
+	}
+}
+
+func sqliteText(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		var tmp [9]byte
+		tmp[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			tmp[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, tmp[:]...)
+	}
+
+	var tmp [9]byte
+	n := 0
+	for {
+		tmp[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := tmp[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// sqliteRecord encodes values (nil, int64 or string) in the record format:
+// a header of serial types followed by the values.
+func sqliteRecord(values ...interface{}) []byte {
+	var types, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = appendVarint(types, 0)
+		case int64:
+			types, body = appendSqliteInt(types, body, v)
+		case string:
+			types = appendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("unsupported sqlite value %T", value))
+		}
+	}
+
+	// The header length counts itself; it only needs a second byte for very
+	// wide rows.
+	headerLen := len(types) + 1
+	if headerLen > 127 {
+		headerLen++
+	}
+	record := appendVarint(nil, uint64(headerLen))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+func appendSqliteInt(types, body []byte, v int64) ([]byte, []byte) {
+	switch {
+	case v == 0:
+		return append(types, 8), body
+	case v == 1:
+		return append(types, 9), body
+	case v >= -1<<7 && v < 1<<7:
+		return append(types, 1), append(body, byte(v))
+	case v >= -1<<15 && v < 1<<15:
+		return append(types, 2), binary.BigEndian.AppendUint16(body, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		return append(types, 3), append(body, byte(v>>16), byte(v>>8), byte(v))
+	case v >= -1<<31 && v < 1<<31:
+		return append(types, 4), binary.BigEndian.AppendUint32(body, uint32(v))
+	case v >= -1<<47 && v < 1<<47:
+		return append(types, 5), append(body, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(types, 6), binary.BigEndian.AppendUint64(body, uint64(v))
+	}
+}
+
+type sqliteFile struct {
+	pages [][]byte
+}
+
+// addPage appends a page and returns its 1-based page number.
+func (f *sqliteFile) addPage(page []byte) uint32 {
+	f.pages = append(f.pages, page)
+	return uint32(len(f.pages))
+}
+
+// btreePage lays out a b-tree page: the header at headerOffset (100 on page
+// 1), the cell pointer array after it, and the cells packed at the end.
+func btreePage(pageType byte, cells [][]byte, rightChild uint32, headerOffset int) []byte {
+	page := make([]byte, sqlitePageSize)
+	page[headerOffset] = pageType
+	binary.BigEndian.PutUint16(page[headerOffset+3:], uint16(len(cells)))
+
+	pointers := headerOffset + 8
+	if pageType == sqlitePageTableInterior || pageType == sqlitePageIndexInterior {
+		binary.BigEndian.PutUint32(page[headerOffset+8:], rightChild)
+		pointers += 4
+	}
+
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[pointers+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[headerOffset+5:], uint16(content))
+	return page
+}
+
+// cellsPerPage is how many cells of at most maxCell bytes fit on a page.
+func cellsPerPage(maxCell, headerLen int) int {
+	return (sqlitePageSize - headerLen) / (maxCell + 2)
+}
+
+// splitEvenly divides n items into parts groups whose sizes differ by at
+// most one.
+func splitEvenly(n, parts int) []int {
+	sizes := make([]int, parts)
+	for i := range sizes {
+		sizes[i] = n / parts
+		if i < n%parts {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+func maxLen(cells [][]byte) int {
+	longest := 0
+	for _, cell := range cells {
+		longest = max(longest, len(cell))
+	}
+	return longest
+}
+
+// writeTable stores records under rowids 1..n and returns the root page.
+func (f *sqliteFile) writeTable(records [][]byte) uint32 {
+	cells := make([][]byte, len(records))
+	for i, record := range records {
+		cell := appendVarint(nil, uint64(len(record)))
+		cell = appendVarint(cell, uint64(i+1))
+		cells[i] = append(cell, record...)
+	}
+
+	type child struct {
+		page   uint32
+		maxKey int64
+	}
+	var level []child
+	for start := 0; start < len(cells) || len(level) == 0; {
+		end, used := start, 8
+		for end < len(cells) && used+len(cells[end])+2 <= sqlitePageSize {
+			used += len(cells[end]) + 2
+			end++
+		}
+		level = append(level, child{f.addPage(btreePage(sqlitePageTableLeaf, cells[start:end], 0, 0)), int64(end)})
+		start = end
+	}
+
+	perPage := cellsPerPage(4+9, 12) + 1
+	for len(level) > 1 {
+		var parents []child
+		start := 0
+		for _, size := range splitEvenly(len(level), (len(level)+perPage-1)/perPage) {
+			group := level[start : start+size]
+			start += size
+
+			var interior [][]byte
+			for _, c := range group[:len(group)-1] {
+				cell := binary.BigEndian.AppendUint32(nil, c.page)
+				interior = append(interior, appendVarint(cell, uint64(c.maxKey)))
+			}
+			last := group[len(group)-1]
+			parents = append(parents, child{f.addPage(btreePage(sqlitePageTableInterior, interior, last.page, 0)), last.maxKey})
+		}
+		level = parents
+	}
+	return level[0].page
+}
+
+// writeIndex stores already sorted keys and returns the root page. In an
+// index b-tree each key appears once: the keys between two child pages sit
+// in their parent.
+func (f *sqliteFile) writeIndex(keys [][]byte) uint32 {
+	leafCells := make([][]byte, len(keys))
+	for i, key := range keys {
+		leafCells[i] = append(appendVarint(nil, uint64(len(key))), key...)
+	}
+
+	perLeaf := cellsPerPage(maxLen(leafCells), 8)
+	leaves := 1
+	if len(keys) > perLeaf {
+		// Leaves hold perLeaf keys each with one separator between them.
+		leaves = (len(keys) + 1 + perLeaf) / (perLeaf + 1)
+	}
+
+	var children []uint32
+	var separators [][]byte
+	start := 0
+	for i, size := range splitEvenly(len(keys)-(leaves-1), leaves) {
+		children = append(children, f.addPage(btreePage(sqlitePageIndexLeaf, leafCells[start:start+size], 0, 0)))
+		start += size
+		if i < leaves-1 {
+			separators = append(separators, keys[start])
+			start++
+		}
+	}
+
+	for len(children) > 1 {
+		perPage := cellsPerPage(4+9+maxLen(separators), 12) + 1
+		var parents []uint32
+		var promoted [][]byte
+		start := 0
+		groups := splitEvenly(len(children), (len(children)+perPage-1)/perPage)
+		for i, size := range groups {
+			var interior [][]byte
+			for j := start; j < start+size-1; j++ {
+				cell := binary.BigEndian.AppendUint32(nil, children[j])
+				cell = appendVarint(cell, uint64(len(separators[j])))
+				interior = append(interior, append(cell, separators[j]...))
+			}
+			parents = append(parents, f.addPage(btreePage(sqlitePageIndexInterior, interior, children[start+size-1], 0)))
+			if i < len(groups)-1 {
+				promoted = append(promoted, separators[start+size-1])
+			}
+			start += size
+		}
+		children, separators = parents, promoted
+	}
+	return children[0]
+}
+
+// compareIndexKeys orders (value, rowid) keys the way SQLite does with the
+// BINARY collation: integers numerically, text bytewise.
+func compareIndexKeys(a, b []interface{}) int {
+	for i := range a {
+		switch x := a[i].(type) {
+		case int64:
+			y := b[i].(int64)
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case string:
+			if c := bytes.Compare([]byte(x), []byte(b[i].(string))); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// writeSQLiteDatabase writes records as a database with a transactions table
+// indexed on matched_address and block_number.
+func writeSQLiteDatabase(w io.Writer, records []matchRecord) error {
+	f := &sqliteFile{}
+	f.addPage(nil) // page 1 holds sqlite_master and is filled in last
+
+	rows := make([][]byte, len(records))
+	for i, record := range records {
+		rows[i] = sqliteRecord(sqliteTransactionRow(record)...)
+		if len(rows[i]) > sqliteMaxLocalPayload {
+			return fmt.Errorf("transaction %s is too large for the SQLite export", record.Hash)
+		}
+	}
+	schema := [][]byte{sqliteRecord("table", "transactions", "transactions", int64(f.writeTable(rows)), sqliteTransactionsTable)}
+
+	for _, index := range sqliteIndexes {
+		entries := make([][]interface{}, len(records))
+		for i, record := range records {
+			entries[i] = []interface{}{index.column(record), int64(i + 1)}
+		}
+		sort.Slice(entries, func(i, j int) bool { return compareIndexKeys(entries[i], entries[j]) < 0 })
+
+		keys := make([][]byte, len(entries))
+		for i, entry := range entries {
+			keys[i] = sqliteRecord(entry...)
+			if len(keys[i]) > sqliteMaxIndexPayload {
+				return fmt.Errorf("index key for %s is too large for the SQLite export", index.name)
+			}
+		}
+		schema = append(schema, sqliteRecord("index", index.name, "transactions", int64(f.writeIndex(keys)), index.sql))
+	}
+
+	var masterCells [][]byte
+	for i, record := range schema {
+		cell := appendVarint(nil, uint64(len(record)))
+		cell = appendVarint(cell, uint64(i+1))
+		masterCells = append(masterCells, append(cell, record...))
+	}
+	f.pages[0] = btreePage(sqlitePageTableLeaf, masterCells, 0, 100)
+	writeSQLiteHeader(f.pages[0], len(f.pages))
+
+	for _, page := range f.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSQLiteHeader(page []byte, pageCount int) {
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1                 // legacy journal read and write versions
+	page[21], page[22], page[23] = 64, 32, 32 // payload fractions, fixed by the format
+	binary.BigEndian.PutUint32(page[24:], 1)  // file change counter
+	binary.BigEndian.PutUint32(page[28:], uint32(pageCount))
+	binary.BigEndian.PutUint32(page[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // schema format
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // version-valid-for, matching the change counter
+	binary.BigEndian.PutUint32(page[96:], 3040001)
+}
+
+// sqliteExportWriter collects matches for writeSQLiteDatabase; unlike the
+// other formats a database file can only be written once the scan is done.
+type sqliteExportWriter struct {
+	records []matchRecord
+}
+
+func (s *sqliteExportWriter) WriteMatch(m match) error {
+	s.records = append(s.records, newMatchRecord(m))
+	return nil
+}
+
+func (s *sqliteExportWriter) Flush() error {
+	return nil
+}
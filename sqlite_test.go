@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendVarint(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		want string
+	}{
+		{v: 0, want: "00"},
+		{v: 127, want: "7f"},
+		{v: 128, want: "8100"},
+		{v: 16383, want: "ff7f"},
+		{v: 16384, want: "818000"},
+		{v: 1<<64 - 1, want: "ffffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		got := fmt.Sprintf("%x", appendVarint(nil, tt.v))
+		if got != tt.want {
+			t.Errorf("appendVarint(%d) = %s, want %s", tt.v, got, tt.want)
+		}
+		if v, n := readSQLiteVarint(appendVarint(nil, tt.v)); v != tt.v || n != len(tt.want)/2 {
+			t.Errorf("reading %s back = %d (%d bytes)", tt.want, v, n)
+		}
+	}
+}
+
+func TestSQLiteRecordRoundTrip(t *testing.T) {
+	values := []interface{}{nil, int64(0), int64(1), int64(-5), int64(300), int64(-70000), int64(1 << 30), int64(1 << 40), int64(-1 << 60), "", "0xabc", strings.Repeat("x", 200)}
+	got := readSQLiteRecord(sqliteRecord(values...))
+	if fmt.Sprint(got) != fmt.Sprint(values) {
+		t.Errorf("round trip = %v, want %v", got, values)
+	}
+}
+
+// readSQLiteVarint decodes a SQLite varint and returns it with its length.
+func readSQLiteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// readSQLiteRecord decodes the NULL, integer and text values of a record.
+func readSQLiteRecord(record []byte) []interface{} {
+	headerLen, n := readSQLiteVarint(record)
+	header, body := record[n:headerLen], record[headerLen:]
+	var values []interface{}
+	for len(header) > 0 {
+		serialType, n := readSQLiteVarint(header)
+		header = header[n:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType <= 6:
+			size := []int{0, 1, 2, 3, 4, 6, 8}[serialType]
+			v := int64(int8(body[0]))
+			for _, b := range body[1:size] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+			body = body[size:]
+		case serialType >= 13 && serialType%2 == 1:
+			size := int(serialType-13) / 2
+			values = append(values, string(body[:size]))
+			body = body[size:]
+		default:
+			panic(fmt.Sprintf("unexpected serial type %d", serialType))
+		}
+	}
+	return values
+}
+
+// readSQLiteTable walks a table b-tree from its root page and returns its
+// records in rowid order.
+func readSQLiteTable(t *testing.T, db []byte, root uint32) [][]interface{} {
+	t.Helper()
+	page := db[(root-1)*sqlitePageSize : root*sqlitePageSize]
+	header := 0
+	if root == 1 {
+		header = 100
+	}
+	cells := int(binary.BigEndian.Uint16(page[header+3:]))
+
+	var rows [][]interface{}
+	switch page[header] {
+	case sqlitePageTableLeaf:
+		for i := 0; i < cells; i++ {
+			cell := page[binary.BigEndian.Uint16(page[header+8+2*i:]):]
+			size, n := readSQLiteVarint(cell)
+			_, m := readSQLiteVarint(cell[n:])
+			rows = append(rows, readSQLiteRecord(cell[n+m:n+m+int(size)]))
+		}
+	case sqlitePageTableInterior:
+		for i := 0; i < cells; i++ {
+			cell := page[binary.BigEndian.Uint16(page[header+12+2*i:]):]
+			rows = append(rows, readSQLiteTable(t, db, binary.BigEndian.Uint32(cell))...)
+		}
+		rows = append(rows, readSQLiteTable(t, db, binary.BigEndian.Uint32(page[header+8:]))...)
+	default:
+		t.Fatalf("page %d has type %#x, want a table page", root, page[header])
+	}
+	return rows
+}
+
+// sqliteTestRecords spreads n records over three addresses, in reverse
+// block order, with some gaps in the optional columns.
+func sqliteTestRecords(n int) []matchRecord {
+	addresses := []string{watched, other, "0x00000000000000000000000000000000000000cc"}
+	records := make([]matchRecord, n)
+	for i := range records {
+		tx := Transaction{
+			Hash:        fmt.Sprintf("0x%064x", i),
+			From:        addresses[i%3],
+			To:          addresses[(i+1)%3],
+			Value:       fmt.Sprintf("0x%x", i*1000),
+			GasPrice:    "0x3b9aca00",
+			Input:       "0xa9059cbb0000",
+			BlockNumber: fmt.Sprintf("0x%x", 20000000-i/4),
+		}
+		if i%7 != 0 {
+			tx.TransactionIndex = fmt.Sprintf("0x%x", i%4)
+		}
+		if i%11 == 0 {
+			tx.To, tx.Input = "", "0x"
+		}
+		records[i] = matchRecord{Transaction: tx, ValueEther: convertWeiToEther(tx.Value), MatchedAddress: addresses[i%3], Action: "transfer"}
+	}
+	return records
+}
+
+func TestWriteSQLiteDatabaseReadsBack(t *testing.T) {
+	records := sqliteTestRecords(5000)
+	var buf bytes.Buffer
+	if err := writeSQLiteDatabase(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	db := buf.Bytes()
+	if !bytes.HasPrefix(db, []byte("SQLite format 3\x00")) || len(db)%sqlitePageSize != 0 {
+		t.Fatalf("not a SQLite file: %d bytes starting %q", len(db), db[:16])
+	}
+	if pages := binary.BigEndian.Uint32(db[28:]); int(pages) != len(db)/sqlitePageSize {
+		t.Errorf("header says %d pages, file has %d", pages, len(db)/sqlitePageSize)
+	}
+
+	schema := readSQLiteTable(t, db, 1)
+	if len(schema) != 1+len(sqliteIndexes) || schema[0][1] != "transactions" || schema[1][1] != sqliteIndexes[0].name {
+		t.Fatalf("sqlite_master = %v", schema)
+	}
+	rows := readSQLiteTable(t, db, uint32(schema[0][3].(int64)))
+	if len(rows) != len(records) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(records))
+	}
+	for i, row := range rows {
+		if want := sqliteTransactionRow(records[i]); fmt.Sprint(row) != fmt.Sprint(want) {
+			t.Fatalf("row %d = %v, want %v", i, row, want)
+		}
+	}
+}
+
+// sqliteCLI runs statements against path with the sqlite3 shell, skipping
+// the test where it isn't installed.
+func sqliteCLI(t *testing.T, path, sql string) string {
+	t.Helper()
+	cli, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	out, err := exec.Command(cli, "-bail", path, sql).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %q: %v\n%s", sql, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestWriteSQLiteDatabaseOpensInSQLite(t *testing.T) {
+	records := sqliteTestRecords(5000)
+	var buf bytes.Buffer
+	if err := writeSQLiteDatabase(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "transactions.db")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sqliteCLI(t, path, "PRAGMA integrity_check;"); got != "ok" {
+		t.Fatalf("integrity_check = %s", got)
+	}
+
+	queries := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "SELECT count(*), count(transaction_index), count(to_address), min(block_number), max(block_number) FROM transactions;", want: "5000|4285|4545|19998751|20000000"},
+		{sql: "SELECT count(*) FROM transactions WHERE matched_address = '" + other + "';", want: "1667"},
+		{sql: "SELECT id, hash, value, gas_price, selector FROM transactions WHERE id = 2;", want: fmt.Sprintf("2|0x%064x|1000|1000000000|0xa9059cbb", 1)},
+		{sql: "SELECT count(*) FROM transactions WHERE block_number BETWEEN 19999000 AND 19999009;", want: "40"},
+	}
+	for _, q := range queries {
+		if got := sqliteCLI(t, path, q.sql); got != q.want {
+			t.Errorf("%s = %s, want %s", q.sql, got, q.want)
+		}
+	}
+
+	plans := map[string]string{
+		"SELECT hash FROM transactions WHERE matched_address = '" + watched + "';":        "transactions_matched_address",
+		"SELECT hash FROM transactions WHERE block_number BETWEEN 19999000 AND 19999009;": "transactions_block_number",
+	}
+	for sql, index := range plans {
+		if plan := sqliteCLI(t, path, "EXPLAIN QUERY PLAN "+sql); !strings.Contains(plan, "USING INDEX "+index) {
+			t.Errorf("plan for %s = %q, want it to use %s", sql, plan, index)
+		}
+	}
+}
+
+func TestSQLiteExportFormat(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x1"}))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=sqlite")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/vnd.sqlite3" {
+		t.Fatalf("status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	db := rec.Body.Bytes()
+	schema := readSQLiteTable(t, db, 1)
+	rows := readSQLiteTable(t, db, uint32(schema[0][3].(int64)))
+	if len(rows) != 1 || rows[0][3] != "0x01" || rows[0][10] != watched {
+		t.Errorf("rows = %v", rows)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const maxStartupBackoff = 30 * time.Second
+
+// probeEndpoint checks the RPC endpoint answers eth_blockNumber, retrying up
+// to retries times with a doubling backoff so the server can start before
+// its node is ready.
+func probeEndpoint(retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		latest, err := getLatestBlockNumber()
+		if err == nil {
+			log.Printf("RPC endpoint is up at block %d", latest)
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("RPC endpoint unavailable after %d attempts: %v", attempt+1, err)
+		}
+
+		log.Printf("RPC endpoint not ready (attempt %d/%d), retrying in %s: %v", attempt+1, retries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxStartupBackoff)
+	}
+}
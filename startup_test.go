@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeEndpointRetriesUntilReady(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_blockNumber", func([]interface{}) (interface{}, error) {
+		if node.callCount("eth_blockNumber") < 3 {
+			return nil, fmt.Errorf("syncing")
+		}
+		return "0x10", nil
+	})
+
+	started := time.Now()
+	if err := probeEndpoint(5, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if calls := node.callCount("eth_blockNumber"); calls != 3 {
+		t.Errorf("probed %d times, want 3", calls)
+	}
+	if elapsed := time.Since(started); elapsed < 15*time.Millisecond {
+		t.Errorf("probe took %v, want the 5ms and 10ms backoffs", elapsed)
+	}
+}
+
+func TestProbeEndpointGivesUp(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle("eth_blockNumber", func([]interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("connection refused")
+	})
+
+	err := probeEndpoint(2, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("error = %v, want it to give up after 3 attempts", err)
+	}
+	if calls := node.callCount("eth_blockNumber"); calls != 3 {
+		t.Errorf("probed %d times, want 3", calls)
+	}
+
+	if err := probeEndpoint(0, time.Hour); err == nil {
+		t.Error("probe with no retries succeeded")
+	}
+}
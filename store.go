@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// Store keeps matched transactions in memory, keyed by watched address and
+// hash, with indexes for address-prefix and hash-substring search.
+type Store struct {
+	mu      sync.RWMutex
+	records []matchRecord
+	byKey   map[string]int
+
+	// addresses is sorted so prefix lookups are a binary search;
+	// recordsByAddress maps each (lowercased) address to its record ids.
+	addresses        []string
+	recordsByAddress map[string][]int
+
+	// hashTrigrams maps every 3-character window of a hash to the records
+	// containing it, narrowing substring search to a few candidates.
+	hashTrigrams map[string][]int
+
+	// bloom covers every key in recordsByAddress so lookups of addresses
+	// that were never stored return without taking mu.
+	bloom atomic.Pointer[addressBloom]
+
+	// checkpoints holds the last block each address was scanned up to by an
+	// incremental scan.
+	checkpoints map[string]int64
+}
+
+var store = newStore()
+
+func newStore() *Store {
+	s := &Store{
+		byKey:            make(map[string]int),
+		recordsByAddress: make(map[string][]int),
+		hashTrigrams:     make(map[string][]int),
+		checkpoints:      make(map[string]int64),
+	}
+	s.bloom.Store(newAddressBloom(bloomInitialCapacity))
+	return s
+}
+
+func storeKey(address, hash string) string {
+	return strings.ToLower(address) + "/" + strings.ToLower(hash)
+}
+
+func (s *Store) Insert(record matchRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(record)
+}
+
+// InsertBatch inserts records under a single lock, so readers see either
+// none or all of them.
+func (s *Store) InsertBatch(records []matchRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		s.insert(record)
+	}
+}
+
+func (s *Store) insert(record matchRecord) {
+	key := storeKey(record.MatchedAddress, record.Hash)
+	if id, ok := s.byKey[key]; ok {
+		s.records[id] = record
+		return
+	}
+
+	id := len(s.records)
+	s.records = append(s.records, record)
+	s.byKey[key] = id
+
+	indexed := make(map[string]bool)
+	for _, address := range []string{record.MatchedAddress, record.From, record.To} {
+		address = strings.ToLower(address)
+		if address == "" || indexed[address] {
+			continue
+		}
+		indexed[address] = true
+		s.indexAddress(address, id)
+	}
+
+	hash := strings.ToLower(record.Hash)
+	seen := make(map[string]bool)
+	for i := 0; i+3 <= len(hash); i++ {
+		trigram := hash[i : i+3]
+		if !seen[trigram] {
+			seen[trigram] = true
+			s.hashTrigrams[trigram] = append(s.hashTrigrams[trigram], id)
+		}
+	}
+}
+
+// storeBatchSize and storeFlushInterval, set with -store-batch-size and
+// -store-flush-interval, bound how long a scan's matches wait to be stored.
+var (
+	storeBatchSize     = 100
+	storeFlushInterval = time.Second
+)
+
+// storeBatch buffers a scan's records and inserts them in bulk, once size
+// of them are waiting or interval after the first one arrived. Flush must
+// be called when the scan ends, however it ends.
+type storeBatch struct {
+	store    *Store
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []matchRecord
+	timer   *time.Timer
+}
+
+func (s *Store) newBatch(size int, interval time.Duration) *storeBatch {
+	return &storeBatch{store: s, size: max(size, 1), interval: interval}
+}
+
+func (b *storeBatch) Add(record matchRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, record)
+	if len(b.pending) >= b.size {
+		b.flushLocked()
+		return
+	}
+	if b.timer == nil && b.interval > 0 {
+		b.timer = time.AfterFunc(b.interval, b.Flush)
+	}
+}
+
+func (b *storeBatch) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *storeBatch) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+	b.store.InsertBatch(b.pending)
+	b.pending = nil
+}
+
+func (s *Store) indexAddress(address string, id int) {
+	if _, ok := s.recordsByAddress[address]; !ok {
+		i := sort.SearchStrings(s.addresses, address)
+		s.addresses = append(s.addresses, "")
+		copy(s.addresses[i+1:], s.addresses[i:])
+		s.addresses[i] = address
+		s.addToBloom(address)
+	}
+	s.recordsByAddress[address] = append(s.recordsByAddress[address], id)
+}
+
+// addToBloom adds a newly indexed address, first rebuilding the filter at
+// twice the capacity when it is full so the false-positive rate stays low.
+func (s *Store) addToBloom(address string) {
+	bloom := s.bloom.Load()
+	if bloom.count >= bloom.capacity {
+		bloom = newAddressBloom(bloom.capacity * 2)
+		for _, existing := range s.addresses {
+			bloom.add(existing)
+		}
+		s.bloom.Store(bloom)
+		return
+	}
+	bloom.add(address)
+}
+
+// Transactions returns the records touching address in chain order, along
+// with their total count. With a non-nil after it returns the records past
+// that position instead of skipping offset of them, which stays stable when
+// new records arrive.
+func (s *Store) Transactions(address string, after *storePosition, offset, limit int) ([]matchRecord, int) {
+	address = strings.ToLower(address)
+	if !s.bloom.Load().mayContain(address) {
+		return []matchRecord{}, 0
+	}
+
+	// A transaction between two watched addresses is stored once for each
+	// of them and indexed under both, so list it once, preferring the
+	// record matched for the queried address.
+	s.mu.RLock()
+	ids := s.recordsByAddress[address]
+	records := make([]matchRecord, 0, len(ids))
+	byHash := make(map[string]int, len(ids))
+	for _, id := range ids {
+		record := s.records[id]
+		hash := strings.ToLower(record.Hash)
+		if i, ok := byHash[hash]; ok {
+			if strings.ToLower(record.MatchedAddress) == address {
+				records[i] = record
+			}
+			continue
+		}
+		byHash[hash] = len(records)
+		records = append(records, record)
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return recordPosition(records[j]).after(recordPosition(records[i]))
+	})
+
+	total := len(records)
+	if after != nil {
+		offset = sort.Search(total, func(i int) bool { return recordPosition(records[i]).after(*after) })
+	}
+	if offset >= total {
+		return []matchRecord{}, total
+	}
+	return records[offset:min(offset+limit, total)], total
+}
+
+// Search returns records with an address starting with query or a hash
+// containing it, in insertion order, along with the total number of hits.
+func (s *Store) Search(query string, offset, limit int) ([]matchRecord, int) {
+	query = strings.ToLower(query)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits := make(map[int]bool)
+	for i := sort.SearchStrings(s.addresses, query); i < len(s.addresses) && strings.HasPrefix(s.addresses[i], query); i++ {
+		for _, id := range s.recordsByAddress[s.addresses[i]] {
+			hits[id] = true
+		}
+	}
+	for _, id := range s.hashCandidates(query) {
+		if strings.Contains(strings.ToLower(s.records[id].Hash), query) {
+			hits[id] = true
+		}
+	}
+
+	ids := make([]int, 0, len(hits))
+	for id := range hits {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	total := len(ids)
+	if offset >= total {
+		return []matchRecord{}, total
+	}
+	ids = ids[offset:min(offset+limit, total)]
+
+	results := make([]matchRecord, len(ids))
+	for i, id := range ids {
+		results[i] = s.records[id]
+	}
+	return results, total
+}
+
+func (s *Store) hashCandidates(query string) []int {
+	if len(query) < 3 {
+		all := make([]int, len(s.records))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	var best []int
+	for i := 0; i+3 <= len(query); i++ {
+		candidates := s.hashTrigrams[query[i:i+3]]
+		if best == nil || len(candidates) < len(best) {
+			best = candidates
+		}
+		if len(best) == 0 {
+			break
+		}
+	}
+	return best
+}
+
+type searchResponse struct {
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Results []matchRecord `json:"results"`
+
+	// NextCursor, from /transactions, fetches the page after this one.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+func parsePagination(r *http.Request) (offset, limit int, ok bool) {
+	limit = defaultSearchLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			return 0, 0, false
+		}
+	}
+	if offsetParam := r.URL.Query().Get("offset"); offsetParam != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetParam)
+		if err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	return offset, limit, true
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Please provide a q parameter", http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, ok := parsePagination(r)
+	if !ok {
+		http.Error(w, "Invalid offset or limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	results, total := store.Search(query, offset, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(searchResponse{
+		Total:   total,
+		Offset:  offset,
+		Limit:   limit,
+		Results: results,
+	})
+}
+
+func transactionsHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimSpace(r.URL.Query().Get("address"))
+	if address == "" {
+		http.Error(w, "Please provide an address parameter", http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, ok := parsePagination(r)
+	if !ok {
+		http.Error(w, "Invalid offset or limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	var after *storePosition
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if r.URL.Query().Get("offset") != "" {
+			http.Error(w, "Use either cursor or offset, not both", http.StatusBadRequest)
+			return
+		}
+		position, err := decodeCursor(address, cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
+			return
+		}
+		after = &position
+	}
+
+	results, total := store.Transactions(address, after, offset, limit)
+
+	response := searchResponse{
+		Total:   total,
+		Offset:  offset,
+		Limit:   limit,
+		Results: results,
+	}
+	if len(results) == limit {
+		response.NextCursor = encodeCursor(address, recordPosition(results[len(results)-1]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
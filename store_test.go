@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useStore swaps in an empty store for the duration of the test.
+func useStore(t *testing.T) *Store {
+	t.Helper()
+	previous := store
+	store = newStore()
+	t.Cleanup(func() { store = previous })
+	return store
+}
+
+func storedRecord(address, hash, from, to string) matchRecord {
+	return matchRecord{Transaction: Transaction{Hash: hash, From: from, To: to, BlockNumber: "0x1"}, MatchedAddress: address}
+}
+
+func recordHashes(records []matchRecord) []string {
+	hashes := make([]string, len(records))
+	for i, record := range records {
+		hashes[i] = record.Hash
+	}
+	return hashes
+}
+
+func TestStoreSearch(t *testing.T) {
+	s := newStore()
+	s.Insert(storedRecord(watched, "0xabc111", watched, other))
+	s.Insert(storedRecord(watched, "0xdef222", "0xC0FFEE", watched))
+	s.Insert(storedRecord(other, "0xabc333", other, "0xcc"))
+	s.Insert(storedRecord(watched, "0xABC111", watched, other))
+
+	tests := []struct {
+		query string
+		want  []string
+		total int
+	}{
+		{query: "0xabc", want: []string{"0xABC111", "0xabc333"}, total: 2},
+		{query: "222", want: []string{"0xdef222"}, total: 1},
+		{query: "0xc0f", want: []string{"0xdef222"}, total: 1},
+		{query: watched, want: []string{"0xABC111", "0xdef222"}, total: 2},
+		{query: "0x99", want: []string{}, total: 0},
+	}
+	for _, tt := range tests {
+		results, total := s.Search(tt.query, 0, 10)
+		if fmt.Sprint(recordHashes(results)) != fmt.Sprint(tt.want) || total != tt.total {
+			t.Errorf("Search(%q) = %v (%d), want %v (%d)", tt.query, recordHashes(results), total, tt.want, tt.total)
+		}
+	}
+
+	results, total := s.Search("0x", 1, 1)
+	if total != 3 || len(results) != 1 || results[0].Hash != "0xdef222" {
+		t.Errorf("paged search = %v of %d", recordHashes(results), total)
+	}
+}
+
+func TestScanStoresMatchesForSearch(t *testing.T) {
+	useStore(t)
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0xfeed01", From: watched, To: other}))
+
+	if rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&store=true"); rec.Code != http.StatusOK {
+		t.Fatalf("scan status = %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	searchHandler(rec, httptest.NewRequest(http.MethodGet, "/search?q=feed", nil))
+	var response searchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 1 || response.Results[0].Hash != "0xfeed01" || response.Limit != defaultSearchLimit {
+		t.Errorf("response = %+v", response)
+	}
+
+	for _, query := range []string{"", "q=x&limit=0", "q=x&limit=501", "q=x&offset=-1"} {
+		rec := httptest.NewRecorder()
+		searchHandler(rec, httptest.NewRequest(http.MethodGet, "/search?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStoreTransactionsByAddress(t *testing.T) {
+	s := newStore()
+	later := storedRecord(watched, "0x02", watched, other)
+	later.BlockNumber, later.TransactionIndex = "0x5", "0x0"
+	earlier := storedRecord(watched, "0x01", "0xCC", watched)
+	earlier.BlockNumber, earlier.TransactionIndex = "0x2", "0x3"
+	s.Insert(later)
+	s.Insert(earlier)
+	s.Insert(storedRecord(other, "0x03", other, "0xdd"))
+
+	tests := []struct {
+		address string
+		want    []string
+	}{
+		{address: watched, want: []string{"0x01", "0x02"}},
+		{address: "0x00000000000000000000000000000000000000AA", want: []string{"0x01", "0x02"}},
+		{address: "0xcc", want: []string{"0x01"}},
+		{address: "0xdd", want: []string{"0x03"}},
+		{address: "0xee", want: []string{}},
+	}
+	for _, tt := range tests {
+		results, total := s.Transactions(tt.address, nil, 0, 10)
+		if fmt.Sprint(recordHashes(results)) != fmt.Sprint(tt.want) || total != len(tt.want) {
+			t.Errorf("Transactions(%s) = %v (%d), want %v", tt.address, recordHashes(results), total, tt.want)
+		}
+	}
+
+	results, total := s.Transactions(watched, nil, 1, 10)
+	if total != 2 || fmt.Sprint(recordHashes(results)) != "[0x02]" {
+		t.Errorf("offset 1 = %v of %d", recordHashes(results), total)
+	}
+}
+
+func TestStoreNegativeLookupSkipsTheLock(t *testing.T) {
+	s := newStore()
+	s.Insert(storedRecord(watched, "0x01", watched, other))
+
+	s.mu.Lock()
+	done := make(chan int)
+	go func() {
+		_, total := s.Transactions("0x00000000000000000000000000000000000000cc", nil, 0, 10)
+		done <- total
+	}()
+	select {
+	case total := <-done:
+		if total != 0 {
+			t.Errorf("total = %d for an address never stored", total)
+		}
+	case <-time.After(time.Second):
+		t.Error("looking up an absent address waited for the store lock")
+	}
+	s.mu.Unlock()
+}
+
+func TestAddressBloomGrowsWithoutFalseNegatives(t *testing.T) {
+	s := newStore()
+	for i := 0; i < 3*bloomInitialCapacity; i++ {
+		address := fmt.Sprintf("0x%040x", i)
+		s.Insert(storedRecord(address, fmt.Sprintf("0x%x", i), address, ""))
+	}
+
+	bloom := s.bloom.Load()
+	if bloom.capacity < 3*bloomInitialCapacity {
+		t.Errorf("capacity = %d after %d addresses", bloom.capacity, 3*bloomInitialCapacity)
+	}
+	for i := 0; i < 3*bloomInitialCapacity; i++ {
+		if address := fmt.Sprintf("0x%040x", i); !bloom.mayContain(address) {
+			t.Fatalf("stored address %s missing from the filter", address)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bloom.mayContain(fmt.Sprintf("0x%040x", 1<<32+i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000 lookups, want about 1%%", falsePositives)
+	}
+}
+
+func TestTransactionsHandler(t *testing.T) {
+	useStore(t).Insert(storedRecord(watched, "0x01", watched, other))
+
+	rec := httptest.NewRecorder()
+	transactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/transactions?address="+other, nil))
+	var response searchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 1 || response.Results[0].Hash != "0x01" || response.NextCursor != "" {
+		t.Errorf("response = %+v", response)
+	}
+
+	for _, query := range []string{"", "address=" + watched + "&limit=0", "address=" + watched + "&offset=x"} {
+		rec := httptest.NewRecorder()
+		transactionsHandler(rec, httptest.NewRequest(http.MethodGet, "/transactions?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStoreBatchFlushesBySizeAndInterval(t *testing.T) {
+	s := newStore()
+	stored := func() int {
+		_, total := s.Search("0x", 0, 10)
+		return total
+	}
+
+	b := s.newBatch(2, time.Hour)
+	b.Add(storedRecord(watched, "0x01", watched, other))
+	if n := stored(); n != 0 {
+		t.Errorf("%d records stored before the batch filled", n)
+	}
+	b.Add(storedRecord(watched, "0x02", watched, other))
+	if n := stored(); n != 2 {
+		t.Errorf("%d records stored once the batch filled, want 2", n)
+	}
+
+	b = s.newBatch(100, 10*time.Millisecond)
+	b.Add(storedRecord(watched, "0x03", watched, other))
+	deadline := time.Now().Add(2 * time.Second)
+	for stored() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d records stored, want the partial batch written after the interval", stored())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	b = s.newBatch(100, 0)
+	b.Add(storedRecord(watched, "0x04", watched, other))
+	b.Flush()
+	b.Flush()
+	if n := stored(); n != 4 {
+		t.Errorf("%d records stored after Flush, want 4", n)
+	}
+}
+
+func TestScanFlushesStoreBatchWhenItEnds(t *testing.T) {
+	previousSize, previousInterval := storeBatchSize, storeFlushInterval
+	storeBatchSize, storeFlushInterval = 100, time.Hour
+	t.Cleanup(func() { storeBatchSize, storeFlushInterval = previousSize, previousInterval })
+
+	node := newFakeNode(t)
+	node.serveBlocks(
+		testBlock(1, Transaction{Hash: "0x01", From: watched, To: other}),
+		testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}),
+	)
+
+	s := newStore()
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{Store: s}, &recordingWriter{}); err != nil {
+		t.Fatal(err)
+	}
+	if results, total := s.Search(watched, 0, 10); total != 2 {
+		t.Errorf("stored %v, want both matches once the scan ended", recordHashes(results))
+	}
+
+	// A scan cancelled after its first match still stores that match.
+	s = newStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancellingWriter{cancel: cancel}
+	fetchTransactions(ctx, []string{watched}, 1, 2, scanOptions{Store: s, Concurrency: 1}, out)
+	if results, total := s.Search(watched, 0, 10); total != 1 || results[0].Hash != "0x01" {
+		t.Errorf("stored %v after cancelling, want the match written before it", recordHashes(results))
+	}
+}
+
+// cancellingWriter cancels the scan as soon as it is handed a match.
+type cancellingWriter struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancellingWriter) WriteMatch(match) error {
+	c.cancel()
+	return nil
+}
+
+func (c *cancellingWriter) Flush() error { return nil }
+
+// BenchmarkStoreNegativeLookup looks up absent addresses while another
+// goroutine keeps inserting, through the filter and, for comparison, through
+// the locked index the filter stands in front of.
+func BenchmarkStoreNegativeLookup(b *testing.B) {
+	s := newStore()
+	for i := 0; i < 10000; i++ {
+		address := fmt.Sprintf("0x%040x", i)
+		s.Insert(storedRecord(address, fmt.Sprintf("0x%x", i), address, ""))
+	}
+	absent := fmt.Sprintf("0x%040x", 1<<32)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			s.Insert(storedRecord(watched, fmt.Sprintf("0x%x", 1<<20+i), watched, other))
+		}
+	}()
+
+	b.Run("bloom", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.Transactions(absent, nil, 0, 10)
+		}
+	})
+	b.Run("lock", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.mu.RLock()
+			_ = s.recordsByAddress[absent]
+			s.mu.RUnlock()
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// streamBlockByNumber decodes an eth_getBlockByNumber response token by token
+// so only the transactions accepted by keep are retained, rather than the
+// whole block body.
+func streamBlockByNumber(ctx context.Context, blockNumber string, keep func(Transaction) bool) (*BlockWithTransactions, error) {
+	resp, requestID, err := postRPCRequest(ctx, "eth_getBlockByNumber", []interface{}{blockNumber, true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	envelope := make(map[string]interface{})
+	var block *BlockWithTransactions
+	for decoder.More() {
+		key, err := decodeKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "result" {
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return nil, fmt.Errorf("failed to decode JSON response: %v", err)
+			}
+			envelope[key] = value
+			continue
+		}
+
+		block, err = streamBlockResult(decoder, keep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JSON response: %v", err)
+		}
+	}
+
+	if err := validateRPCResponse(envelope, requestID); err != nil {
+		return nil, err
+	}
+	if err := rpcErrorFromPayload(envelope); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %s not found", blockNumber)
+	}
+
+	return block, nil
+}
+
+func streamBlockResult(decoder *json.Decoder, keep func(Transaction) bool) (*BlockWithTransactions, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("unexpected token %v in block result", token)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	var kept []Transaction
+	var hashes []string
+	for decoder.More() {
+		key, err := decodeKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "transactions" {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, err
+			}
+			fields[key] = raw
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			var element json.RawMessage
+			if err := decoder.Decode(&element); err != nil {
+				return nil, err
+			}
+			tx, hash, err := decodeTransactionElement(element)
+			switch {
+			case err != nil:
+				return nil, err
+			case hash != "":
+				hashes = append(hashes, hash)
+			case keep(tx):
+				kept = append(kept, tx)
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+
+	headerBytes, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var block BlockWithTransactions
+	if err := json.Unmarshal(headerBytes, &block); err != nil {
+		return nil, err
+	}
+	block.Transactions = kept
+	block.TransactionHashes = hashes
+
+	return &block, nil
+}
+
+func decodeKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected token %v, expected object key", token)
+	}
+	return key, nil
+}
+
+func expectDelim(decoder *json.Decoder, want json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("unexpected token %v, expected %v", token, want)
+	}
+	return nil
+}
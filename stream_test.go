@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStreamBlockKeepsOnlyMatchingTransactions(t *testing.T) {
+	node := newFakeNode(t)
+	block := testBlock(5,
+		Transaction{Hash: "0x01", From: watched, To: other},
+		Transaction{Hash: "0x02", From: other, To: other},
+		Transaction{Hash: "0x03", From: other, To: watched},
+	)
+	block.BaseFeePerGas = "0x7"
+	node.serveBlocks(block)
+
+	inspected := 0
+	got, err := streamBlockByNumber(context.Background(), "0x5", func(tx Transaction) bool {
+		inspected++
+		return tx.From == watched || tx.To == watched
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inspected != 3 {
+		t.Errorf("keep saw %d transactions, want 3", inspected)
+	}
+	if len(got.Transactions) != 2 || got.Transactions[0].Hash != "0x01" || got.Transactions[1].Hash != "0x03" {
+		t.Errorf("kept transactions = %+v", got.Transactions)
+	}
+	if got.Number != "0x5" || got.Hash != block.Hash || got.BaseFeePerGas != "0x7" {
+		t.Errorf("header = %+v", got)
+	}
+}
+
+func TestStreamBlockErrors(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1))
+
+	_, err := streamBlockByNumber(context.Background(), "0x9", func(Transaction) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing block: error = %v", err)
+	}
+
+	node.handle("eth_getBlockByNumber", func([]interface{}) (interface{}, error) {
+		return nil, &rpcError{Code: -32000, Message: "header not found"}
+	})
+	_, err = streamBlockByNumber(context.Background(), "0x1", func(Transaction) bool { return true })
+	if _, ok := err.(*rpcError); !ok {
+		t.Errorf("rpc error: error = %#v", err)
+	}
+}
+
+func TestStreamBlockCollectsHashes(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(3, Transaction{Hash: "0x01"}, Transaction{Hash: "0x02"}))
+	serveHashOnlyBlocks(node)
+
+	block, err := streamBlockByNumber(context.Background(), "0x3", func(Transaction) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(block.TransactionHashes, " ") != "0x01 0x02" || len(block.Transactions) != 0 {
+		t.Errorf("block = %+v", block)
+	}
+}
+
+// heapCost runs fetch and reports the bytes it allocated and how much of that
+// is still live while its block is held.
+func heapCost(t *testing.T, fetch func() (*BlockWithTransactions, error)) (allocated, retained int64) {
+	t.Helper()
+	// Two collections empty the sync.Pool victim caches too, which would
+	// otherwise keep encoding buffers live.
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	block, err := fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	allocated = int64(after.TotalAlloc - before.TotalAlloc)
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	retained = int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	runtime.KeepAlive(block)
+	return allocated, retained
+}
+
+func TestStreamBlockUsesLessMemoryForLargeBlocks(t *testing.T) {
+	node := newFakeNode(t)
+	txs := make([]Transaction, 5000)
+	for i := range txs {
+		txs[i] = Transaction{
+			Hash:     fmt.Sprintf("0x%064x", i),
+			From:     other,
+			To:       other,
+			Value:    "0xde0b6b3a7640000",
+			GasPrice: "0x3b9aca00",
+			Input:    "0xa9059cbb" + strings.Repeat("00", 64),
+		}
+	}
+	txs[1234].To = watched
+	node.serveBlocks(testBlock(1, txs...))
+	keep := func(tx Transaction) bool { return tx.To == watched }
+	// Open the connection first so neither measurement pays for it.
+	if _, err := getLatestBlockNumber(); err != nil {
+		t.Fatal(err)
+	}
+
+	fullAllocated, fullRetained := heapCost(t, func() (*BlockWithTransactions, error) {
+		return getBlockByNumber(context.Background(), "0x1")
+	})
+	streamAllocated, streamRetained := heapCost(t, func() (*BlockWithTransactions, error) {
+		return streamBlockByNumber(context.Background(), "0x1", keep)
+	})
+	if streamAllocated >= fullAllocated {
+		t.Errorf("streaming allocated %d bytes, want less than the %d of a full decode", streamAllocated, fullAllocated)
+	}
+	if streamRetained >= fullRetained/10 {
+		t.Errorf("streaming kept %d bytes live, want a fraction of the %d of a full decode", streamRetained, fullRetained)
+	}
+}
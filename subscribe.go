@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	watchModeAuto      = "auto"
+	watchModePoll      = "poll"
+	watchModeSubscribe = "subscribe"
+
+	subscribeDialTimeout = 10 * time.Second
+
+	// subscribeIdlePolls is how many poll intervals a subscription may go
+	// without a frame from the node before it counts as dropped.
+	subscribeIdlePolls = 3
+)
+
+// webSocketEndpoint is the config's websocketUrl, or the HTTP endpoint with
+// its scheme swapped, which is where most nodes serve both.
+func (c *watchConfig) webSocketEndpoint() string {
+	if c.WebSocketURL != "" {
+		return c.WebSocketURL
+	}
+	endpoint := rpcEndpointCredentials().Endpoint
+	if rest, ok := strings.CutPrefix(endpoint, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(endpoint, "http://"); ok {
+		return "ws://" + rest
+	}
+	return endpoint
+}
+
+// follow subscribes to newHeads and polls once for every new head, so the
+// scan itself still goes over HTTP. subscribed reports whether the node
+// accepted the subscription, which lets auto mode tell an endpoint without
+// eth_subscribe from a connection that dropped later.
+func (w *watcher) follow(ctx context.Context, config *watchConfig, opts scanOptions) (subscribed bool, err error) {
+	header := http.Header{}
+	if token := rpcEndpointCredentials().Token; token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, subscribeDialTimeout)
+	conn, err := dialWebSocket(dialCtx, config.webSocketEndpoint(), header)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// A half-open connection never errors on its own, so ping the node
+	// every poll interval and give up once it has been silent for a few.
+	conn.SetIdleTimeout(subscribeIdlePolls * config.pollInterval)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(config.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if conn.Ping() != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	request := newRPCPayload("eth_subscribe", []interface{}{"newHeads"})
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return false, err
+	}
+	if err := conn.WriteText(payload); err != nil {
+		return false, err
+	}
+	reply, err := conn.ReadMessage()
+	if err != nil {
+		return false, err
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(reply, &response); err != nil {
+		return false, fmt.Errorf("failed to decode eth_subscribe response: %v", err)
+	}
+	if err := validateRPCResponse(response, request.ID); err != nil {
+		return false, err
+	}
+	if err := rpcErrorFromPayload(response); err != nil {
+		return false, err
+	}
+	log.Printf("Watch subscribed to newHeads over WebSocket")
+
+	// Catch up on the blocks since the last poll before waiting for heads.
+	for {
+		if err := w.poll(ctx, config.Addresses, opts); err != nil && ctx.Err() == nil {
+			log.Printf("Error watching %s: %v", strings.Join(config.Addresses, ","), err)
+		}
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return true, err
+			}
+			var notification struct {
+				Method string `json:"method"`
+			}
+			if json.Unmarshal(message, &notification) == nil && notification.Method == "eth_subscription" {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebSocketEndpoint(t *testing.T) {
+	previous := currentCredentials.Load()
+	t.Cleanup(func() { currentCredentials.Store(previous) })
+
+	tests := []struct {
+		endpoint string
+		config   string
+		want     string
+	}{
+		{endpoint: "https://node.example/v3/key", want: "wss://node.example/v3/key"},
+		{endpoint: "http://localhost:8545", want: "ws://localhost:8545"},
+		{endpoint: "http://localhost:8545", config: "ws://localhost:8546", want: "ws://localhost:8546"},
+	}
+	for _, tt := range tests {
+		currentCredentials.Store(&rpcCredentials{Endpoint: tt.endpoint})
+		config := &watchConfig{WebSocketURL: tt.config}
+		if got := config.webSocketEndpoint(); got != tt.want {
+			t.Errorf("webSocketEndpoint(%q, %q) = %q, want %q", tt.endpoint, tt.config, got, tt.want)
+		}
+	}
+}
+
+// newHeadsServer accepts one eth_subscribe for newHeads per connection and
+// sends a notification for every value on heads.
+func newHeadsServer(t *testing.T, heads chan struct{}) string {
+	return newWebSocketServer(t, func(c *wsServerConn, r *http.Request) {
+		_, payload := c.read()
+		var request RequestPayload
+		if err := json.Unmarshal(payload, &request); err != nil || request.Method != "eth_subscribe" || fmt.Sprint(request.Params) != "[newHeads]" {
+			t.Errorf("subscription request = %s", payload)
+			return
+		}
+		c.write(wsOpText, true, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x9ce5"}`, request.ID)))
+		for range heads {
+			c.write(wsOpText, true, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0x9ce5","result":{"number":"0x3"}}}`))
+		}
+	})
+}
+
+func TestWatcherScansOnEachNewHead(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}))
+	heads := make(chan struct{})
+	url := newHeadsServer(t, heads)
+
+	out := make(channelWriter, 10)
+	startWatcher(t, out, &watchConfig{Addresses: []string{watched}, Mode: watchModeSubscribe, WebSocketURL: url, pollInterval: time.Hour})
+	t.Cleanup(func() { close(heads) })
+	if m := out.next(t); m.Tx.Hash != "0x02" {
+		t.Fatalf("catch-up match = %s, want 0x02", m.Tx.Hash)
+	}
+
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3, Transaction{Hash: "0x03", From: other, To: watched}))
+	select {
+	case m := <-out:
+		t.Fatalf("match %s written before a new head arrived", m.Tx.Hash)
+	case <-time.After(30 * time.Millisecond):
+	}
+	heads <- struct{}{}
+	if m := out.next(t); m.Tx.Hash != "0x03" {
+		t.Errorf("match after new head = %s, want 0x03", m.Tx.Hash)
+	}
+}
+
+func TestWatcherSubscriptionModes(t *testing.T) {
+	refused := func(node *fakeNode) string {
+		// The fake node answers a WebSocket upgrade with 400.
+		return "ws://" + strings.TrimPrefix(node.server.URL, "http://")
+	}
+
+	t.Run("auto falls back to polling", func(t *testing.T) {
+		node := newFakeNode(t)
+		node.serveBlocks(testBlock(1), testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}))
+		out := make(channelWriter, 10)
+		startWatcher(t, out, &watchConfig{Addresses: []string{watched}, Mode: watchModeAuto, WebSocketURL: refused(node), pollInterval: 5 * time.Millisecond})
+		if m := out.next(t); m.Tx.Hash != "0x02" {
+			t.Errorf("match = %s, want 0x02 found by polling", m.Tx.Hash)
+		}
+	})
+
+	t.Run("subscribe keeps retrying", func(t *testing.T) {
+		node := newFakeNode(t)
+		node.serveBlocks(testBlock(1), testBlock(2, Transaction{Hash: "0x02", From: watched, To: other}))
+		out := make(channelWriter, 10)
+		startWatcher(t, out, &watchConfig{Addresses: []string{watched}, Mode: watchModeSubscribe, WebSocketURL: refused(node), pollInterval: 5 * time.Millisecond})
+		time.Sleep(50 * time.Millisecond)
+		if calls := node.callCount("eth_blockNumber"); calls != 0 {
+			t.Errorf("eth_blockNumber called %d times, want no polling in subscribe mode", calls)
+		}
+	})
+}
+
+func TestWatcherRedialsASilentSubscription(t *testing.T) {
+	// silentHeadsServer accepts the subscription and then either answers
+	// pings or goes quiet without closing the connection, the way a
+	// half-open TCP connection looks from the client.
+	silentHeadsServer := func(t *testing.T, answerPings bool) *atomic.Int32 {
+		var dials atomic.Int32
+		release := make(chan struct{})
+		url := newWebSocketServer(t, func(c *wsServerConn, r *http.Request) {
+			dials.Add(1)
+			_, payload := c.read()
+			var request RequestPayload
+			json.Unmarshal(payload, &request)
+			c.write(wsOpText, true, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x9ce5"}`, request.ID)))
+			if answerPings {
+				for {
+					_, opcode, payload, err := c.in.readFrame()
+					if err != nil {
+						return
+					}
+					if opcode == wsOpPing {
+						c.write(wsOpPong, true, payload)
+					}
+				}
+			}
+			<-release
+		})
+		t.Cleanup(func() { close(release) })
+
+		node := newFakeNode(t)
+		node.serveBlocks(testBlock(1))
+		startWatcher(t, make(channelWriter, 10), &watchConfig{Addresses: []string{watched}, Mode: watchModeSubscribe, WebSocketURL: url, pollInterval: 10 * time.Millisecond})
+		return &dials
+	}
+
+	t.Run("silent", func(t *testing.T) {
+		dials := silentHeadsServer(t, false)
+		deadline := time.Now().Add(2 * time.Second)
+		for dials.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := dials.Load(); n < 2 {
+			t.Errorf("dialled %d times, want a redial once the subscription went silent", n)
+		}
+	})
+
+	t.Run("answering pings", func(t *testing.T) {
+		dials := silentHeadsServer(t, true)
+		time.Sleep(200 * time.Millisecond)
+		if n := dials.Load(); n != 1 {
+			t.Errorf("dialled %d times, want the quiet but live subscription kept", n)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// consoleTemplate, when set, replaces the fixed console line format.
+var consoleTemplate *template.Template
+
+// parseOutputTemplate compiles a per-match template such as
+// "{{.Hash}} {{.ValueEther}}" and executes it once against an empty record so
+// references to unknown fields are rejected before any scanning starts.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, matchRecord{}); err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+type templateMatchWriter struct {
+	w       io.Writer
+	tmpl    *template.Template
+	flusher http.Flusher
+}
+
+func newTemplateMatchWriter(w io.Writer, tmpl *template.Template) *templateMatchWriter {
+	t := &templateMatchWriter{w: w, tmpl: tmpl}
+	t.flusher, _ = w.(http.Flusher)
+	return t
+}
+
+func (t *templateMatchWriter) WriteMatch(m match) error {
+	var line strings.Builder
+	if err := t.tmpl.Execute(&line, newMatchRecord(m)); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(line.String(), "\n") {
+		line.WriteByte('\n')
+	}
+	_, err := io.WriteString(t.w, line.String())
+	return err
+}
+
+// WriteSelfDestruct and WriteWithdrawal use the fixed console lines, since
+// the template is written against transaction records.
+func (t *templateMatchWriter) WriteSelfDestruct(block *BlockWithTransactions, sd selfDestruct) error {
+	return newTextMatchWriter(t.w).WriteSelfDestruct(block, sd)
+}
+
+func (t *templateMatchWriter) WriteWithdrawal(block *BlockWithTransactions, withdrawal Withdrawal) error {
+	return newTextMatchWriter(t.w).WriteWithdrawal(block, withdrawal)
+}
+
+func (t *templateMatchWriter) Flush() error {
+	if t.flusher != nil {
+		t.flusher.Flush()
+	}
+	return nil
+}
+
+func newConsoleMatchWriter(w io.Writer) matchWriter {
+	if consoleTemplate != nil {
+		return newTemplateMatchWriter(w, consoleTemplate)
+	}
+	return newTextMatchWriter(w)
+}
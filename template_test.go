@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOutputTemplate(t *testing.T) {
+	if _, err := parseOutputTemplate("{{.Hash}} {{.ValueEther}}"); err != nil {
+		t.Errorf("valid template: %v", err)
+	}
+	if _, err := parseOutputTemplate("{{.NoSuchField}}"); err == nil || !strings.Contains(err.Error(), "invalid template") {
+		t.Errorf("unknown field: error = %v", err)
+	}
+	if _, err := parseOutputTemplate("{{.Hash"); err == nil {
+		t.Error("unclosed action: no error")
+	}
+}
+
+func TestTemplateWriterWritesEveryEvent(t *testing.T) {
+	tmpl, err := parseOutputTemplate("{{.Hash}} {{.ValueEther}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	w := newTemplateMatchWriter(&out, tmpl)
+	block := testBlock(9)
+	if err := w.WriteMatch(match{Address: watched, Block: block, Tx: Transaction{Hash: "0x01", Value: "0xde0b6b3a7640000"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSelfDestruct(block, selfDestruct{TransactionHash: "0x02", Contract: watched, RefundAddress: other, Balance: "0x0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteWithdrawal(block, Withdrawal{Index: "0x1", ValidatorIndex: "0x2", Address: watched, Amount: "0x3b9aca00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %q", len(lines), out.String())
+	}
+	if lines[0] != "0x01 1.000000" {
+		t.Errorf("match line = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "Self-destruct: Block 0x9 | Hash: 0x02") {
+		t.Errorf("self-destruct line = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "Withdrawal: Block 0x9") || !strings.Contains(lines[2], "Amount: 1.000000 ETH") {
+		t.Errorf("withdrawal line = %q", lines[2])
+	}
+}
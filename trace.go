@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const rpcMethodNotFound = -32601
+
+type traceAction struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	CallType      string `json:"callType"`
+	Input         string `json:"input"`
+	Address       string `json:"address"`
+	RefundAddress string `json:"refundAddress"`
+	Balance       string `json:"balance"`
+}
+
+type blockTrace struct {
+	Action              traceAction `json:"action"`
+	BlockNumber         int64       `json:"blockNumber"`
+	TransactionHash     string      `json:"transactionHash"`
+	TransactionPosition int         `json:"transactionPosition"`
+	TraceAddress        []int       `json:"traceAddress"`
+	Type                string      `json:"type"`
+}
+
+type selfDestruct struct {
+	TransactionHash string
+	Contract        string
+	RefundAddress   string
+	Balance         string
+}
+
+type selfDestructRecord struct {
+	TransactionHash string `json:"transactionHash"`
+	Contract        string `json:"contract"`
+	RefundAddress   string `json:"refundAddress"`
+	Balance         string `json:"balance"`
+	BalanceEther    string `json:"balanceEther"`
+	BlockNumber     string `json:"blockNumber"`
+	BlockHash       string `json:"blockHash"`
+	Timestamp       string `json:"timestamp"`
+}
+
+func newSelfDestructRecord(block *BlockWithTransactions, sd selfDestruct) selfDestructRecord {
+	return selfDestructRecord{
+		TransactionHash: sd.TransactionHash,
+		Contract:        sd.Contract,
+		RefundAddress:   sd.RefundAddress,
+		Balance:         sd.Balance,
+		BalanceEther:    convertWeiToEther(sd.Balance),
+		BlockNumber:     block.Number,
+		BlockHash:       block.Hash,
+		Timestamp:       block.Timestamp,
+	}
+}
+
+func isMethodUnsupported(err error) bool {
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.Code == rpcMethodNotFound {
+		return true
+	}
+
+	message := strings.ToLower(rpcErr.Message)
+	for _, hint := range []string{"not supported", "does not exist", "not available", "method not found", "unsupported"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func traceBlock(ctx context.Context, blockNumber string) ([]blockTrace, error) {
+	response, err := sendRPCRequestContext(ctx, "trace_block", []interface{}{blockNumber})
+	if err != nil {
+		return nil, err
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []blockTrace
+	if err := json.Unmarshal(resultBytes, &traces); err != nil {
+		return nil, err
+	}
+
+	return traces, nil
+}
+
+// findSelfDestructs reports "suicide" traces where the watched address is
+// either the destroyed contract or the beneficiary of its balance.
+func findSelfDestructs(traces []blockTrace, address string) []selfDestruct {
+	var found []selfDestruct
+	for _, trace := range traces {
+		if trace.Type != "suicide" {
+			continue
+		}
+		if trace.Action.Address != address && trace.Action.RefundAddress != address {
+			continue
+		}
+		found = append(found, selfDestruct{
+			TransactionHash: trace.TransactionHash,
+			Contract:        trace.Action.Address,
+			RefundAddress:   trace.Action.RefundAddress,
+			Balance:         trace.Action.Balance,
+		})
+	}
+	return found
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const traceFilterChunk = 1000
+
+func traceFilter(ctx context.Context, fromBlock, toBlock int64, field string, addresses []string) ([]blockTrace, error) {
+	filter := map[string]interface{}{
+		"fromBlock": fmt.Sprintf("0x%x", fromBlock),
+		"toBlock":   fmt.Sprintf("0x%x", toBlock),
+		field:       addresses,
+	}
+	response, err := sendRPCRequestContext(ctx, "trace_filter", []interface{}{filter})
+	if err != nil {
+		return nil, err
+	}
+
+	resultBytes, err := json.Marshal(response["result"])
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []blockTrace
+	if err := json.Unmarshal(resultBytes, &traces); err != nil {
+		return nil, err
+	}
+
+	return traces, nil
+}
+
+func traceKey(trace blockTrace) string {
+	parts := make([]string, len(trace.TraceAddress))
+	for i, index := range trace.TraceAddress {
+		parts[i] = fmt.Sprint(index)
+	}
+	return trace.TransactionHash + "/" + strings.Join(parts, ",")
+}
+
+func isValueTransfer(trace blockTrace) bool {
+	if trace.Type != "call" {
+		return false
+	}
+	value, err := parseQuantity(trace.Action.Value)
+	return err == nil && value.Sign() > 0
+}
+
+// fetchTransfersByTraceFilter finds every value-carrying call, internal ones
+// included, sent from or to the addresses, without fetching whole blocks.
+// Matches carry only the block number since no block header is fetched.
+func fetchTransfersByTraceFilter(ctx context.Context, addresses []string, startBlock, endBlock int64, opts scanOptions, out matchWriter) (scanSummary, error) {
+	defer opts.batchStoreWrites()()
+
+	started := time.Now()
+	summary := scanSummary{FailedBlocks: []int64{}}
+
+	for from := startBlock; from <= endBlock; from += traceFilterChunk {
+		to := min(from+traceFilterChunk-1, endBlock)
+
+		var traces []blockTrace
+		for _, field := range []string{"fromAddress", "toAddress"} {
+			found, err := traceFilter(ctx, from, to, field, addresses)
+			if err != nil {
+				return summary, err
+			}
+			traces = append(traces, found...)
+		}
+
+		seen := make(map[string]bool)
+		var transfers []blockTrace
+		for _, trace := range traces {
+			key := traceKey(trace)
+			if seen[key] || !isValueTransfer(trace) {
+				continue
+			}
+			seen[key] = true
+			transfers = append(transfers, trace)
+		}
+		sort.SliceStable(transfers, func(i, j int) bool {
+			if transfers[i].BlockNumber != transfers[j].BlockNumber {
+				return transfers[i].BlockNumber < transfers[j].BlockNumber
+			}
+			return transfers[i].TransactionPosition < transfers[j].TransactionPosition
+		})
+
+		for _, trace := range transfers {
+			block := &BlockWithTransactions{Number: fmt.Sprintf("0x%x", trace.BlockNumber)}
+			tx := Transaction{
+				Hash:        trace.TransactionHash,
+				From:        trace.Action.From,
+				To:          trace.Action.To,
+				Value:       trace.Action.Value,
+				Input:       trace.Action.Input,
+				BlockNumber: block.Number,
+
+				TransactionIndex: fmt.Sprintf("0x%x", trace.TransactionPosition),
+			}
+			if opts.Filter != nil && !opts.Filter(tx) {
+				continue
+			}
+			for _, address := range addresses {
+				if tx.From != address && tx.To != address {
+					continue
+				}
+				m := match{Address: address, Block: block, Tx: tx, USDPrice: opts.USDPrice, ChainID: opts.ChainID}
+				m.Confirmations = opts.confirmations(block.Number)
+				if size, ok := opts.CodeSizes.sizeOf(ctx, tx.To); ok {
+					m.CodeSize = &size
+				}
+				if err := recordMatch(out, opts, &summary, trace.BlockNumber, m); err != nil {
+					return summary, err
+				}
+			}
+		}
+
+		summary.BlocksScanned += to - from + 1
+		if opts.Stats != nil {
+			opts.Stats.Blocks.Add(to - from + 1)
+		}
+		if err := out.Flush(); err != nil {
+			return summary, err
+		}
+	}
+
+	summary.DurationSeconds = time.Since(started).Seconds()
+	return summary, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// serveTraceFilter answers trace_filter from traces, picking the ones whose
+// from or to address matches the filter field being queried.
+func serveTraceFilter(node *fakeNode, traces []blockTrace) {
+	node.handle("trace_filter", func(params []interface{}) (interface{}, error) {
+		filter := params[0].(map[string]interface{})
+		fromAddresses, _ := filter["fromAddress"].([]interface{})
+		toAddresses, _ := filter["toAddress"].([]interface{})
+		found := []blockTrace{}
+		for _, trace := range traces {
+			for _, address := range fromAddresses {
+				if trace.Action.From == address {
+					found = append(found, trace)
+				}
+			}
+			for _, address := range toAddresses {
+				if trace.Action.To == address {
+					found = append(found, trace)
+				}
+			}
+		}
+		return found, nil
+	})
+}
+
+func transferTrace(block int64, position int, hash, from, to, value string, traceAddress ...int) blockTrace {
+	return blockTrace{
+		Type:                "call",
+		BlockNumber:         block,
+		TransactionHash:     hash,
+		TransactionPosition: position,
+		TraceAddress:        traceAddress,
+		Action:              traceAction{From: from, To: to, Value: value, CallType: "call"},
+	}
+}
+
+func TestTraceFilterFindsInternalTransfers(t *testing.T) {
+	node := newFakeNode(t)
+	serveTraceFilter(node, []blockTrace{
+		transferTrace(7, 1, "0x02", other, watched, "0x5", 0),
+		transferTrace(5, 0, "0x01", watched, other, "0x1"),
+		transferTrace(5, 3, "0x03", watched, watched, "0x2"),
+		transferTrace(6, 0, "0x04", watched, other, "0x0"),
+	})
+
+	out := &recordingWriter{}
+	summary, err := fetchTransfersByTraceFilter(context.Background(), []string{watched}, 1, 10, scanOptions{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(out.hashes(), " "); got != "0x01 0x03 0x02" {
+		t.Errorf("matches = %s, want value transfers once each in block order", got)
+	}
+	if summary.BlocksScanned != 10 || summary.Matches != 3 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if m := out.matches[2]; m.Block.Number != "0x7" || m.Tx.TransactionIndex != "0x1" {
+		t.Errorf("internal transfer match = %+v", m)
+	}
+}
+
+func TestTraceFilterFallsBackToBlockScan(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1, Transaction{Hash: "0x01", From: watched, To: other, Value: "0x1"}))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&method=traceFilter&format=ndjson")
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) != 2 || lines[0]["hash"] != "0x01" {
+		t.Errorf("lines = %v, want the block scan's match and summary", lines)
+	}
+	if node.callCount("trace_filter") != 1 {
+		t.Errorf("trace_filter called %d times, want 1", node.callCount("trace_filter"))
+	}
+}
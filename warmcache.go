@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// warmBatchBlocks is how many full blocks the warm cache asks for per
+// batch.
+const warmBatchBlocks = 10
+
+// recentBlocks is nil unless -warm-blocks is set.
+var recentBlocks *recentBlockCache
+
+// recentBlockCache keeps the latest size blocks, with their transactions,
+// so fetches of recent blocks need no RPC call. refresh adds new blocks as
+// the head moves and drops those that fall out of the window; memory is
+// bounded by size blocks. Cached blocks are shared and must not be
+// modified.
+type recentBlockCache struct {
+	mu     sync.RWMutex
+	size   int64
+	head   int64
+	blocks map[int64]*BlockWithTransactions
+}
+
+func newRecentBlockCache(size int64) *recentBlockCache {
+	return &recentBlockCache{size: size, blocks: make(map[int64]*BlockWithTransactions)}
+}
+
+// get returns a cached block. full=false asks for a header, which is
+// derived from the cached block with only its transaction hashes. A nil
+// cache holds nothing.
+func (c *recentBlockCache) get(blockNumber string, full bool) (*BlockWithTransactions, bool) {
+	if c == nil {
+		return nil, false
+	}
+	number, err := parseQuantity(blockNumber)
+	if err != nil || !number.IsInt64() {
+		return nil, false
+	}
+
+	c.mu.RLock()
+	block, ok := c.blocks[number.Int64()]
+	c.mu.RUnlock()
+	if !ok || full {
+		return block, ok
+	}
+
+	header := *block
+	header.Transactions = nil
+	header.TransactionHashes = make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		header.TransactionHashes[i] = tx.Hash
+	}
+	return &header, true
+}
+
+// refresh fetches the blocks up to the latest that aren't cached yet. When
+// a block's parent hash doesn't match the cached block before it, a reorg
+// replaced that one, so it is fetched again, walking back until the chain
+// joins up.
+func (c *recentBlockCache) refresh(ctx context.Context) error {
+	latest, err := getLatestBlockNumber()
+	if err != nil {
+		return err
+	}
+	low := max(latest-c.size+1, 0)
+
+	c.mu.RLock()
+	from := max(c.head+1, low)
+	c.mu.RUnlock()
+	if err := c.load(ctx, from, latest); err != nil {
+		return err
+	}
+
+	for number := latest; number > low; number-- {
+		c.mu.RLock()
+		parent, child := c.blocks[number-1], c.blocks[number]
+		c.mu.RUnlock()
+		if parent == nil || child == nil || parent.Hash == child.ParentHash {
+			if number < from {
+				break
+			}
+			continue
+		}
+		log.Printf("Warm cache: block %d was replaced, fetching it again", number-1)
+		if err := c.load(ctx, number-1, number-1); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.head = max(c.head, latest)
+	for number := range c.blocks {
+		if number < low {
+			delete(c.blocks, number)
+		}
+	}
+	return nil
+}
+
+func (c *recentBlockCache) load(ctx context.Context, from, to int64) error {
+	for start := from; start <= to; start += warmBatchBlocks {
+		end := min(start+warmBatchBlocks-1, to)
+		var calls []rpcCall
+		for number := start; number <= end; number++ {
+			calls = append(calls, rpcCall{Method: "eth_getBlockByNumber", Params: []interface{}{fmt.Sprintf("0x%x", number), true}})
+		}
+		results, err := sendRPCBatch(ctx, calls)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			number := start + int64(i)
+			if result.Err != nil {
+				return fmt.Errorf("failed to fetch block %d: %v", number, result.Err)
+			}
+			var block BlockWithTransactions
+			if err := decodeResult(result.Response, &block); err != nil {
+				return fmt.Errorf("failed to decode block %d: %v", number, err)
+			}
+			if block.Hash == "" || len(block.TransactionHashes) > 0 {
+				return fmt.Errorf("block %d came back without its transactions", number)
+			}
+			c.mu.Lock()
+			c.blocks[number] = &block
+			c.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (c *recentBlockCache) run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := c.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error refreshing warm cache: %v", err)
+		}
+		pause(ctx, interval)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// forkBlock is a block on a competing branch: its hash, and optionally its
+// parent's, differ from the testBlock at the same height.
+func forkBlock(number int64, forkedParent bool, txs ...Transaction) *BlockWithTransactions {
+	block := testBlock(number, txs...)
+	block.Hash = fmt.Sprintf("0xf0%062x", number)
+	if forkedParent {
+		block.ParentHash = fmt.Sprintf("0xf0%062x", number-1)
+	}
+	return block
+}
+
+func chain(from, to int64) []*BlockWithTransactions {
+	var blocks []*BlockWithTransactions
+	for number := from; number <= to; number++ {
+		blocks = append(blocks, testBlock(number, Transaction{Hash: fmt.Sprintf("0x%02x", number), From: watched, To: other}))
+	}
+	return blocks
+}
+
+func cachedNumbers(c *recentBlockCache) string {
+	var numbers []int64
+	for number := int64(0); number <= c.head; number++ {
+		if _, ok := c.blocks[number]; ok {
+			numbers = append(numbers, number)
+		}
+	}
+	return fmt.Sprint(numbers)
+}
+
+func TestRecentBlockCacheFollowsTheHead(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(chain(1, 10)...)
+
+	c := newRecentBlockCache(4)
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedNumbers(c); got != "[7 8 9 10]" {
+		t.Errorf("cached %s, want the latest 4 blocks", got)
+	}
+	if node.batches != 1 {
+		t.Errorf("loaded in %d batches, want 1", node.batches)
+	}
+
+	block, ok := c.get("0x8", true)
+	if !ok || block.Hash != testBlock(8).Hash || len(block.Transactions) != 1 {
+		t.Errorf("get(0x8, full) = %+v, %v", block, ok)
+	}
+	header, ok := c.get("0x8", false)
+	if !ok || header.Transactions != nil || fmt.Sprint(header.TransactionHashes) != "[0x08]" {
+		t.Errorf("get(0x8, header) = %+v, %v", header, ok)
+	}
+	if len(block.TransactionHashes) != 0 {
+		t.Error("deriving a header changed the cached block")
+	}
+	for _, tag := range []string{"0x6", "0xb", "latest"} {
+		if _, ok := c.get(tag, true); ok {
+			t.Errorf("get(%s) hit", tag)
+		}
+	}
+
+	node.serveBlocks(chain(1, 12)...)
+	before := node.callCount("eth_getBlockByNumber")
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedNumbers(c); got != "[9 10 11 12]" {
+		t.Errorf("cached %s after the head moved, want 9-12", got)
+	}
+	if calls := node.callCount("eth_getBlockByNumber") - before; calls != 2 {
+		t.Errorf("fetched %d blocks, want only the 2 new ones", calls)
+	}
+
+	var none *recentBlockCache
+	if _, ok := none.get("0x8", true); ok {
+		t.Error("a nil cache returned a block")
+	}
+}
+
+func TestRecentBlockCacheRefetchesReorgedBlocks(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(chain(1, 12)...)
+	c := newRecentBlockCache(5)
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks 11 and 12 are replaced by a branch that block 13 builds on.
+	blocks := chain(1, 10)
+	blocks = append(blocks,
+		forkBlock(11, false, Transaction{Hash: "0xb1", From: watched, To: other}),
+		forkBlock(12, true),
+		forkBlock(13, true),
+	)
+	node.serveBlocks(blocks...)
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for number := int64(11); number <= 13; number++ {
+		block, ok := c.get(fmt.Sprintf("0x%x", number), true)
+		if !ok || block.Hash != forkBlock(number, false).Hash {
+			t.Errorf("block %d = %v, want the replacement", number, block)
+		}
+	}
+	if block, _ := c.get("0xa", true); block.Hash != testBlock(10).Hash {
+		t.Errorf("block 10 = %s, want it kept", block.Hash)
+	}
+	if got := cachedNumbers(c); got != "[9 10 11 12 13]" {
+		t.Errorf("cached %s", got)
+	}
+}
+
+func TestRecentBlockCacheRejectsHashOnlyBlocks(t *testing.T) {
+	node := newFakeNode(t)
+	serveHashOnlyBlocks(node)
+
+	c := newRecentBlockCache(2)
+	if err := c.refresh(context.Background()); err == nil {
+		t.Error("cached blocks without their transactions")
+	}
+}
+
+func TestScanReadsRecentBlocksFromTheWarmCache(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(chain(1, 6)...)
+
+	previous := recentBlocks
+	recentBlocks = newRecentBlockCache(3)
+	t.Cleanup(func() { recentBlocks = previous })
+	if err := recentBlocks.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	before := node.callCount("eth_getBlockByNumber")
+
+	out := &recordingWriter{}
+	if _, err := fetchTransactions(context.Background(), []string{watched}, 2, 6, scanOptions{}, out); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(out.hashes()) != "[0x02 0x03 0x04 0x05 0x06]" {
+		t.Errorf("matches = %v", out.hashes())
+	}
+	if calls := node.callCount("eth_getBlockByNumber") - before; calls != 2 {
+		t.Errorf("eth_getBlockByNumber called %d times, want only blocks 2 and 3 outside the cache", calls)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultWatchPollInterval = 12 * time.Second
+
+// watchConfig is the -watch-config file: the addresses to follow from the
+// chain head, an optional filter expression, the polling interval, how
+// long emitted matches are remembered to suppress repeats, how many
+// confirmations a match needs before it is printed and whether new blocks
+// are found by polling or by an eth_subscribe subscription.
+type watchConfig struct {
+	Addresses    []string `json:"addresses"`
+	Filter       string   `json:"filter"`
+	PollInterval string   `json:"pollInterval"`
+	DedupBlocks  int64    `json:"dedupBlocks"`
+	DedupWindow  string   `json:"dedupWindow"`
+
+	Confirmations int64 `json:"confirmations"`
+
+	Mode         string `json:"mode"`
+	WebSocketURL string `json:"websocketUrl"`
+
+	filter       txPredicate
+	pollInterval time.Duration
+	dedupWindow  time.Duration
+}
+
+func loadWatchConfig(path string) (*watchConfig, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config watchConfig
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode watch config %s: %v", path, err)
+	}
+	if len(config.Addresses) == 0 {
+		return nil, fmt.Errorf("watch config %s has no addresses", path)
+	}
+	for i, address := range config.Addresses {
+		config.Addresses[i] = strings.ToLower(strings.TrimSpace(address))
+	}
+
+	if config.Filter != "" {
+		config.filter, err = parseFilter(config.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter in watch config %s: %v", path, err)
+		}
+	}
+
+	config.pollInterval = defaultWatchPollInterval
+	if config.PollInterval != "" {
+		config.pollInterval, err = time.ParseDuration(config.PollInterval)
+		if err != nil || config.pollInterval <= 0 {
+			return nil, fmt.Errorf("invalid pollInterval in watch config %s", path)
+		}
+	}
+	switch config.Mode {
+	case "":
+		config.Mode = watchModeAuto
+	case watchModeAuto, watchModePoll, watchModeSubscribe:
+	default:
+		return nil, fmt.Errorf("invalid mode %q in watch config %s, want auto, poll or subscribe", config.Mode, path)
+	}
+	if config.WebSocketURL != "" && !strings.HasPrefix(config.WebSocketURL, "ws://") && !strings.HasPrefix(config.WebSocketURL, "wss://") {
+		return nil, fmt.Errorf("invalid websocketUrl in watch config %s", path)
+	}
+	if config.Confirmations < 0 {
+		return nil, fmt.Errorf("invalid confirmations in watch config %s", path)
+	}
+	if config.DedupBlocks < 0 {
+		return nil, fmt.Errorf("invalid dedupBlocks in watch config %s", path)
+	}
+	if config.DedupWindow != "" {
+		config.dedupWindow, err = time.ParseDuration(config.DedupWindow)
+		if err != nil || config.dedupWindow <= 0 {
+			return nil, fmt.Errorf("invalid dedupWindow in watch config %s", path)
+		}
+	}
+	return &config, nil
+}
+
+// watchDedup remembers the matches a watcher has written so a repeated scan,
+// such as the one after a reload, doesn't print them twice. A transaction
+// seen again in a block with a different hash, after a reorg, is written
+// again. Entries are forgotten once they are blocks below the head or
+// older than window, whichever comes first; with neither set nothing is
+// suppressed.
+type watchDedup struct {
+	blocks int64
+	window time.Duration
+	seen   map[string]seenMatch
+}
+
+type seenMatch struct {
+	blockHash string
+	block     int64
+	at        time.Time
+}
+
+func (d *watchDedup) enabled() bool {
+	return d.blocks > 0 || d.window > 0
+}
+
+func (d *watchDedup) prune(head int64, now time.Time) {
+	for key, seen := range d.seen {
+		if (d.blocks > 0 && head-seen.block >= d.blocks) || (d.window > 0 && now.Sub(seen.at) >= d.window) {
+			delete(d.seen, key)
+		}
+	}
+}
+
+// emitted reports whether m was already written for the same block, and
+// remembers it otherwise.
+func (d *watchDedup) emitted(m match, now time.Time) bool {
+	key := m.Address + "/" + strings.ToLower(m.Tx.Hash)
+	if seen, ok := d.seen[key]; ok && seen.blockHash == m.Block.Hash {
+		return true
+	}
+
+	block, err := parseQuantity(m.Block.Number)
+	if err != nil {
+		return false
+	}
+	d.seen[key] = seenMatch{blockHash: m.Block.Hash, block: block.Int64(), at: now}
+	return false
+}
+
+type dedupMatchWriter struct {
+	matchWriter
+	dedup *watchDedup
+}
+
+func (d dedupMatchWriter) WriteMatch(m match) error {
+	if d.dedup.emitted(m, time.Now()) {
+		return nil
+	}
+	return d.matchWriter.WriteMatch(m)
+}
+
+// watcher follows the chain head for one config at a time. restart swaps
+// the config by cancelling the running loop, waiting for it to exit and
+// starting a new one that carries on from the same block, so no block is
+// skipped across a reload. A scan interrupted by a reload is repeated in
+// full by the new loop; dedup, kept across reloads, can suppress the
+// repeats. Matches waiting for confirmations also survive a reload.
+type watcher struct {
+	out        matchWriter
+	dedup      *watchDedup
+	confirming *confirmationBuffer
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	next   int64
+}
+
+func newWatcher(out matchWriter) *watcher {
+	return &watcher{
+		out:        out,
+		dedup:      &watchDedup{seen: make(map[string]seenMatch)},
+		confirming: newConfirmationBuffer(),
+	}
+}
+
+func (w *watcher) restart(config *watchConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancel != nil {
+		w.cancel()
+		<-w.done
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		w.run(ctx, config)
+	}(w.done)
+	log.Printf("Watching %s", strings.Join(config.Addresses, ","))
+}
+
+func (w *watcher) run(ctx context.Context, config *watchConfig) {
+	opts := scanOptions{Retries: defaultBlockRetries, Filter: config.filter}
+	w.dedup.blocks, w.dedup.window = config.DedupBlocks, config.dedupWindow
+	w.confirming.depth = config.Confirmations
+
+	// Auto mode polls if the first subscription attempt fails; once one
+	// has worked, a dropped subscription is retried instead.
+	for established := false; config.Mode != watchModePoll; {
+		subscribed, err := w.follow(ctx, config, opts)
+		if ctx.Err() != nil {
+			return
+		}
+		established = established || subscribed
+		if !established && config.Mode == watchModeAuto {
+			log.Printf("Watch falling back to polling every %s, newHeads subscription unavailable: %v", config.pollInterval, err)
+			break
+		}
+		log.Printf("Watch subscription to newHeads failed, retrying in %s: %v", config.pollInterval, err)
+		pause(ctx, config.pollInterval)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	for {
+		if err := w.poll(ctx, config.Addresses, opts); err != nil && ctx.Err() == nil {
+			log.Printf("Error watching %s: %v", strings.Join(config.Addresses, ","), err)
+		}
+		pause(ctx, config.pollInterval)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// poll scans every block since the last poll. Only the loop goroutine
+// touches next, and restart waits for it to exit before starting another.
+func (w *watcher) poll(ctx context.Context, addresses []string, opts scanOptions) error {
+	latest, err := getLatestBlockNumber()
+	if err != nil {
+		return err
+	}
+	if w.next == 0 {
+		w.next = latest
+	}
+	if latest < w.next {
+		return nil
+	}
+
+	out := w.out
+	if w.dedup.enabled() {
+		w.dedup.prune(latest, time.Now())
+		out = dedupMatchWriter{matchWriter: w.out, dedup: w.dedup}
+	}
+
+	scanOut := out
+	if w.confirming.depth > 0 || len(w.confirming.pending) > 0 {
+		scanOut = w.confirming
+	}
+
+	opts.Head = latest
+	summary, err := fetchTransactions(ctx, addresses, w.next, latest, opts, scanOut)
+	if err != nil {
+		return err
+	}
+	if len(summary.FailedBlocks) > 0 {
+		log.Printf("Watch skipped %d blocks that could not be fetched: %v", len(summary.FailedBlocks), summary.FailedBlocks)
+	}
+	w.next = latest + 1
+
+	if scanOut != w.confirming {
+		return nil
+	}
+	reorged, err := w.confirming.release(ctx, latest, out)
+	for _, block := range reorged {
+		if _, err := fetchTransactions(ctx, addresses, block, block, opts, w.confirming); err != nil {
+			log.Printf("Error rescanning reorged block %d: %v", block, err)
+		}
+	}
+	return err
+}
+
+func reloadWatchOnSignal(path string, w *watcher) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		config, err := loadWatchConfig(path)
+		if err != nil {
+			log.Printf("Error reloading watch config, keeping the current watch: %v", err)
+			continue
+		}
+		w.restart(config)
+	}
+}
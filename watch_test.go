@@ -0,0 +1,204 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeWatchConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "watch.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWatchConfig(t *testing.T) {
+	config, err := loadWatchConfig(writeWatchConfig(t, `{"addresses":[" 0x00000000000000000000000000000000000000AA "],"filter":"value > 1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Addresses) != 1 || config.Addresses[0] != watched {
+		t.Errorf("addresses = %q, want trimmed and lower-cased", config.Addresses)
+	}
+	if config.pollInterval != defaultWatchPollInterval || config.Mode != watchModeAuto || config.filter == nil {
+		t.Errorf("config = %+v", config)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "not json", contents: `addresses: [0xaa]`, wantErr: "failed to decode"},
+		{name: "no addresses", contents: `{"addresses":[]}`, wantErr: "has no addresses"},
+		{name: "bad filter", contents: `{"addresses":["0xaa"],"filter":"value >"}`, wantErr: "invalid filter"},
+		{name: "bad interval", contents: `{"addresses":["0xaa"],"pollInterval":"0s"}`, wantErr: "invalid pollInterval"},
+		{name: "bad mode", contents: `{"addresses":["0xaa"],"mode":"push"}`, wantErr: "invalid mode"},
+		{name: "negative confirmations", contents: `{"addresses":["0xaa"],"confirmations":-1}`, wantErr: "invalid confirmations"},
+		{name: "negative dedup depth", contents: `{"addresses":["0xaa"],"dedupBlocks":-1}`, wantErr: "invalid dedupBlocks"},
+		{name: "bad dedup window", contents: `{"addresses":["0xaa"],"dedupWindow":"forever"}`, wantErr: "invalid dedupWindow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadWatchConfig(writeWatchConfig(t, tt.contents))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := loadWatchConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+// channelWriter hands each match to the test as the watcher writes it.
+type channelWriter chan match
+
+func (c channelWriter) WriteMatch(m match) error {
+	c <- m
+	return nil
+}
+
+func (c channelWriter) Flush() error { return nil }
+
+func (c channelWriter) next(t *testing.T) match {
+	t.Helper()
+	select {
+	case m := <-c:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a match")
+		return match{}
+	}
+}
+
+// waitForCalls waits until the node has answered method at least n times.
+func waitForCalls(t *testing.T, node *fakeNode, method string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for node.callCount(method) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s called %d times, want %d", method, node.callCount(method), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startWatcher runs a polling watcher and stops it when the test ends.
+func startWatcher(t *testing.T, out matchWriter, config *watchConfig) *watcher {
+	t.Helper()
+	w := newWatcher(out)
+	w.restart(config)
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.cancel()
+		<-w.done
+	})
+	return w
+}
+
+func TestWatcherRestartCarriesOnFromTheSameBlock(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2), testBlock(3, Transaction{Hash: "0x03", From: watched, To: "0xcc"}))
+
+	out := make(channelWriter, 10)
+	w := startWatcher(t, out, &watchConfig{Addresses: []string{watched}, Mode: watchModePoll, pollInterval: 5 * time.Millisecond})
+	if m := out.next(t); m.Tx.Hash != "0x03" {
+		t.Fatalf("first match = %s, want the head block's 0x03", m.Tx.Hash)
+	}
+	// An interrupted scan is repeated after a reload, so let this one finish.
+	waitForCalls(t, node, "eth_blockNumber", 2)
+
+	w.restart(&watchConfig{Addresses: []string{watched, other}, Mode: watchModePoll, pollInterval: 5 * time.Millisecond})
+	node.serveBlocks(
+		testBlock(1), testBlock(2), testBlock(3, Transaction{Hash: "0x03", From: watched, To: "0xcc"}),
+		testBlock(4, Transaction{Hash: "0x04", From: other, To: "0xcc"}),
+		testBlock(5, Transaction{Hash: "0x05", From: "0xcc", To: watched}),
+	)
+
+	var got []string
+	for len(got) < 2 {
+		m := out.next(t)
+		got = append(got, m.Tx.Hash+"/"+m.Address)
+	}
+	if want := "0x04/" + other + " 0x05/" + watched; strings.Join(got, " ") != want {
+		t.Errorf("matches after reload = %v, want %s", got, want)
+	}
+	select {
+	case m := <-out:
+		t.Errorf("unexpected match %s/%s", m.Tx.Hash, m.Address)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestWatchDedup(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seen := match{Address: watched, Block: testBlock(5), Tx: Transaction{Hash: "0xAB"}}
+	reorged := match{Address: watched, Block: &BlockWithTransactions{Number: "0x5", Hash: "0xother"}, Tx: Transaction{Hash: "0xab"}}
+
+	d := &watchDedup{blocks: 3, window: time.Minute, seen: make(map[string]seenMatch)}
+	if d.emitted(seen, start) {
+		t.Fatal("first sighting reported as emitted")
+	}
+	if !d.emitted(seen, start) {
+		t.Error("repeat in the same block not suppressed")
+	}
+	if d.emitted(match{Address: other, Block: seen.Block, Tx: seen.Tx}, start) {
+		t.Error("the same transaction for another address was suppressed")
+	}
+	if d.emitted(reorged, start) {
+		t.Error("transaction in a reorged block was suppressed")
+	}
+
+	d.prune(7, start.Add(30*time.Second))
+	if len(d.seen) != 2 {
+		t.Errorf("pruned to %d entries at depth 2, want both kept", len(d.seen))
+	}
+	d.prune(8, start.Add(30*time.Second))
+	if len(d.seen) != 0 {
+		t.Errorf("%d entries kept at depth 3", len(d.seen))
+	}
+
+	d = &watchDedup{window: time.Minute, seen: make(map[string]seenMatch)}
+	d.emitted(seen, start)
+	d.prune(1000, start.Add(time.Minute))
+	if d.emitted(seen, start.Add(time.Minute)) {
+		t.Error("match suppressed after its window passed")
+	}
+	if (&watchDedup{}).enabled() {
+		t.Error("dedup enabled with neither a depth nor a window")
+	}
+}
+
+func TestWatcherDedupSuppressesRepeatsAcrossReload(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(testBlock(1), testBlock(2, Transaction{Hash: "0x02", From: watched, To: "0xcc"}))
+
+	out := make(channelWriter, 10)
+	config := &watchConfig{Addresses: []string{watched}, Mode: watchModePoll, pollInterval: 5 * time.Millisecond, DedupBlocks: 10}
+	w := startWatcher(t, out, config)
+	if m := out.next(t); m.Tx.Hash != "0x02" {
+		t.Fatalf("first match = %s, want 0x02", m.Tx.Hash)
+	}
+
+	// Rewind so the new loop scans block 2 again, as after an interrupted scan.
+	w.mu.Lock()
+	w.cancel()
+	<-w.done
+	w.next = 2
+	w.mu.Unlock()
+	w.restart(config)
+	waitForCalls(t, node, "eth_blockNumber", node.callCount("eth_blockNumber")+2)
+
+	select {
+	case m := <-out:
+		t.Errorf("repeated match %s written again", m.Tx.Hash)
+	default:
+	}
+}
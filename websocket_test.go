@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsServerConn is the server end of a test WebSocket. Frames it writes are
+// unmasked, as a server's must be.
+type wsServerConn struct {
+	t    *testing.T
+	conn net.Conn
+	in   *wsConn
+}
+
+func (c *wsServerConn) read() (opcode byte, payload []byte) {
+	c.t.Helper()
+	_, opcode, payload, err := c.in.readFrame()
+	if err != nil {
+		c.t.Errorf("reading client frame: %v", err)
+	}
+	return opcode, payload
+}
+
+func (c *wsServerConn) write(opcode byte, fin bool, payload []byte) {
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+	frame := []byte{head}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	default:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	c.conn.Write(append(frame, payload...))
+}
+
+// newWebSocketServer upgrades every request and hands the connection to
+// serve, closing it when serve returns. It returns the ws:// URL.
+func newWebSocketServer(t *testing.T, serve func(c *wsServerConn, r *http.Request)) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			http.Error(w, "not a WebSocket upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		accept := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsAcceptGUID))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")
+		rw.Flush()
+		serve(&wsServerConn{t: t, conn: conn, in: &wsConn{conn: conn, reader: rw.Reader}}, r)
+	}))
+	t.Cleanup(server.Close)
+	return "ws://" + strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	url := newWebSocketServer(t, func(c *wsServerConn, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		opcode, payload := c.read()
+		if opcode != wsOpText || string(payload) != "hello" {
+			t.Errorf("client sent opcode %d %q", opcode, payload)
+		}
+
+		c.write(wsOpPing, true, []byte("are you there"))
+		if opcode, payload := c.read(); opcode != wsOpPong || string(payload) != "are you there" {
+			t.Errorf("ping answered with opcode %d %q", opcode, payload)
+		}
+		c.write(wsOpText, false, []byte("frag"))
+		c.write(wsOpContinuation, true, []byte("mented"))
+		c.write(wsOpText, true, []byte(strings.Repeat("x", 300)))
+		c.write(wsOpClose, true, nil)
+		c.read()
+	})
+
+	conn, err := dialWebSocket(context.Background(), url, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteText([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"fragmented", strings.Repeat("x", 300)} {
+		message, err := conn.ReadMessage()
+		if err != nil || string(message) != want {
+			t.Fatalf("message = %.20q, %v, want %.20q", message, err, want)
+		}
+	}
+	if _, err := conn.ReadMessage(); err != io.EOF {
+		t.Errorf("after close frame: error = %v, want io.EOF", err)
+	}
+}
+
+func TestDialWebSocketRejectsBadUpgrades(t *testing.T) {
+	refused := httptest.NewServer(http.NotFoundHandler())
+	defer refused.Close()
+	badAccept := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: bogus\r\n\r\n")
+		rw.Flush()
+	}))
+	defer badAccept.Close()
+
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{url: "ws://" + strings.TrimPrefix(refused.URL, "http://"), wantErr: "upgrade refused"},
+		{url: "ws://" + strings.TrimPrefix(badAccept.URL, "http://"), wantErr: "bad Sec-WebSocket-Accept"},
+		{url: refused.URL, wantErr: "unsupported WebSocket scheme"},
+	}
+	for _, tt := range tests {
+		_, err := dialWebSocket(context.Background(), tt.url, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("dial %s: error = %v, want one containing %q", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebSocketReaderRejectsOversizedFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		frame := []byte{0x80 | wsOpText, 127}
+		server.Write(binary.BigEndian.AppendUint64(frame, wsMaxMessage+1))
+		server.Close()
+	}()
+
+	conn := &wsConn{conn: client, reader: bufio.NewReader(client)}
+	if _, err := conn.ReadMessage(); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("error = %v, want the frame refused", err)
+	}
+}
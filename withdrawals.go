@@ -0,0 +1,44 @@
+package main
+
+import "math/big"
+
+// Withdrawal is a post-Shanghai validator withdrawal. Amount is in gwei.
+type Withdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// withdrawalWriter is implemented by outputs that can report withdrawals
+// to watched addresses next to transactions.
+type withdrawalWriter interface {
+	WriteWithdrawal(block *BlockWithTransactions, withdrawal Withdrawal) error
+}
+
+// withdrawalEther converts a withdrawal's gwei amount to ether.
+func withdrawalEther(amount string) string {
+	gwei, err := parseQuantity(amount)
+	if err != nil {
+		return amount
+	}
+	return formatEther(new(big.Int).Mul(gwei, big.NewInt(1e9)))
+}
+
+type withdrawalRecord struct {
+	Withdrawal
+	BlockNumber string `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+	Timestamp   string `json:"timestamp"`
+	AmountEther string `json:"amountEther"`
+}
+
+func newWithdrawalRecord(block *BlockWithTransactions, withdrawal Withdrawal) withdrawalRecord {
+	return withdrawalRecord{
+		Withdrawal:  withdrawal,
+		BlockNumber: block.Number,
+		BlockHash:   block.Hash,
+		Timestamp:   block.Timestamp,
+		AmountEther: withdrawalEther(withdrawal.Amount),
+	}
+}
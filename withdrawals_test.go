@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func withdrawalBlock(number int64, withdrawals ...Withdrawal) *BlockWithTransactions {
+	block := testBlock(number)
+	block.Withdrawals = withdrawals
+	return block
+}
+
+func TestScanReportsWithdrawals(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(
+		withdrawalBlock(1, Withdrawal{Index: "0x1", ValidatorIndex: "0x10", Address: watched, Amount: "0x3b9aca00"}),
+		withdrawalBlock(2,
+			Withdrawal{Index: "0x2", ValidatorIndex: "0x11", Address: other, Amount: "0x1"},
+			Withdrawal{Index: "0x3", ValidatorIndex: "0x10", Address: watched, Amount: "0x2"},
+		),
+	)
+
+	out := &recordingWriter{}
+	summary, err := fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{Withdrawals: true}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.withdrawals) != 2 || out.withdrawals[0].Index != "0x1" || out.withdrawals[1].Index != "0x3" {
+		t.Errorf("withdrawals = %+v, want only those paid to %s", out.withdrawals, watched)
+	}
+	if summary.Withdrawals != 2 || summary.Matches != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	out = &recordingWriter{}
+	summary, err = fetchTransactions(context.Background(), []string{watched}, 1, 2, scanOptions{}, out)
+	if err != nil || len(out.withdrawals) != 0 || summary.Withdrawals != 0 {
+		t.Errorf("without the option: withdrawals = %+v, summary = %+v, err = %v", out.withdrawals, summary, err)
+	}
+}
+
+func TestNDJSONWritesWithdrawalEvents(t *testing.T) {
+	node := newFakeNode(t)
+	node.serveBlocks(withdrawalBlock(1, Withdrawal{Index: "0x1", ValidatorIndex: "0x10", Address: watched, Amount: "0x77359400"}))
+
+	rec := getScan(t, "address="+watched+"&startBlock=1&endBlock=1&format=ndjson&withdrawals=true")
+	lines := ndjsonLines(t, rec.Body.String())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %s", len(lines), rec.Body)
+	}
+	event := lines[0]
+	if event["type"] != "withdrawal" || event["validatorIndex"] != "0x10" || event["blockNumber"] != "0x1" || event["amountEther"] != "2.000000" {
+		t.Errorf("withdrawal event = %v", event)
+	}
+	if lines[1]["type"] != "complete" || lines[1]["withdrawals"] != 1.0 {
+		t.Errorf("summary line = %v", lines[1])
+	}
+}
+
+func TestWithdrawalEther(t *testing.T) {
+	tests := map[string]string{
+		"0x3b9aca00": "1.000000",
+		"0x0":        "0.000000",
+		"gwei":       "gwei",
+	}
+	for amount, want := range tests {
+		if got := withdrawalEther(amount); got != want {
+			t.Errorf("withdrawalEther(%q) = %q, want %q", amount, got, want)
+		}
+	}
+}